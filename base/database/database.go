@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	mongoGo "go.mongodb.org/mongo-driver/mongo"
 	"time"
@@ -37,7 +38,12 @@ func GetMySQLConn() (*sql.Conn, error) {
 	return defaultMySQL.Get()
 }
 
-// 4.关闭 MySQL
+// 4.MySQL 携带上下文获取连接，常用于传入 network.Context.Context() 以遵循请求的超时与取消
+func GetMySQLConnContext(ctx context.Context) (*sql.Conn, error) {
+	return defaultMySQL.GetContext(ctx)
+}
+
+// 5.关闭 MySQL
 func CloseMySQL() error {
 	return defaultMySQL.Close()
 }
@@ -97,11 +97,13 @@ func (m *mongo) Initialize(username, password, database, host string, port int,
 
 	client, err := mongoGo.Connect(ctx, clientOption)
 	if err != nil {
+		cancel()
 		return err
 	}
 
 	err = client.Ping(context.TODO(), nil)
 	if err != nil {
+		cancel()
 		return err
 	}
 
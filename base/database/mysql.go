@@ -20,6 +20,9 @@ type (
 		// 获取连接
 		Get() (*sql.Conn, error)
 
+		// 携带上下文获取连接，上下文取消或超时时放弃等待
+		GetContext(context.Context) (*sql.Conn, error)
+
 		// 关闭连接池
 		Close() error
 	}
@@ -103,6 +106,15 @@ func (m *mysql) Get() (*sql.Conn, error) {
 	return m.db.Conn(context.Background())
 }
 
+// 携带上下文获取连接
+func (m *mysql) GetContext(ctx context.Context) (*sql.Conn, error) {
+	if m.db == nil {
+		return nil, ErrNilDB
+	}
+
+	return m.db.Conn(ctx)
+}
+
 // 关闭连接
 func (m *mysql) Close() error {
 	return m.db.Close()
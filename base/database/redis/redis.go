@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	redisGo "github.com/gomodule/redigo/redis"
+	"jarvis/base/metrics"
 	"time"
 )
 
@@ -16,6 +17,9 @@ type (
 		// 获取连接
 		Get() (redisGo.Conn, error)
 
+		// 连接池统计，返回活跃连接数(包括空闲连接)和空闲连接数
+		Stats() (int, int)
+
 		// 关闭连接池
 		Close() error
 	}
@@ -109,6 +113,16 @@ func (r *redis) Get() (redisGo.Conn, error) {
 	return r.pool.Get(), nil
 }
 
+// 连接池统计
+func (r *redis) Stats() (int, int) {
+	if r.pool == nil {
+		return 0, 0
+	}
+
+	stats := r.pool.Stats()
+	return stats.ActiveCount, stats.IdleCount
+}
+
 // 关闭连接池
 func (r *redis) Close() error {
 	return r.pool.Close()
@@ -120,6 +134,18 @@ var (
 	defaultRedis = NewRedis()
 )
 
+func init() {
+	// 默认 Redis 连接池指标
+	metrics.NewGaugeFunc("jarvis_redis_pool_active_connections", "Connections in the default redis pool, including idle ones.", func() float64 {
+		active, _ := defaultRedis.Stats()
+		return float64(active)
+	})
+	metrics.NewGaugeFunc("jarvis_redis_pool_idle_connections", "Idle connections in the default redis pool.", func() float64 {
+		_, idle := defaultRedis.Stats()
+		return float64(idle)
+	})
+}
+
 // 1.初始化 Redis
 func InitializeRedis(idleTimeout time.Duration, maxIdle, maxActive int, host string, port int, password string) {
 	defaultRedis.Initialize(idleTimeout, maxIdle, maxActive, host, port, password)
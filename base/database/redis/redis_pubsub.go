@@ -0,0 +1,92 @@
+package redis
+
+import (
+	redisGo "github.com/gomodule/redigo/redis"
+)
+
+type (
+	// 订阅者定义，独占一个连接，直到 Close()
+	Subscriber interface {
+		// 订阅频道
+		Subscribe(channels ...string) error
+
+		// 退订频道
+		Unsubscribe(channels ...string) error
+
+		// 阻塞接收一条频道消息，返回频道名和消息内容，订阅确认等非消息回复会被跳过
+		Receive() (string, []byte, error)
+
+		// 关闭，归还连接
+		Close() error
+	}
+
+	// 订阅者定义实现
+	subscriber struct {
+		psc redisGo.PubSubConn
+	}
+)
+
+// 将信息 message 发送到指定的频道 channel ，返回接收到信息 message 的订阅者数量
+func Publish(channel string, message interface{}) (int, error) {
+	conn, err := GetRedisConn()
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := redisGo.Int(conn.Do("publish", channel, message))
+	if err != nil {
+		_ = conn.Close()
+		return 0, err
+	}
+
+	return v, conn.Close()
+}
+
+// 新建订阅者，从默认连接池中取出一个连接独占使用
+func NewSubscriber() (Subscriber, error) {
+	conn, err := GetRedisConn()
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscriber{
+		psc: redisGo.PubSubConn{Conn: conn},
+	}, nil
+}
+
+// 订阅频道
+func (s *subscriber) Subscribe(channels ...string) error {
+	args := make([]interface{}, 0, len(channels))
+	for _, channel := range channels {
+		args = append(args, channel)
+	}
+
+	return s.psc.Subscribe(args...)
+}
+
+// 退订频道
+func (s *subscriber) Unsubscribe(channels ...string) error {
+	args := make([]interface{}, 0, len(channels))
+	for _, channel := range channels {
+		args = append(args, channel)
+	}
+
+	return s.psc.Unsubscribe(args...)
+}
+
+// 阻塞接收一条频道消息
+func (s *subscriber) Receive() (string, []byte, error) {
+	for {
+		switch v := s.psc.Receive().(type) {
+		case redisGo.Message:
+			return v.Channel, v.Data, nil
+		case error:
+			return "", nil, v
+		}
+	}
+}
+
+// 关闭
+func (s *subscriber) Close() error {
+	return s.psc.Close()
+}
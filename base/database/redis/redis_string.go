@@ -42,6 +42,23 @@ func Set(key, value string, timeoutType TimeoutType, timeoutValue int64, existTy
 	return conn.Close()
 }
 
+// 设置值及过期时间，不论键是否存在
+func SetWithTimeout(key, value string, timeoutType TimeoutType, timeoutValue int64) error {
+	conn, err := GetRedisConn()
+	if err != nil {
+		return err
+	}
+
+	// 成功 "OK"
+	_, err = redisGo.String(conn.Do("set", key, value, timeoutType, timeoutValue))
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	return conn.Close()
+}
+
 // 获取值
 func Get(key string) (string, error) {
 	conn, err := GetRedisConn()
@@ -3,9 +3,11 @@ package log
 import (
 	"fmt"
 	"io"
+	"jarvis/base/metrics"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +20,9 @@ type (
 		// 设置过滤层级
 		SetFilterLevel(Level)
 
+		// 当前过滤层级
+		FilterLevel() Level
+
 		// 设置构建标识
 		SetFlag(Flag)
 
@@ -59,7 +64,7 @@ type (
 
 	// 日志核心实现
 	kernel struct {
-		filter    Level          // 过滤级别，打印级别必须大于等于 filter 才会给予打印，默认 LevelDebug 级别
+		filter    int32          // 过滤级别，打印级别必须大于等于 filter 才会给予打印，默认 LevelDebug 级别，原子读写
 		flag      Flag           // Header 构建标识，默认 FlagDefault
 		depth     int            // 跳过调用深度，默认 3 层
 		formatter Formatter      // 格式化者，将打印的信息格式化，默认为 StringFormatter
@@ -76,12 +81,17 @@ const (
 var (
 	// 默认输出钩子
 	StandardOutputHook = os.Stdout
+
+	// 各级别输出的日志条数
+	metricMessages = metrics.NewCounter("jarvis_log_messages_total", "Log messages printed per level.", "level")
+	// 输出钩子写入失败次数
+	metricWriteErrors = metrics.NewCounter("jarvis_log_write_errors_total", "Log hook write errors.")
 )
 
 // 实例化日志核心
 func NewKernel() Kernel {
 	return &kernel{
-		filter:    LevelDebug,
+		filter:    int32(LevelDebug),
 		flag:      FlagDefault,
 		depth:     DefaultSkipCallDepth,
 		formatter: NewStringFormatter(),
@@ -92,7 +102,8 @@ func NewKernel() Kernel {
 
 // 基础打印
 func (k *kernel) Print(level Level, str string) {
-	if level < k.filter {
+	// 过滤级别可在运行时修改，以原子操作在加锁前判断，被过滤的打印不争用锁
+	if int32(level) < atomic.LoadInt32(&k.filter) {
 		return
 	}
 
@@ -103,6 +114,8 @@ func (k *kernel) Print(level Level, str string) {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
 
+	metricMessages.Inc(level.String())
+
 	// 解锁后再加锁，防止调用堆栈信息占用时间
 	var frames []runtime.Frame
 	if k.flag&(FlagLPath|FlagSPath|FlagLine) != 0 {
@@ -119,16 +132,20 @@ func (k *kernel) Print(level Level, str string) {
 
 	// 输出
 	if k.hook != nil {
-		_, _ = k.hook.Write([]byte(final))
+		if _, err := k.hook.Write([]byte(final)); err != nil {
+			metricWriteErrors.Inc()
+		}
 	}
 }
 
 // 设置过滤层级
 func (k *kernel) SetFilterLevel(level Level) {
-	k.mutex.Lock()
-	defer k.mutex.Unlock()
+	atomic.StoreInt32(&k.filter, int32(level))
+}
 
-	k.filter = level
+// 当前过滤层级
+func (k *kernel) FilterLevel() Level {
+	return Level(atomic.LoadInt32(&k.filter))
 }
 
 // 设置构建标识
@@ -1,6 +1,10 @@
 package log
 
-import "io"
+import (
+	"errors"
+	"io"
+	"strings"
+)
 
 type (
 	Level int // 级别
@@ -31,6 +35,16 @@ const (
 	FlagDefault = FlagTime | FlagSPath | FlagLine // 默认组合
 )
 
+// 此常量组定义了 log 中可能会发生的错误文本
+const (
+	ErrUnknownLevelText = "unknown log level"
+)
+
+var (
+	// 未知日志级别错误
+	ErrUnknownLevel = errors.New(ErrUnknownLevelText)
+)
+
 var (
 	defaultKernel Kernel
 )
@@ -63,11 +77,27 @@ func (l Level) String() string {
 	}
 }
 
+// 将级别名解析为级别，不区分大小写，如 "debug" 、 "WARN"
+func ParseLevel(name string) (Level, error) {
+	for level := LevelAll; level <= LevelOff; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+
+	return LevelOff, ErrUnknownLevel
+}
+
 // 设置过滤层级
 func SetFilterLevel(level Level) {
 	defaultKernel.SetFilterLevel(level)
 }
 
+// 当前过滤层级
+func FilterLevel() Level {
+	return defaultKernel.FilterLevel()
+}
+
 // 设置构建标识
 func SetFlag(flag Flag) {
 	defaultKernel.SetFlag(flag)
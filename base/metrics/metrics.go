@@ -0,0 +1,439 @@
+// metrics 是一个不依赖第三方库的指标登记处，提供计数器、仪表、直方图三种指标，以 Prometheus 文本格式输出
+// 指标以名称唯一，重复登记同名同类型的指标返回已登记的实例，标签值按登记时的标签名顺序传入，数量不一致时忽略此次记录
+// 默认登记处通过包级函数使用，ListenAndServe() 在本地 HTTP 端口的 DefaultPath 路径上暴露指标，供 Prometheus 抓取
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// 指标类型
+	Kind int
+
+	// 计数器定义，只增不减
+	Counter interface {
+		// 加一
+		Inc(labelValues ...string)
+
+		// 增加，v 小于零时忽略
+		Add(v float64, labelValues ...string)
+	}
+
+	// 仪表定义，可增可减
+	Gauge interface {
+		// 设置
+		Set(v float64, labelValues ...string)
+
+		// 加一
+		Inc(labelValues ...string)
+
+		// 减一
+		Dec(labelValues ...string)
+
+		// 增加，v 可以为负数
+		Add(v float64, labelValues ...string)
+	}
+
+	// 直方图定义
+	Histogram interface {
+		// 观测一个值
+		Observe(v float64, labelValues ...string)
+	}
+
+	// 登记处定义
+	Registry interface {
+		// 登记计数器
+		NewCounter(name, help string, labelNames ...string) Counter
+
+		// 登记仪表
+		NewGauge(name, help string, labelNames ...string) Gauge
+
+		// 登记函数仪表，输出时调用 function 取值，重复登记时替换取值函数
+		NewGaugeFunc(name, help string, function func() float64)
+
+		// 登记直方图，buckets 为空时使用 DefaultBuckets
+		NewHistogram(name, help string, buckets []float64, labelNames ...string) Histogram
+
+		// 以 Prometheus 文本格式输出所有指标
+		Write(io.Writer) error
+
+		// HTTP 处理，输出所有指标
+		ServeHTTP(http.ResponseWriter, *http.Request)
+	}
+
+	// 登记处实现
+	registry struct {
+		families map[string]*family // 指标族，map[名称]指标族
+		mutex    sync.Mutex         // 指标族竞态锁
+	}
+
+	// 指标族，同名指标的所有标签组合
+	family struct {
+		name       string             // 名称
+		help       string             // 说明
+		kind       Kind               // 类型
+		labelNames []string           // 标签名
+		buckets    []float64          // 直方图桶上界，升序
+		function   func() float64     // 函数仪表取值函数
+		series     map[string]*series // 序列，map[标签值组合]序列
+		mutex      sync.Mutex         // 序列竞态锁
+	}
+
+	// 序列，一组标签值对应的数值
+	series struct {
+		labelValues []string // 标签值
+		value       float64  // 计数器、仪表的值
+		counts      []uint64 // 直方图各个桶的计数，不累加
+		sum         float64  // 直方图观测值之和
+		count       uint64   // 直方图观测次数
+	}
+)
+
+// 此常量组定义了指标类型
+const (
+	KindCounter   Kind = iota // 计数器
+	KindGauge                 // 仪表
+	KindHistogram             // 直方图
+)
+
+const (
+	// 默认暴露路径
+	DefaultPath = "/metrics"
+	// 输出的内容类型
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// 此常量组定义了 Registry 定义及实现中可能会发生的错误文本
+const (
+	ErrKindConflictText = "metric already registered with another kind"
+)
+
+var (
+	// 同名指标已以其他类型登记错误
+	ErrKindConflict = errors.New(ErrKindConflictText)
+
+	// 默认直方图桶上界，单位秒
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// 默认登记处
+	defaultRegistry = NewRegistry()
+)
+
+// 新建登记处
+func NewRegistry() Registry {
+	return &registry{
+		families: make(map[string]*family),
+		mutex:    sync.Mutex{},
+	}
+}
+
+// 默认登记处
+func DefaultRegistry() Registry {
+	return defaultRegistry
+}
+
+// 指标类型可读化
+func (k Kind) String() string {
+	switch k {
+	case KindCounter:
+		return "counter"
+	case KindGauge:
+		return "gauge"
+	case KindHistogram:
+		return "histogram"
+	default:
+		return "untyped"
+	}
+}
+
+// 登记计数器
+func (r *registry) NewCounter(name, help string, labelNames ...string) Counter {
+	return r.register(name, help, KindCounter, nil, labelNames)
+}
+
+// 登记仪表
+func (r *registry) NewGauge(name, help string, labelNames ...string) Gauge {
+	return r.register(name, help, KindGauge, nil, labelNames)
+}
+
+// 登记函数仪表
+func (r *registry) NewGaugeFunc(name, help string, function func() float64) {
+	f := r.register(name, help, KindGauge, nil, nil)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.function = function
+}
+
+// 登记直方图
+func (r *registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return r.register(name, help, KindHistogram, sorted, labelNames)
+}
+
+// 登记指标族，同名同类型时返回已登记的指标族
+// 同名不同类型属于编码错误，直接 panic
+func (r *registry) register(name, help string, kind Kind, buckets []float64, labelNames []string) *family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if f, exist := r.families[name]; exist {
+		if f.kind != kind {
+			panic(fmt.Sprintf("%s : %s", name, ErrKindConflictText))
+		}
+		return f
+	}
+
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+		mutex:      sync.Mutex{},
+	}
+	r.families[name] = f
+
+	return f
+}
+
+// 以 Prometheus 文本格式输出所有指标
+func (r *registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mutex.Unlock()
+
+	// 按名称排序，保证输出稳定
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// HTTP 处理
+func (r *registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if err := r.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// 计数器加一
+func (f *family) Inc(labelValues ...string) {
+	f.Add(1, labelValues...)
+}
+
+// 计数器、仪表减一
+func (f *family) Dec(labelValues ...string) {
+	f.Add(-1, labelValues...)
+}
+
+// 计数器、仪表增加
+func (f *family) Add(v float64, labelValues ...string) {
+	if f.kind == KindCounter && v < 0 {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if s := f.lookup(labelValues); s != nil {
+		s.value += v
+	}
+}
+
+// 仪表设置
+func (f *family) Set(v float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if s := f.lookup(labelValues); s != nil {
+		s.value = v
+	}
+}
+
+// 直方图观测一个值
+func (f *family) Observe(v float64, labelValues ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	s := f.lookup(labelValues)
+	if s == nil {
+		return
+	}
+
+	// 只记录落入的第一个桶，输出时累加
+	index := sort.SearchFloat64s(f.buckets, v)
+	if index < len(f.buckets) {
+		s.counts[index]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// 查找或新建标签值对应的序列，标签值数量不一致时返回 nil
+// 调用方必须持有 f.mutex
+func (f *family) lookup(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		return nil
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, exist := f.series[key]
+	if !exist {
+		s = &series{
+			labelValues: append([]string(nil), labelValues...),
+		}
+		if f.kind == KindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// 输出指标族
+func (f *family) write(w *bufio.Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	_, _ = fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind.String())
+
+	// 函数仪表
+	if f.function != nil {
+		_, _ = fmt.Fprintf(w, "%s %s\n", f.name, formatValue(f.function()))
+		return
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != KindHistogram {
+			_, _ = fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", formatValue(bound)), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// 格式化标签，extraName 不为空时追加一个额外标签
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// 格式化数值
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// 转义说明中的反斜杠和换行
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// 转义标签值中的反斜杠、双引号和换行
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// ---------------------------------------------------- 默认登记处 -----------------------------------------------------
+// 在默认登记处登记计数器
+func NewCounter(name, help string, labelNames ...string) Counter {
+	return defaultRegistry.NewCounter(name, help, labelNames...)
+}
+
+// 在默认登记处登记仪表
+func NewGauge(name, help string, labelNames ...string) Gauge {
+	return defaultRegistry.NewGauge(name, help, labelNames...)
+}
+
+// 在默认登记处登记函数仪表
+func NewGaugeFunc(name, help string, function func() float64) {
+	defaultRegistry.NewGaugeFunc(name, help, function)
+}
+
+// 在默认登记处登记直方图
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) Histogram {
+	return defaultRegistry.NewHistogram(name, help, buckets, labelNames...)
+}
+
+// 输出默认登记处的所有指标
+func Write(w io.Writer) error {
+	return defaultRegistry.Write(w)
+}
+
+// 默认登记处的 HTTP 处理
+func Handler() http.Handler {
+	return defaultRegistry
+}
+
+// 在 address 上监听 HTTP ，于 DefaultPath 暴露默认登记处的指标，阻塞直到出错
+// 建议只监听本地地址，如 127.0.0.1:9100
+func ListenAndServe(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle(DefaultPath, defaultRegistry)
+
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounter("test_total", "Test counter.", "module", "route")
+	c.Inc("a", "b")
+	c.Add(2, "a", "b")
+	c.Add(-1, "a", "b") // 计数器忽略负数
+	c.Inc("a")          // 标签值数量不一致，忽略
+
+	g := r.NewGauge("test_gauge", "Test gauge.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	r.NewGaugeFunc("test_func", "Test gauge func.", func() float64 { return 7 })
+
+	h := r.NewHistogram("test_seconds", "Test histogram.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, `q"x`)
+	h.Observe(0.5, `q"x`)
+	h.Observe(5, `q"x`)
+
+	// 重复登记返回同一个实例
+	r.NewCounter("test_total", "Test counter.", "module", "route").Inc("a", "b")
+
+	buffer := &bytes.Buffer{}
+	if err := r.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	out := buffer.String()
+
+	for _, want := range []string{
+		"# TYPE test_total counter\ntest_total{module=\"a\",route=\"b\"} 4\n",
+		"# TYPE test_gauge gauge\ntest_gauge 1\n",
+		"test_func 7\n",
+		"test_seconds_bucket{route=\"q\\\"x\",le=\"0.1\"} 1\n",
+		"test_seconds_bucket{route=\"q\\\"x\",le=\"1\"} 2\n",
+		"test_seconds_bucket{route=\"q\\\"x\",le=\"+Inf\"} 3\n",
+		"test_seconds_sum{route=\"q\\\"x\"} 5.55\n",
+		"test_seconds_count{route=\"q\\\"x\"} 3\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// admin 为运行中的 Service 提供运维 HTTP 接口，须显式开启，并监听在与 Gate 不同的地址上
+// 接口均以 JSON 返回，出错时返回 {"error": "..."} 及对应的 HTTP 状态码：
+//
+//	GET  /items                         列出本地所有连接
+//	POST /items/kick?id={id}            踢掉指定连接，包括其他节点上的连接
+//	POST /items/send                    向指定连接发送一条测试消息，body 为 {"id":"","module":"","route":"","data":"","reply":""}
+//	GET  /routes                        列出所有已注册的模块及路由
+//	GET  /log/level                     查看日志过滤级别
+//	POST /log/level?level={level}       修改日志过滤级别，如 debug 、 info
+//
+// 接口本身不做鉴权，请只监听本地地址或内网地址
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"jarvis/base/log"
+	"jarvis/base/network"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type (
+	// 运维接口实现
+	admin struct {
+		service network.Service // 服务
+		mux     *http.ServeMux  // 路由
+	}
+
+	// 连接信息
+	ItemInfo struct {
+		ID            string    `json:"id"`            // 内部唯一标识
+		Gate          string    `json:"gate"`          // 所属入口名
+		RemoteAddr    string    `json:"remote_addr"`   // 对端地址
+		State         string    `json:"state"`         // 状态
+		Authenticated bool      `json:"authenticated"` // 是否已认证
+		ConnectedAt   time.Time `json:"connected_at"`  // 建立时间
+		LastRead      time.Time `json:"last_read"`     // 最后一次读取时间
+		LastWrite     time.Time `json:"last_write"`    // 最后一次写入时间
+		BytesIn       int64     `json:"bytes_in"`      // 读取的字节数
+		BytesOut      int64     `json:"bytes_out"`     // 写入的字节数
+	}
+
+	// 测试消息
+	SendRequest struct {
+		ID     string `json:"id"`     // 目标连接
+		Module string `json:"module"` // 模块名
+		Route  string `json:"route"`  // 路由名
+		Data   string `json:"data"`   // 数据，原样作为 Message.Data
+		Reply  string `json:"reply"`  // 回覆
+	}
+)
+
+// 此常量组定义了运维接口中可能会发生的错误文本
+const (
+	ErrMethodNotAllowedText = "method not allowed"
+	ErrEmptyIDText          = "id is empty"
+)
+
+var (
+	// 请求方法不允许错误
+	ErrMethodNotAllowed = errors.New(ErrMethodNotAllowedText)
+	// id 为空错误
+	ErrEmptyID = errors.New(ErrEmptyIDText)
+)
+
+// 新建运维接口 HTTP 处理，可以挂载在任意 http.ServeMux 上
+func NewHandler(service network.Service) http.Handler {
+	a := &admin{
+		service: service,
+		mux:     http.NewServeMux(),
+	}
+
+	a.mux.HandleFunc("/items", a.method(http.MethodGet, a.items))
+	a.mux.HandleFunc("/items/kick", a.method(http.MethodPost, a.kick))
+	a.mux.HandleFunc("/items/send", a.method(http.MethodPost, a.send))
+	a.mux.HandleFunc("/routes", a.method(http.MethodGet, a.routes))
+	a.mux.HandleFunc("/log/level", a.logLevel)
+
+	return a
+}
+
+// 在 address 上监听运维接口，阻塞直到出错
+func ListenAndServe(address string, service network.Service) error {
+	return http.ListenAndServe(address, NewHandler(service))
+}
+
+// HTTP 处理
+func (a *admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// 限定请求方法
+func (a *admin) method(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// 列出本地所有连接，按建立时间升序
+func (a *admin) items(w http.ResponseWriter, _ *http.Request) {
+	items := a.service.Items()
+	infos := make([]ItemInfo, 0, len(items))
+	for _, i := range items {
+		infos = append(infos, ItemInfo{
+			ID:            i.ID().String(),
+			Gate:          i.Gate(),
+			RemoteAddr:    i.RemoteAddr(),
+			State:         i.State().String(),
+			Authenticated: i.IsAuthenticated(),
+			ConnectedAt:   i.ConnectedAt(),
+			LastRead:      i.LastRead(),
+			LastWrite:     i.LastWrite(),
+			BytesIn:       i.BytesIn(),
+			BytesOut:      i.BytesOut(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// 踢掉指定连接
+func (a *admin) kick(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, ErrEmptyID)
+		return
+	}
+
+	if err := a.service.Kick(id); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	log.InfoF("admin kicked [%s]", id)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+// 向指定连接发送一条测试消息
+func (a *admin) send(w http.ResponseWriter, r *http.Request) {
+	request := SendRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.ID == "" {
+		writeError(w, http.StatusBadRequest, ErrEmptyID)
+		return
+	}
+
+	if err := a.service.SendTo(request.ID, network.Message{
+		Module: request.Module,
+		Route:  request.Route,
+		Data:   []byte(request.Data),
+		Reply:  request.Reply,
+	}); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"id": request.ID})
+}
+
+// 列出所有已注册的模块及路由
+func (a *admin) routes(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.service.Routes())
+}
+
+// 查看或修改日志过滤级别
+func (a *admin) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		level, err := log.ParseLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.SetFilterLevel(level)
+		log.InfoF("admin set log level to %s", level.String())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"level": log.FilterLevel().String()})
+}
+
+// 错误对应的 HTTP 状态码
+func statusOf(err error) int {
+	if err == network.ErrItemUnExist {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+// 以 JSON 返回
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.ErrorF("admin write response error : %s", err.Error())
+	}
+}
+
+// 以 JSON 返回错误
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
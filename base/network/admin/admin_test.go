@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"encoding/json"
+	"jarvis/base/log"
+	"jarvis/base/network"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testModule struct{}
+
+func (testModule) Name() string { return "test" }
+
+func (testModule) Route() map[string][]network.RouteHandleFunc {
+	return map[string][]network.RouteHandleFunc{
+		"echo": {func(ctx network.Context) { _ = ctx.Success(ctx.Request().Data) }},
+	}
+}
+
+// 运行一个带有一个客户端连接的服务
+func runService(t *testing.T) (network.Service, network.Client) {
+	l, err := net.Listen(network.DefaultNetwork, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	s := network.NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(network.NewSocketGate(addr)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Shutdown(nil) })
+	time.Sleep(100 * time.Millisecond)
+
+	c := network.NewSocketClient(addr, network.DefaultPackager(), network.DefaultEncrypter())
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	time.Sleep(50 * time.Millisecond)
+
+	return s, c
+}
+
+// 请求运维接口并以 JSON 解码返回
+func call(t *testing.T, h http.Handler, method, target, body string, v interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s decode %q error : %s", method, target, w.Body.String(), err.Error())
+		}
+	}
+
+	return w.Code
+}
+
+func TestItemsAndRoutes(t *testing.T) {
+	s, _ := runService(t)
+	h := NewHandler(s)
+
+	infos := make([]ItemInfo, 0)
+	if code := call(t, h, http.MethodGet, "/items", "", &infos); code != http.StatusOK {
+		t.Fatalf("items = %d , want %d", code, http.StatusOK)
+	}
+	if len(infos) != 1 || infos[0].ID != s.Items()[0].ID().String() || infos[0].RemoteAddr == "" {
+		t.Fatalf("items = %+v , want the connected client", infos)
+	}
+	if code := call(t, h, http.MethodPost, "/items", "", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("post items = %d , want %d", code, http.StatusMethodNotAllowed)
+	}
+
+	routes := make(map[string][]string)
+	if code := call(t, h, http.MethodGet, "/routes", "", &routes); code != http.StatusOK {
+		t.Fatalf("routes = %d , want %d", code, http.StatusOK)
+	}
+	if len(routes["test"]) != 1 || routes["test"][0] != "echo" {
+		t.Fatalf("routes = %v , want test.echo", routes)
+	}
+}
+
+func TestSendAndKick(t *testing.T) {
+	s, c := runService(t)
+	h := NewHandler(s)
+	id := s.Items()[0].ID().String()
+
+	// 测试消息原样送达客户端
+	body := `{"id":"` + id + `","module":"push","route":"notice","data":"jarvis"}`
+	if code := call(t, h, http.MethodPost, "/items/send", body, nil); code != http.StatusOK {
+		t.Fatalf("send = %d , want %d", code, http.StatusOK)
+	}
+	received := make(chan network.Message, 1)
+	go func() {
+		if message, err := c.Receive(); err == nil {
+			received <- message
+		}
+	}()
+	select {
+	case message := <-received:
+		if message.Module != "push" || message.Route != "notice" || string(message.Data) != "jarvis" {
+			t.Fatalf("received = %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client must receive the test message")
+	}
+
+	errorBody := make(map[string]string)
+	if code := call(t, h, http.MethodPost, "/items/send", `{"module":"push"}`, &errorBody); code != http.StatusBadRequest || errorBody["error"] != ErrEmptyIDText {
+		t.Fatalf("send without id = %d %v , want %d", code, errorBody, http.StatusBadRequest)
+	}
+	if code := call(t, h, http.MethodPost, "/items/send", `{"id":"missing"}`, nil); code != http.StatusNotFound {
+		t.Fatalf("send to missing = %d , want %d", code, http.StatusNotFound)
+	}
+
+	if code := call(t, h, http.MethodPost, "/items/kick", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("kick without id = %d , want %d", code, http.StatusBadRequest)
+	}
+	if code := call(t, h, http.MethodPost, "/items/kick?id=missing", "", nil); code != http.StatusNotFound {
+		t.Fatalf("kick missing = %d , want %d", code, http.StatusNotFound)
+	}
+	if code := call(t, h, http.MethodGet, "/items/kick?id="+id, "", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("get kick = %d , want %d", code, http.StatusMethodNotAllowed)
+	}
+	if code := call(t, h, http.MethodPost, "/items/kick?id="+id, "", nil); code != http.StatusOK {
+		t.Fatalf("kick = %d , want %d", code, http.StatusOK)
+	}
+	if items := s.Items(); len(items) != 0 {
+		t.Fatalf("items after kick = %d , want 0", len(items))
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	h := NewHandler(network.NewService(10, 10))
+	previous := log.FilterLevel()
+	defer log.SetFilterLevel(previous)
+
+	level := make(map[string]string)
+	if code := call(t, h, http.MethodPost, "/log/level?level=debug", "", &level); code != http.StatusOK {
+		t.Fatalf("set level = %d , want %d", code, http.StatusOK)
+	}
+	want, _ := log.ParseLevel("debug")
+	if log.FilterLevel() != want || level["level"] != want.String() {
+		t.Fatalf("level = %v , want %s", level, want.String())
+	}
+	if code := call(t, h, http.MethodGet, "/log/level", "", &level); code != http.StatusOK || level["level"] != want.String() {
+		t.Fatalf("get level = %d %v , want %s", code, level, want.String())
+	}
+
+	if code := call(t, h, http.MethodPost, "/log/level?level=unknown", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("set unknown level = %d , want %d", code, http.StatusBadRequest)
+	}
+	if code := call(t, h, http.MethodDelete, "/log/level", "", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("delete level = %d , want %d", code, http.StatusMethodNotAllowed)
+	}
+	if log.FilterLevel() != want {
+		t.Fatal("rejected requests must not change the level")
+	}
+}
@@ -0,0 +1,53 @@
+// Authenticator 定义了连接建立后、路由分发前的认证阶段
+// Service 设置了 Authenticator 后，未认证的 Item 发送的消息只会交由 Authenticator 认证，其他路由一律回复未认证 Reply
+// AuthOption 指定了握手路由时，只有发往握手路由的消息会进行认证，否则未认证前的每一条消息都会进行认证
+// 未指定握手路由时，一次性连接（OneShotConn，例如 HTTPGate 的请求）的唯一请求在认证成功后继续路由，响应为路由的回覆而不是认证成功 Reply
+// 认证成功后 Authenticator 返回的认证主体保存于 Item ，之后的调用链中可以通过 Context.Principal() 读取
+// 认证失败达到 AuthOption.Attempts 次，或连接建立后超过 AuthOption.Timeout 仍未认证成功，Item 以 ItemStateUnauthorizedClose 状态关闭
+package network
+
+import "time"
+
+type (
+	// 认证者定义
+	Authenticator interface {
+		// 认证，返回认证主体，error 不为 nil 时认证失败
+		// 认证成功时框架回复成功 Reply ，失败时回复未认证 Reply ，因此认证者无需自行回复
+		Authenticate(Context) (interface{}, error)
+	}
+
+	// 认证函数，实现了 Authenticator
+	AuthenticatorFunc func(Context) (interface{}, error)
+
+	// 认证选项
+	AuthOption struct {
+		Module   string        // 握手模块名，为空时未认证前的每一条消息都会进行认证
+		Route    string        // 握手路由名
+		Attempts int           // 允许的认证失败次数，小于等于零时为默认值 3
+		Timeout  time.Duration // 连接建立后必须在此时间内认证成功，小于等于零时不限制
+	}
+)
+
+const (
+	// 默认允许的认证失败次数
+	DefaultAuthAttempts = 3
+)
+
+// 认证
+func (f AuthenticatorFunc) Authenticate(ctx Context) (interface{}, error) {
+	return f(ctx)
+}
+
+// 是否为握手消息
+func (ao AuthOption) isHandshake(message Message) bool {
+	return ao.Module != "" && message.Module == ao.Module && message.Route == ao.Route
+}
+
+// 允许的认证失败次数
+func (ao AuthOption) attempts() int {
+	if ao.Attempts <= 0 {
+		return DefaultAuthAttempts
+	}
+
+	return ao.Attempts
+}
@@ -0,0 +1,67 @@
+package network
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuthenticator(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	authenticator := AuthenticatorFunc(func(ctx Context) (interface{}, error) {
+		if string(ctx.Request().Data) != "secret" {
+			return nil, errors.New("wrong secret")
+		}
+		return "frank", nil
+	})
+	if err := s.SetAuthenticator(authenticator, AuthOption{Module: "auth", Route: "login", Attempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(addr))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 认证前只有握手路由会进行认证
+	if reply := requestReply(t, c, "test", "echo", []byte("jarvis")); reply.Code != ReplyUnauthorizedCode {
+		t.Fatalf("echo before login = %d , want %d", reply.Code, ReplyUnauthorizedCode)
+	}
+	if reply := requestReply(t, c, "auth", "login", []byte("wrong")); reply.Code != ReplyUnauthorizedCode {
+		t.Fatalf("wrong login = %d , want %d", reply.Code, ReplyUnauthorizedCode)
+	}
+	if reply := requestReply(t, c, "auth", "login", []byte("secret")); reply.Code != ReplySuccessCode {
+		t.Fatalf("login = %d , want %d", reply.Code, ReplySuccessCode)
+	}
+	if reply := requestReply(t, c, "test", "echo", []byte("jarvis")); reply.Code != ReplySuccessCode || string(reply.Data) != "jarvis" {
+		t.Fatalf("echo after login = %+v", reply)
+	}
+	items := s.Items()
+	if len(items) != 1 || !items[0].IsAuthenticated() || items[0].Principal() != "frank" {
+		t.Fatal("item must keep the principal after login")
+	}
+
+	// 认证失败达到次数后关闭
+	failed := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := failed.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if reply := requestReply(t, failed, "auth", "login", []byte("wrong")); reply.Code != ReplyUnauthorizedCode {
+		t.Fatalf("wrong login = %d , want %d", reply.Code, ReplyUnauthorizedCode)
+	}
+	// 服务端关闭连接后客户端自行关闭，最后一次只发送，不再使用该客户端
+	if err := failed.Send(Message{Module: "auth", Route: "login", Data: []byte("wrong")}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if items := s.Items(); len(items) != 1 || items[0].Principal() != "frank" {
+		t.Fatalf("items = %d , want only the authenticated item", len(items))
+	}
+}
@@ -2,13 +2,17 @@ package network
 
 import (
 	oContext "context"
+	"crypto/tls"
 	"errors"
 	"github.com/gorilla/websocket"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"jarvis/base/log"
 	gRPC "jarvis/base/network/grpc"
+	uTime "jarvis/util/time"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +36,24 @@ type (
 
 		// 同步请求
 		RequestSync(Message) (Message, error)
+
+		// 设置心跳，默认为 DefaultHeartbeat() ，Interval 小于等于零时不发送心跳，此函数必须在 Initialize() 前调用
+		SetHeartbeat(Heartbeat) error
+
+		// 设置编解码器，默认为 JSONCodec() ，其他编解码器在 Initialize() 中与服务端协商，此函数必须在 Initialize() 前调用
+		// 二进制编解码器需要能够还原任意字节的加密器，否则返回 ErrEncrypterNotByteSafe
+		SetCodec(Codec) error
+
+		// 当前使用的编解码器，用于解码 Reply 及业务数据
+		Codec() Codec
+
+		// 设置压缩器及压缩阈值，按偏好顺序在 Initialize() 中与服务端协商，阈值小于等于零时为 DefaultCompressThreshold
+		// 压缩需要能够还原任意字节的加密器，否则返回 ErrEncrypterNotByteSafe ，此函数必须在 Initialize() 前调用
+		SetCompression(int, ...Compressor) error
+
+		// 设置 TLS ，以 TLSOption.ClientConfig() 生成配置，WebSocket 客户端地址需要以 wss:// 开头
+		// 此函数必须在 Initialize() 前调用
+		SetTLS(TLSOption) error
 	}
 
 	// 基础客户端结构
@@ -42,13 +64,24 @@ type (
 		address     string
 		p           Packager
 		e           Encrypter
-		closed      bool
+		closed      int32        // 是否已关闭，原子读写
+		heartbeat   Heartbeat    // 心跳
+		codec       Codec        // 设置的编解码器
+		active      Codec        // 当前使用的编解码器，协商成功后切换为 codec
+		compressors []Compressor // 设置的压缩器，按偏好顺序排列
+		compressor  Compressor   // 当前使用的压缩器，协商成功后切换，为 nil 时不压缩
+		threshold   int          // 压缩阈值
+		pipeMutex   sync.RWMutex // 编解码器及压缩器竞态锁
+		exchanger   KeyExchanger // 加密器需要密钥交换时不为 nil
+		ready       chan error   // 密钥交换结果
+		tlsConfig   *tls.Config  // TLS 配置，为 nil 时不使用 TLS
 	}
 
-	// socket 客户端结构
+	// socket 客户端结构，同时用于 unix 域套接字及 UDP
 	socketClient struct {
 		baseClient
-		c Conn // 连接
+		network string // 网络类型
+		c       Conn   // 连接
 	}
 
 	// webSocket 客户端结构
@@ -90,7 +123,14 @@ var (
 )
 
 // 新建基础客户端
+// 加密器需要密钥交换时，在 Initialize() 中完成握手后才能发送消息
 func newBaseClient(address string, packager Packager, encrypter Encrypter) baseClient {
+	exchanger, _ := encrypter.(KeyExchanger)
+	var ready chan error
+	if exchanger != nil {
+		ready = make(chan error, 1)
+	}
+
 	return baseClient{
 		routeMap:    make(map[string]chan Message),
 		mutex:       sync.Mutex{},
@@ -98,7 +138,16 @@ func newBaseClient(address string, packager Packager, encrypter Encrypter) baseC
 		address:     address,
 		p:           packager,
 		e:           encrypter,
-		closed:      false,
+		heartbeat:   DefaultHeartbeat(),
+		codec:       JSONCodec(),
+		active:      JSONCodec(),
+		compressors: nil,
+		compressor:  nil,
+		threshold:   DefaultCompressThreshold,
+		pipeMutex:   sync.RWMutex{},
+		exchanger:   exchanger,
+		ready:       ready,
+		tlsConfig:   nil,
 	}
 }
 
@@ -106,6 +155,26 @@ func newBaseClient(address string, packager Packager, encrypter Encrypter) baseC
 func NewSocketClient(address string, packager Packager, encrypter Encrypter) Client {
 	return &socketClient{
 		baseClient: newBaseClient(address, packager, encrypter),
+		network:    DefaultNetwork,
+		c:          nil,
+	}
+}
+
+// 新建 unix 域套接字客户端，连接 NewUnixGate() 监听的套接字文件
+func NewUnixClient(path string, packager Packager, encrypter Encrypter) Client {
+	return &socketClient{
+		baseClient: newBaseClient(path, packager, encrypter),
+		network:    UnixNetwork,
+		c:          nil,
+	}
+}
+
+// 新建 UDP 客户端，连接 NewUDPGate() 监听的地址
+// 每个数据帧以一个数据报发送，不保证送达及顺序，不支持 TLS
+func NewUDPClient(address string, packager Packager, encrypter Encrypter) Client {
+	return &socketClient{
+		baseClient: newBaseClient(address, packager, encrypter),
+		network:    UDPNetwork,
 		c:          nil,
 	}
 }
@@ -130,7 +199,7 @@ func NewGRPCClient(address string, packager Packager, encrypter Encrypter) Clien
 // -------------------------------------------------- Base Client ------------------------------------------------------
 // 添加一条临时路由
 func (bc *baseClient) AddRoute(route string, channel chan Message) error {
-	if bc.closed {
+	if bc.isClosed() {
 		return ErrClientAlreadyClosed
 	}
 	if route == "" {
@@ -153,7 +222,7 @@ func (bc *baseClient) AddRoute(route string, channel chan Message) error {
 
 // 移除一条临时路由
 func (bc *baseClient) RemoveRoute(route string) error {
-	if bc.closed {
+	if bc.isClosed() {
 		return ErrClientAlreadyClosed
 	}
 	if route == "" {
@@ -174,7 +243,7 @@ func (bc *baseClient) RemoveRoute(route string) error {
 
 // 将消息路由到对应的回复管道，并移除记录
 func (bc *baseClient) Route(message Message) error {
-	if bc.closed {
+	if bc.isClosed() {
 		return ErrClientAlreadyClosed
 	}
 	if message.Reply == "" {
@@ -198,20 +267,322 @@ func (bc *baseClient) Route(message Message) error {
 	return nil
 }
 
+// 设置心跳
+func (bc *baseClient) SetHeartbeat(heartbeat Heartbeat) error {
+	if bc.isClosed() {
+		return ErrClientAlreadyClosed
+	}
+
+	bc.heartbeat = heartbeat
+	return nil
+}
+
+// 设置编解码器
+func (bc *baseClient) SetCodec(codec Codec) error {
+	if bc.isClosed() {
+		return ErrClientAlreadyClosed
+	}
+	if codec == nil {
+		return ErrNilCodec
+	}
+	if codec.Name() != CodecJSON && !byteSafe(bc.e) {
+		return ErrEncrypterNotByteSafe
+	}
+
+	bc.codec = codec
+	return nil
+}
+
+// 设置压缩器及压缩阈值
+func (bc *baseClient) SetCompression(threshold int, compressors ...Compressor) error {
+	if bc.isClosed() {
+		return ErrClientAlreadyClosed
+	}
+	for _, compressor := range compressors {
+		if compressor == nil {
+			return ErrNilCompressor
+		}
+	}
+	if len(compressors) != 0 && !byteSafe(bc.e) {
+		return ErrEncrypterNotByteSafe
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+
+	bc.compressors = compressors
+	bc.threshold = threshold
+	return nil
+}
+
+// 设置 TLS
+func (bc *baseClient) SetTLS(option TLSOption) error {
+	if bc.isClosed() {
+		return ErrClientAlreadyClosed
+	}
+
+	config, err := option.ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	bc.tlsConfig = config
+	return nil
+}
+
+// 当前使用的编解码器
+func (bc *baseClient) Codec() Codec {
+	bc.pipeMutex.RLock()
+	defer bc.pipeMutex.RUnlock()
+	return bc.active
+}
+
+// 将消息以当前编解码器序列化、压缩、加密、打包为可直接写入的数据帧
+func (bc *baseClient) frame(message Message) ([]byte, error) {
+	if bc.exchanger != nil && !bc.exchanger.Ready() {
+		return nil, ErrHandshakeIncomplete
+	}
+
+	bc.pipeMutex.RLock()
+	codec, compressor := bc.active, bc.compressor
+	bc.pipeMutex.RUnlock()
+
+	data, err := codec.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	data, compressed, err := compress(compressor, bc.threshold, data, hasFlags(bc.p))
+	if err != nil {
+		return nil, err
+	}
+	flags := messageFlags(bc.heartbeat, message)
+	if compressed {
+		flags |= FrameFlagCompressed
+	}
+	if bc.exchanger != nil {
+		flags |= FrameFlagEncrypted
+	}
+
+	return pack(bc.p, bc.e.Encrypt(data), flags), nil
+}
+
+// 发送本端握手数据，必须在读取线程启动前调用，保证收到对端握手数据时本端密钥对已经生成
+func (bc *baseClient) hello(write func([]byte) error) error {
+	if bc.exchanger == nil {
+		return nil
+	}
+
+	hello, err := bc.exchanger.Hello()
+	if err != nil {
+		return err
+	}
+
+	return write(pack(bc.p, hello, FrameFlagHandshake))
+}
+
+// 等待密钥交换完成
+func (bc *baseClient) awaitHandshake() error {
+	if bc.exchanger == nil {
+		return nil
+	}
+
+	select {
+	case err := <-bc.ready:
+		return err
+	case <-time.After(DefaultTimeout):
+		return ErrTimeout
+	}
+}
+
+// 通知密钥交换结果，只有第一次通知有效
+func (bc *baseClient) handshakeDone(err error) {
+	select {
+	case bc.ready <- err:
+	default:
+	}
+}
+
+// 解密数据帧，密钥交换握手未完成时作为对端握手数据处理，返回是否为握手数据
+// 返回的错误为握手失败、标志位不符或会话密钥解密失败，应当关闭连接
+func (bc *baseClient) open(frame Frame) ([]byte, bool, error) {
+	flagged := hasFlags(bc.p)
+	if bc.exchanger != nil && !bc.exchanger.Ready() {
+		err := ErrFrameFlags
+		if !flagged || frame.Flags.Has(FrameFlagHandshake) {
+			err = bc.exchanger.Exchange(frame.Data)
+		}
+		bc.handshakeDone(err)
+		return nil, true, err
+	}
+
+	// 握手完成后的数据帧不能带有握手标志，会话密钥加密时必须带有加密标志
+	if flagged && (frame.Flags.Has(FrameFlagHandshake) || frame.Flags.Has(FrameFlagEncrypted) != (bc.exchanger != nil)) {
+		return nil, false, ErrFrameFlags
+	}
+	if bc.exchanger == nil {
+		return bc.e.Decrypt(frame.Data), false, nil
+	}
+
+	plain := bc.e.Decrypt(frame.Data)
+	if plain == nil {
+		return nil, false, ErrDecryptFailed
+	}
+
+	return plain, false, nil
+}
+
+// 以当前编解码器及压缩器反序列化消息，收到同意切换的协商回复时切换编解码器或压缩器
+// 在读取线程内切换，保证之后的数据帧以新的编解码器及压缩器反序列化
+func (bc *baseClient) unmarshal(data []byte, flags FrameFlag) (Message, error) {
+	bc.pipeMutex.RLock()
+	codec, compressor := bc.active, bc.compressor
+	bc.pipeMutex.RUnlock()
+
+	message := Message{}
+	data, err := decompress(compressor, data, flags, hasFlags(bc.p))
+	if err != nil {
+		return message, err
+	}
+	if err := codec.Unmarshal(data, &message); err != nil {
+		return message, err
+	}
+
+	if isNegotiate(message) && message.Reply == CodecNegotiateReply && string(message.Data) == bc.codec.Name() {
+		bc.pipeMutex.Lock()
+		bc.active = bc.codec
+		bc.pipeMutex.Unlock()
+	}
+	if isCompressNegotiate(message) && message.Reply == CompressNegotiateReply {
+		for _, c := range bc.compressors {
+			if c.Name() == string(message.Data) {
+				bc.pipeMutex.Lock()
+				bc.compressor = c
+				bc.pipeMutex.Unlock()
+				break
+			}
+		}
+	}
+
+	return message, nil
+}
+
+// 与服务端协商编解码器，设置的编解码器为 JSONCodec() 时不需要协商
+func (bc *baseClient) negotiate(requestSync func(Message) (Message, error)) error {
+	if bc.codec.Name() == CodecJSON {
+		return nil
+	}
+
+	response, err := requestSync(negotiateMessage(bc.codec.Name()))
+	if err != nil {
+		return err
+	}
+	if string(response.Data) != bc.codec.Name() {
+		return ErrCodecUnsupported
+	}
+
+	return nil
+}
+
+// 与服务端协商压缩器，未设置压缩器时不需要协商，没有共同支持的压缩器时不压缩
+func (bc *baseClient) negotiateCompression(requestSync func(Message) (Message, error)) error {
+	if len(bc.compressors) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(bc.compressors))
+	for _, compressor := range bc.compressors {
+		names = append(names, compressor.Name())
+	}
+
+	response, err := requestSync(compressNegotiateMessage(names))
+	if err != nil {
+		return err
+	}
+	if len(response.Data) == 0 {
+		log.WarnF("no compressor in %v supported by server, compression disabled", names)
+	}
+
+	return nil
+}
+
+// 是否已关闭
+func (bc *baseClient) isClosed() bool {
+	return atomic.LoadInt32(&bc.closed) == 1
+}
+
+// 标记为已关闭，已经关闭时返回 false
+func (bc *baseClient) markClosed() bool {
+	return atomic.CompareAndSwapInt32(&bc.closed, 0, 1)
+}
+
+// 按心跳间隔发送 ping ，客户端关闭或发送失败时停止
+func (bc *baseClient) keepAlive(send func(Message) error) {
+	if bc.heartbeat.Interval <= 0 {
+		return
+	}
+
+	uTime.NewTicker(bc.heartbeat.Interval, func(time.Time) bool {
+		if bc.isClosed() {
+			return false
+		}
+
+		if err := send(bc.heartbeat.PingMessage()); err != nil {
+			log.ErrorF("send heartbeat error : %s", err.Error())
+			return false
+		}
+
+		return true
+	}).Run()
+}
+
 // -------------------------------------------------- Socket Client ----------------------------------------------------
 // 初始化
 func (sc *socketClient) Initialize() error {
-	if sc.baseClient.closed {
+	if sc.baseClient.isClosed() {
 		return ErrClientAlreadyClosed
 	}
-	c, err := net.Dial(DefaultNetwork, sc.baseClient.address)
+	if sc.network == UDPNetwork && sc.baseClient.tlsConfig != nil {
+		return ErrUDPTLS
+	}
+
+	var c net.Conn
+	var err error
+	if sc.baseClient.tlsConfig != nil {
+		c, err = tls.Dial(sc.network, sc.baseClient.address, sc.baseClient.tlsConfig)
+	} else {
+		c, err = net.Dial(sc.network, sc.baseClient.address)
+	}
 	if err != nil {
 		return err
 	}
 
-	sc.c = NewSocketConn(c)
+	// UDP 每次读取一个完整的数据报
+	if sc.network == UDPNetwork {
+		sc.c = newSocketConn(c, MaxDatagramSize)
+	} else {
+		sc.c = NewSocketConn(c)
+	}
+
+	if err := sc.baseClient.hello(sc.c.Write); err != nil {
+		_ = sc.Close()
+		return err
+	}
 
 	go sc.run()
+	if err := sc.baseClient.awaitHandshake(); err != nil {
+		_ = sc.Close()
+		return err
+	}
+	if err := sc.baseClient.negotiate(sc.RequestSync); err != nil {
+		_ = sc.Close()
+		return err
+	}
+	if err := sc.baseClient.negotiateCompression(sc.RequestSync); err != nil {
+		_ = sc.Close()
+		return err
+	}
+	sc.baseClient.keepAlive(sc.Send)
 
 	return nil
 }
@@ -228,7 +599,7 @@ func (sc *socketClient) RegisterReply(route string, function func(Message)) erro
 
 // 接收
 func (sc *socketClient) Receive() (Message, error) {
-	if sc.baseClient.closed {
+	if sc.baseClient.isClosed() {
 		return Message{}, ErrClientAlreadyClosed
 	}
 	message, ok := <-sc.baseClient.receiveChan
@@ -241,23 +612,22 @@ func (sc *socketClient) Receive() (Message, error) {
 
 // 发送
 func (sc *socketClient) Send(message Message) error {
-	if sc.baseClient.closed {
+	if sc.baseClient.isClosed() {
 		return ErrClientAlreadyClosed
 	}
-	data, err := message.Marshal()
+	frame, err := sc.baseClient.frame(message)
 	if err != nil {
 		return err
 	}
 
-	return sc.c.Write(sc.baseClient.p.Pack(sc.baseClient.e.Encrypt(data)))
+	return sc.c.Write(frame)
 }
 
 // 关闭
 func (sc *socketClient) Close() error {
-	if sc.baseClient.closed {
+	if !sc.baseClient.markClosed() {
 		return ErrClientAlreadyClosed
 	}
-	sc.baseClient.closed = true
 	close(sc.baseClient.receiveChan)
 	sc.baseClient.receiveChan = nil
 
@@ -266,7 +636,7 @@ func (sc *socketClient) Close() error {
 
 // 同步请求
 func (sc *socketClient) RequestSync(request Message) (Message, error) {
-	if sc.baseClient.closed {
+	if sc.baseClient.isClosed() {
 		return Message{}, ErrClientAlreadyClosed
 	}
 
@@ -298,19 +668,34 @@ func (sc *socketClient) run() {
 		d, err := sc.c.Read()
 		if err != nil {
 			e = err
-			if sc.baseClient.closed {
+			if sc.baseClient.isClosed() {
 				e = nil
 			}
 			break
 		}
 
-		for _, data := range sc.baseClient.p.Unpack(d) {
-			response := Message{}
-			if err := response.Unmarshal(sc.baseClient.e.Decrypt(data)); err != nil {
+		frames, err := unpack(sc.baseClient.p, d)
+		for _, frame := range frames {
+			plain, handshake, oErr := sc.baseClient.open(frame)
+			if oErr != nil {
+				err = oErr
+				break
+			}
+			if handshake {
+				continue
+			}
+
+			response, err := sc.baseClient.unmarshal(plain, frame.Flags)
+			if err != nil {
 				log.ErrorF("Socket unmarshal data error : %s", err.Error())
 				continue
 			}
 
+			// 心跳 pong 及其他带心跳标志位的数据帧不进入接收管道
+			if sc.baseClient.heartbeat.IsPong(response) || frame.Flags.Has(FrameFlagHeartbeat) {
+				continue
+			}
+
 			if response.Reply == "" {
 				sc.baseClient.receiveChan <- response
 			} else {
@@ -319,7 +704,14 @@ func (sc *socketClient) run() {
 				}
 			}
 		}
+
+		// 装包者出现致命错误、握手失败或解密失败时关闭连接
+		if err != nil {
+			e = err
+			break
+		}
 	}
+	sc.baseClient.handshakeDone(ErrHandshakeIncomplete)
 
 	if e != nil {
 		log.ErrorF("Socket  read error : %s", e.Error())
@@ -333,18 +725,39 @@ func (sc *socketClient) run() {
 // -------------------------------------------------- WebSocket Client -------------------------------------------------
 // 初始化
 func (wsc *webSocketClient) Initialize() error {
-	if wsc.baseClient.closed {
+	if wsc.baseClient.isClosed() {
 		return ErrClientAlreadyClosed
 	}
 
-	c, _, err := websocket.DefaultDialer.Dial(wsc.baseClient.address, nil)
+	// 复制默认拨号器，wss:// 地址使用设置的 TLS 配置
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = wsc.baseClient.tlsConfig
+	c, _, err := dialer.Dial(wsc.baseClient.address, nil)
 	if err != nil {
 		return err
 	}
 
 	wsc.c = NewWebSocketConn(c)
 
+	if err := wsc.baseClient.hello(wsc.c.Write); err != nil {
+		_ = wsc.Close()
+		return err
+	}
+
 	go wsc.run()
+	if err := wsc.baseClient.awaitHandshake(); err != nil {
+		_ = wsc.Close()
+		return err
+	}
+	if err := wsc.baseClient.negotiate(wsc.RequestSync); err != nil {
+		_ = wsc.Close()
+		return err
+	}
+	if err := wsc.baseClient.negotiateCompression(wsc.RequestSync); err != nil {
+		_ = wsc.Close()
+		return err
+	}
+	wsc.baseClient.keepAlive(wsc.Send)
 
 	return nil
 }
@@ -361,7 +774,7 @@ func (wsc *webSocketClient) RegisterReply(route string, function func(Message))
 
 // 接收
 func (wsc *webSocketClient) Receive() (Message, error) {
-	if wsc.baseClient.closed {
+	if wsc.baseClient.isClosed() {
 		return Message{}, ErrClientAlreadyClosed
 	}
 	message, ok := <-wsc.baseClient.receiveChan
@@ -374,23 +787,22 @@ func (wsc *webSocketClient) Receive() (Message, error) {
 
 // 发送
 func (wsc *webSocketClient) Send(message Message) error {
-	if wsc.baseClient.closed {
+	if wsc.baseClient.isClosed() {
 		return ErrClientAlreadyClosed
 	}
-	data, err := message.Marshal()
+	frame, err := wsc.baseClient.frame(message)
 	if err != nil {
 		return err
 	}
 
-	return wsc.c.Write(wsc.baseClient.p.Pack(wsc.baseClient.e.Encrypt(data)))
+	return wsc.c.Write(frame)
 }
 
 // 关闭
 func (wsc *webSocketClient) Close() error {
-	if wsc.baseClient.closed {
+	if !wsc.baseClient.markClosed() {
 		return ErrClientAlreadyClosed
 	}
-	wsc.baseClient.closed = true
 	close(wsc.baseClient.receiveChan)
 	wsc.baseClient.receiveChan = nil
 
@@ -399,7 +811,7 @@ func (wsc *webSocketClient) Close() error {
 
 // 同步请求
 func (wsc *webSocketClient) RequestSync(request Message) (Message, error) {
-	if wsc.baseClient.closed {
+	if wsc.baseClient.isClosed() {
 		return Message{}, ErrClientAlreadyClosed
 	}
 
@@ -431,19 +843,34 @@ func (wsc *webSocketClient) run() {
 		d, err := wsc.c.Read()
 		if err != nil {
 			e = err
-			if wsc.baseClient.closed {
+			if wsc.baseClient.isClosed() {
 				e = nil
 			}
 			break
 		}
 
-		for _, data := range wsc.baseClient.p.Unpack(d) {
-			response := Message{}
-			if err := response.Unmarshal(wsc.baseClient.e.Decrypt(data)); err != nil {
+		frames, err := unpack(wsc.baseClient.p, d)
+		for _, frame := range frames {
+			plain, handshake, oErr := wsc.baseClient.open(frame)
+			if oErr != nil {
+				err = oErr
+				break
+			}
+			if handshake {
+				continue
+			}
+
+			response, err := wsc.baseClient.unmarshal(plain, frame.Flags)
+			if err != nil {
 				log.ErrorF("WebSocket unmarshal data error : %s", err.Error())
 				continue
 			}
 
+			// 心跳 pong 及其他带心跳标志位的数据帧不进入接收管道
+			if wsc.baseClient.heartbeat.IsPong(response) || frame.Flags.Has(FrameFlagHeartbeat) {
+				continue
+			}
+
 			if response.Reply == "" {
 				wsc.baseClient.receiveChan <- response
 			} else {
@@ -453,7 +880,14 @@ func (wsc *webSocketClient) run() {
 				}
 			}
 		}
+
+		// 装包者出现致命错误、握手失败或解密失败时关闭连接
+		if err != nil {
+			e = err
+			break
+		}
 	}
+	wsc.baseClient.handshakeDone(ErrHandshakeIncomplete)
 
 	if e != nil {
 		log.ErrorF("Socket  read error : %s", e.Error())
@@ -467,11 +901,15 @@ func (wsc *webSocketClient) run() {
 // -------------------------------------------------- gRPC Client ------------------------------------------------------
 // 初始化
 func (gc *gRPCClient) Initialize() error {
-	if gc.baseClient.closed {
+	if gc.baseClient.isClosed() {
 		return ErrClientAlreadyClosed
 	}
 
-	cc, err := grpc.Dial(gc.baseClient.address, grpc.WithInsecure(), grpc.WithBlock())
+	security := grpc.WithInsecure()
+	if gc.baseClient.tlsConfig != nil {
+		security = grpc.WithTransportCredentials(credentials.NewTLS(gc.baseClient.tlsConfig))
+	}
+	cc, err := grpc.Dial(gc.baseClient.address, security, grpc.WithBlock())
 	if err != nil {
 		return err
 	}
@@ -485,7 +923,25 @@ func (gc *gRPCClient) Initialize() error {
 	gc.cc = cc
 	gc.ccc = ccc
 
+	if err := gc.baseClient.hello(gc.sendFrame); err != nil {
+		_ = gc.Close()
+		return err
+	}
+
 	go gc.run()
+	if err := gc.baseClient.awaitHandshake(); err != nil {
+		_ = gc.Close()
+		return err
+	}
+	if err := gc.baseClient.negotiate(gc.RequestSync); err != nil {
+		_ = gc.Close()
+		return err
+	}
+	if err := gc.baseClient.negotiateCompression(gc.RequestSync); err != nil {
+		_ = gc.Close()
+		return err
+	}
+	gc.baseClient.keepAlive(gc.Send)
 
 	return nil
 }
@@ -502,7 +958,7 @@ func (gc *gRPCClient) RegisterReply(route string, function func(Message)) error
 
 // 接收
 func (gc *gRPCClient) Receive() (Message, error) {
-	if gc.baseClient.closed {
+	if gc.baseClient.isClosed() {
 		return Message{}, ErrClientAlreadyClosed
 	}
 	message, ok := <-gc.baseClient.receiveChan
@@ -515,23 +971,27 @@ func (gc *gRPCClient) Receive() (Message, error) {
 
 // 发送
 func (gc *gRPCClient) Send(message Message) error {
-	if gc.baseClient.closed {
+	if gc.baseClient.isClosed() {
 		return ErrClientAlreadyClosed
 	}
-	data, err := message.Marshal()
+	frame, err := gc.baseClient.frame(message)
 	if err != nil {
 		return err
 	}
 
-	return gc.ccc.Send(&gRPC.Message{Data: gc.baseClient.p.Pack(gc.baseClient.e.Encrypt(data))})
+	return gc.sendFrame(frame)
+}
+
+// 写入数据帧
+func (gc *gRPCClient) sendFrame(frame []byte) error {
+	return gc.ccc.Send(&gRPC.Message{Data: frame})
 }
 
 // 关闭
 func (gc *gRPCClient) Close() error {
-	if gc.baseClient.closed {
+	if !gc.baseClient.markClosed() {
 		return ErrClientAlreadyClosed
 	}
-	gc.baseClient.closed = true
 	close(gc.baseClient.receiveChan)
 	gc.baseClient.receiveChan = nil
 
@@ -544,7 +1004,7 @@ func (gc *gRPCClient) Close() error {
 
 // 同步请求
 func (gc *gRPCClient) RequestSync(request Message) (Message, error) {
-	if gc.baseClient.closed {
+	if gc.baseClient.isClosed() {
 		return Message{}, ErrClientAlreadyClosed
 	}
 
@@ -576,19 +1036,34 @@ func (gc *gRPCClient) run() {
 		d, err := gc.ccc.Recv()
 		if err != nil {
 			e = err
-			if gc.baseClient.closed {
+			if gc.baseClient.isClosed() {
 				e = nil
 			}
 			break
 		}
 
-		for _, data := range gc.baseClient.p.Unpack(d.Data) {
-			response := Message{}
-			if err := response.Unmarshal(gc.baseClient.e.Decrypt(data)); err != nil {
+		frames, err := unpack(gc.baseClient.p, d.Data)
+		for _, frame := range frames {
+			plain, handshake, oErr := gc.baseClient.open(frame)
+			if oErr != nil {
+				err = oErr
+				break
+			}
+			if handshake {
+				continue
+			}
+
+			response, err := gc.baseClient.unmarshal(plain, frame.Flags)
+			if err != nil {
 				log.ErrorF("gRPC unmarshal data error : %s", err.Error())
 				continue
 			}
 
+			// 心跳 pong 及其他带心跳标志位的数据帧不进入接收管道
+			if gc.baseClient.heartbeat.IsPong(response) || frame.Flags.Has(FrameFlagHeartbeat) {
+				continue
+			}
+
 			if response.Reply == "" {
 				gc.baseClient.receiveChan <- response
 			} else {
@@ -598,7 +1073,14 @@ func (gc *gRPCClient) run() {
 				}
 			}
 		}
+
+		// 装包者出现致命错误、握手失败或解密失败时关闭连接
+		if err != nil {
+			e = err
+			break
+		}
 	}
+	gc.baseClient.handshakeDone(ErrHandshakeIncomplete)
 
 	if e != nil {
 		log.ErrorF("Socket  read error : %s", e.Error())
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientCloseConcurrently(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(addr))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	heartbeat := DefaultHeartbeat()
+	heartbeat.Interval = time.Millisecond
+	if err := c.SetHeartbeat(heartbeat); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// 心跳协程、路由操作与关闭同时进行，关闭状态只能生效一次
+	wg := sync.WaitGroup{}
+	closed := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = c.(*socketClient).RemoveRoute("echo")
+		}()
+		go func() {
+			defer wg.Done()
+			closed <- c.Close()
+		}()
+	}
+	wg.Wait()
+
+	if first, second := <-closed, <-closed; (first == nil) == (second == nil) {
+		t.Fatalf("close = %v , %v , want exactly one success", first, second)
+	}
+	if err := c.Close(); err != ErrClientAlreadyClosed {
+		t.Fatalf("close = %v , want %v", err, ErrClientAlreadyClosed)
+	}
+}
@@ -0,0 +1,165 @@
+// Cluster 定义了多个 jarvis 节点之间的消息投递，使连接在任意节点上都可以被找到
+// Cluster 维护 连接 id -> 节点、用户键 -> 连接 id -> 节点 的注册表，并为每个节点提供一个投递通道
+// Cluster 的投递函数只负责其他节点，本地投递由 Manager 完成，投递者优先本地投递，本地不存在时才交由 Cluster
+// 其他节点投递到本节点的指令经由 ClusterHandler 交回 Service 处理
+// 实现位于 jarvis/base/network/cluster
+package network
+
+import "jarvis/base/log"
+
+type (
+	// 集群定义
+	Cluster interface {
+		// 节点标识
+		Node() string
+
+		// 启动，开始接收其他节点的投递，并交由 ClusterHandler 处理
+		Start(ClusterHandler) error
+
+		// 停止，清理本节点在注册表中的记录
+		Stop() error
+
+		// 登记本节点的连接
+		Register(id string) error
+
+		// 注销本节点的连接，同时解除其用户绑定
+		Unregister(id string) error
+
+		// 登记连接的用户绑定
+		BindUser(id, userKey string) error
+
+		// 解除连接的用户绑定登记
+		UnbindUser(id string) error
+
+		// 投递到指定 id 的连接所在的节点
+		SendTo(id string, message Message) error
+
+		// 投递到其他节点上用户绑定的所有连接
+		SendToUser(userKey string, message Message) error
+
+		// 投递到其他节点的组
+		Broadcast(group string, message Message) error
+
+		// 投递到其他节点的所有连接
+		BroadcastAll(message Message) error
+
+		// 踢掉指定 id 的连接
+		Kick(id string) error
+
+		// 踢掉其他节点上用户绑定的所有连接，except 除外
+		KickUser(userKey, except string) error
+	}
+
+	// 集群投递处理定义，由 Service 实现，处理其他节点投递到本节点的指令
+	ClusterHandler interface {
+		// 投递到本地指定 id 的连接
+		DeliverTo(id string, message Message)
+
+		// 投递到本地用户绑定的所有连接
+		DeliverToUser(userKey string, message Message)
+
+		// 投递到本地组
+		DeliverToGroup(group string, message Message)
+
+		// 投递到本地所有连接
+		DeliverToAll(message Message)
+
+		// 踢掉本地指定 id 的连接
+		KickLocal(id string)
+	}
+)
+
+// 投递到指定 id 的连接，本地不存在时经由集群投递
+func sendTo(manager Manager, cluster Cluster, id string, message Message) error {
+	i, err := manager.FindItem(id)
+	if err == nil {
+		i.Send(message)
+		return nil
+	}
+	if err != ErrItemUnExist || cluster == nil {
+		return err
+	}
+
+	return cluster.SendTo(id, message)
+}
+
+// 投递到用户绑定的所有连接，包括其他节点
+func sendToUser(manager Manager, cluster Cluster, userKey string, message Message) error {
+	if userKey == "" {
+		return ErrEmptyUserKey
+	}
+
+	for _, i := range manager.FindByUser(userKey) {
+		i.Send(message)
+	}
+
+	if cluster == nil {
+		return nil
+	}
+
+	return cluster.SendToUser(userKey, message)
+}
+
+// 组广播，包括其他节点
+func broadcastGroup(manager Manager, cluster Cluster, group string, message Message) error {
+	err := manager.Broadcast(group, message)
+	if cluster == nil {
+		return err
+	}
+
+	// 组可能只存在于其他节点
+	if err != nil && err != ErrGroupUnExist {
+		return err
+	}
+
+	return cluster.Broadcast(group, message)
+}
+
+// 全体广播，包括其他节点
+func broadcastAll(manager Manager, cluster Cluster, message Message) error {
+	if err := manager.BroadcastAll(message); err != nil {
+		return err
+	}
+
+	if cluster == nil {
+		return nil
+	}
+
+	return cluster.BroadcastAll(message)
+}
+
+// 绑定用户，BindPolicyKickPrevious 策略下同时踢掉其他节点上的旧连接
+func bindUser(manager Manager, cluster Cluster, id, userKey string) error {
+	if err := manager.BindUser(id, userKey); err != nil {
+		return err
+	}
+
+	if cluster == nil {
+		return nil
+	}
+
+	if err := cluster.BindUser(id, userKey); err != nil {
+		return err
+	}
+
+	if manager.BindPolicy() == BindPolicyKickPrevious {
+		return cluster.KickUser(userKey, id)
+	}
+
+	return nil
+}
+
+// 踢掉指定 id 的连接，本地不存在时经由集群踢掉
+func kick(manager Manager, cluster Cluster, id string) error {
+	i, err := manager.FindItem(id)
+	if err == nil {
+		log.InfoF("[%s] kicked", id)
+		i.CloseWithState(ItemStateKickedClose)
+		return nil
+	}
+	if err != ErrItemUnExist || cluster == nil {
+		return err
+	}
+
+	return cluster.Kick(id)
+}
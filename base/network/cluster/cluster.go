@@ -0,0 +1,655 @@
+// cluster 是 network.Cluster 基于 Redis 的实现，使用前必须先调用 redis.InitializeRedis() 初始化默认连接池
+// 注册表：
+//
+//	{prefix}items                 哈希表，连接 id -> 节点
+//	{prefix}users:{userKey}       哈希表，用户绑定的连接 id -> 节点
+//	{prefix}bindings              哈希表，连接 id -> 用户键，用于注销时解除绑定
+//	{prefix}node:{node}           集合，节点上的所有连接 id，用于节点停止时清理
+//	{prefix}alive:{node}          节点心跳，每隔 NodeTTL/3 刷新，NodeTTL 后过期
+//
+// 节点心跳过期视为节点已失效，查找连接或用户时跳过失效节点，并清理其登记的所有连接及用户绑定
+// 节点自身的心跳因故过期后，下次刷新时重新登记本节点的所有连接及用户绑定
+//
+// 投递通道：
+//
+//	{prefix}channel:{node}        节点通道，点对点投递和踢出
+//	{prefix}channel:all           全体通道，组广播和全体广播，来源节点忽略自身发出的投递
+//
+// 节点通过 Redis 发布订阅接收投递，订阅连接断开后每隔 ResubscribeInterval 重新订阅
+// 注册表及发布订阅经由 store 访问，默认为 Redis 实现
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"jarvis/base/database/redis"
+	"jarvis/base/log"
+	"jarvis/base/network"
+	uRand "jarvis/util/rand"
+	uTime "jarvis/util/time"
+	"sync"
+	"time"
+)
+
+type (
+	// 集群实现
+	cluster struct {
+		node       string                 // 节点标识
+		prefix     string                 // 键前缀
+		handler    network.ClusterHandler // 投递处理
+		store      store                  // 注册表及发布订阅存储
+		ttl        time.Duration          // 节点心跳过期时间
+		subscriber redis.Subscriber       // 订阅者
+		stopped    bool                   // 是否已停止
+		items      map[string]string      // 本节点登记的连接，map[连接 id]用户键，心跳过期后据此重新登记
+		mutex      sync.Mutex             // 订阅者、状态及本节点登记竞态锁
+	}
+
+	// 节点之间传递的投递信封
+	envelope struct {
+		Type    string          `json:"type"`    // 投递类型
+		Target  string          `json:"target"`  // 投递目标，连接 id 、用户键或组名
+		Origin  string          `json:"origin"`  // 来源节点
+		Message network.Message `json:"message"` // 投递的消息
+	}
+)
+
+const (
+	// 默认键前缀
+	DefaultPrefix = "jarvis:cluster:"
+	// 重新订阅间隔
+	ResubscribeInterval = time.Second
+	// 节点心跳过期时间，每隔三分之一刷新一次
+	NodeTTL = 15 * time.Second
+)
+
+// 此常量组定义了投递类型
+const (
+	envelopeTo    = "to"    // 投递到连接
+	envelopeUser  = "user"  // 投递到用户
+	envelopeGroup = "group" // 投递到组
+	envelopeAll   = "all"   // 投递到所有连接
+	envelopeKick  = "kick"  // 踢掉连接
+)
+
+// 此常量组定义了 Cluster 实现中可能会发生的错误文本
+const (
+	ErrNilHandlerText     = "cluster handler is nil"
+	ErrClusterStoppedText = "cluster already stopped"
+)
+
+var (
+	// 投递处理为 nil 错误
+	ErrNilHandler = errors.New(ErrNilHandlerText)
+	// 集群已停止错误
+	ErrClusterStopped = errors.New(ErrClusterStoppedText)
+)
+
+// 新建集群，node 为空时随机生成节点标识
+func NewCluster(node string) network.Cluster {
+	return NewClusterWithPrefix(node, DefaultPrefix)
+}
+
+// 新建集群，指定键前缀，用于多个集群共用一个 Redis
+func NewClusterWithPrefix(node, prefix string) network.Cluster {
+	if node == "" {
+		node = uRand.RandomString(8)
+	}
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	return newCluster(node, prefix, redisStore{})
+}
+
+// 新建使用指定存储的集群
+func newCluster(node, prefix string, s store) *cluster {
+	return &cluster{
+		node:   node,
+		prefix: prefix,
+		store:  s,
+		ttl:    NodeTTL,
+		items:  make(map[string]string),
+		mutex:  sync.Mutex{},
+	}
+}
+
+// 节点标识
+func (c *cluster) Node() string {
+	return c.node
+}
+
+// 启动
+func (c *cluster) Start(handler network.ClusterHandler) error {
+	if handler == nil {
+		return ErrNilHandler
+	}
+
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return ErrClusterStopped
+	}
+	c.handler = handler
+	c.mutex.Unlock()
+
+	// 先写入心跳，其他节点才会认为本节点登记的连接有效
+	if err := c.store.SetWithTimeout(c.aliveKey(c.node), c.node, c.ttl); err != nil {
+		return err
+	}
+
+	subscriber, err := c.subscribe()
+	if err != nil {
+		return err
+	}
+
+	go c.receive(subscriber)
+	c.keepAlive()
+
+	return nil
+}
+
+// 停止
+func (c *cluster) Stop() error {
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return ErrClusterStopped
+	}
+	c.stopped = true
+	subscriber := c.subscriber
+	c.mutex.Unlock()
+
+	if subscriber != nil {
+		_ = subscriber.Close()
+	}
+
+	// 清理本节点登记的所有连接
+	if err := c.reap(c.node); err != nil {
+		return err
+	}
+
+	return c.store.Del(c.aliveKey(c.node))
+}
+
+// 登记本节点的连接
+func (c *cluster) Register(id string) error {
+	c.mutex.Lock()
+	c.items[id] = ""
+	c.mutex.Unlock()
+
+	return c.register(id, "")
+}
+
+// 注销本节点的连接，同时解除其用户绑定
+func (c *cluster) Unregister(id string) error {
+	c.mutex.Lock()
+	delete(c.items, id)
+	c.mutex.Unlock()
+
+	return c.unregister(c.node, id)
+}
+
+// 登记连接的用户绑定
+func (c *cluster) BindUser(id, userKey string) error {
+	c.mutex.Lock()
+	if _, exist := c.items[id]; exist {
+		c.items[id] = userKey
+	}
+	c.mutex.Unlock()
+
+	// 解除原有绑定
+	bindings, err := c.store.HMGet(c.bindingsKey(), id)
+	if err != nil {
+		return err
+	}
+	if previous := bindings[id]; previous != "" && previous != userKey {
+		if err := c.store.HDel(c.userKey(previous), id); err != nil {
+			return err
+		}
+	}
+
+	return c.bind(id, userKey)
+}
+
+// 解除连接的用户绑定登记
+func (c *cluster) UnbindUser(id string) error {
+	c.mutex.Lock()
+	if _, exist := c.items[id]; exist {
+		c.items[id] = ""
+	}
+	c.mutex.Unlock()
+
+	return c.unbind(id)
+}
+
+// 投递到指定 id 的连接所在的节点
+func (c *cluster) SendTo(id string, message network.Message) error {
+	node, err := c.locate(id)
+	if err != nil {
+		return err
+	}
+
+	return c.publish(c.nodeChannel(node), envelopeTo, id, message)
+}
+
+// 投递到其他节点上用户绑定的所有连接
+func (c *cluster) SendToUser(userKey string, message network.Message) error {
+	nodes, err := c.userNodes(userKey)
+	if err != nil {
+		return err
+	}
+
+	for node := range nodes {
+		if err := c.publish(c.nodeChannel(node), envelopeUser, userKey, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 投递到其他节点的组
+func (c *cluster) Broadcast(group string, message network.Message) error {
+	return c.publish(c.allChannel(), envelopeGroup, group, message)
+}
+
+// 投递到其他节点的所有连接
+func (c *cluster) BroadcastAll(message network.Message) error {
+	return c.publish(c.allChannel(), envelopeAll, "", message)
+}
+
+// 踢掉指定 id 的连接
+func (c *cluster) Kick(id string) error {
+	node, err := c.locate(id)
+	if err != nil {
+		return err
+	}
+
+	return c.publish(c.nodeChannel(node), envelopeKick, id, network.Message{})
+}
+
+// 踢掉其他节点上用户绑定的所有连接，except 除外
+func (c *cluster) KickUser(userKey, except string) error {
+	items, err := c.userItems(userKey)
+	if err != nil {
+		return err
+	}
+
+	for id, node := range items {
+		if id == except {
+			continue
+		}
+		if err := c.publish(c.nodeChannel(node), envelopeKick, id, network.Message{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 查找连接所在的其他节点
+func (c *cluster) locate(id string) (string, error) {
+	items, err := c.store.HMGet(c.itemsKey(), id)
+	if err != nil {
+		return "", err
+	}
+
+	// 未登记，或登记在本节点但本地已不存在
+	node := items[id]
+	if node == "" || node == c.node {
+		return "", network.ErrItemUnExist
+	}
+
+	// 所在节点已失效
+	alive, err := c.alive(node)
+	if err != nil {
+		return "", err
+	}
+	if _, exist := alive[node]; !exist {
+		return "", network.ErrItemUnExist
+	}
+
+	return node, nil
+}
+
+// 用户绑定的连接所在的其他节点
+func (c *cluster) userNodes(userKey string) (map[string]struct{}, error) {
+	items, err := c.userItems(userKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]struct{})
+	for _, node := range items {
+		nodes[node] = struct{}{}
+	}
+
+	return nodes, nil
+}
+
+// 用户绑定的其他有效节点上的连接，map[连接 id]节点
+func (c *cluster) userItems(userKey string) (map[string]string, error) {
+	items, err := c.store.HGetAll(c.userKey(userKey))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]string, 0, len(items))
+	for id, node := range items {
+		if node == c.node {
+			delete(items, id)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+
+	alive, err := c.alive(nodes...)
+	if err != nil {
+		return nil, err
+	}
+	for id, node := range items {
+		if _, exist := alive[node]; !exist {
+			delete(items, id)
+		}
+	}
+
+	return items, nil
+}
+
+// 检查节点心跳，返回其中有效的节点，失效节点登记的连接及用户绑定被清理
+func (c *cluster) alive(nodes ...string) (map[string]struct{}, error) {
+	alive := make(map[string]struct{})
+	if len(nodes) == 0 {
+		return alive, nil
+	}
+
+	keys := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		keys = append(keys, c.aliveKey(node))
+	}
+	values, err := c.store.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	reaped := make(map[string]struct{})
+	for _, node := range nodes {
+		if values[c.aliveKey(node)] != "" {
+			alive[node] = struct{}{}
+			continue
+		}
+
+		// 同一节点只清理一次
+		if _, exist := reaped[node]; exist {
+			continue
+		}
+		reaped[node] = struct{}{}
+		log.WarnF("cluster [%s] node [%s] heartbeat expired , reap its items", c.node, node)
+		if err := c.reap(node); err != nil {
+			log.ErrorF("cluster [%s] reap node [%s] error : %s", c.node, node, err.Error())
+		}
+	}
+
+	return alive, nil
+}
+
+// 清理节点登记的所有连接及用户绑定
+func (c *cluster) reap(node string) error {
+	ids, err := c.store.SMembers(c.nodeKey(node))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := c.unregister(node, id); err != nil {
+			return err
+		}
+	}
+
+	return c.store.Del(c.nodeKey(node))
+}
+
+// 在注册表中登记连接及其用户绑定
+func (c *cluster) register(id, userKey string) error {
+	if err := c.store.HSet(c.itemsKey(), id, c.node); err != nil {
+		return err
+	}
+	if err := c.store.SAdd(c.nodeKey(c.node), id); err != nil {
+		return err
+	}
+	if userKey == "" {
+		return nil
+	}
+
+	return c.bind(id, userKey)
+}
+
+// 从注册表中移除节点上的连接，同时解除其用户绑定
+func (c *cluster) unregister(node, id string) error {
+	if err := c.unbind(id); err != nil {
+		return err
+	}
+
+	// 连接已登记到其他节点时保留
+	items, err := c.store.HMGet(c.itemsKey(), id)
+	if err != nil {
+		return err
+	}
+	if items[id] == node {
+		if err := c.store.HDel(c.itemsKey(), id); err != nil {
+			return err
+		}
+	}
+
+	return c.store.SRem(c.nodeKey(node), id)
+}
+
+// 登记用户绑定
+func (c *cluster) bind(id, userKey string) error {
+	if err := c.store.HSet(c.userKey(userKey), id, c.node); err != nil {
+		return err
+	}
+
+	return c.store.HSet(c.bindingsKey(), id, userKey)
+}
+
+// 解除用户绑定登记
+func (c *cluster) unbind(id string) error {
+	bindings, err := c.store.HMGet(c.bindingsKey(), id)
+	if err != nil {
+		return err
+	}
+	userKey := bindings[id]
+	if userKey == "" {
+		return nil
+	}
+
+	if err := c.store.HDel(c.userKey(userKey), id); err != nil {
+		return err
+	}
+
+	return c.store.HDel(c.bindingsKey(), id)
+}
+
+// 按心跳过期时间的三分之一刷新心跳，直到停止
+// 心跳已过期时本节点可能已被其他节点清理，刷新后重新登记本节点的所有连接及用户绑定
+func (c *cluster) keepAlive() {
+	uTime.NewTicker(c.ttl/3, func(time.Time) bool {
+		if c.isStopped() {
+			return false
+		}
+
+		values, err := c.store.MGet(c.aliveKey(c.node))
+		if err != nil {
+			log.ErrorF("cluster [%s] check heartbeat error : %s", c.node, err.Error())
+			return true
+		}
+		if err := c.store.SetWithTimeout(c.aliveKey(c.node), c.node, c.ttl); err != nil {
+			log.ErrorF("cluster [%s] refresh heartbeat error : %s", c.node, err.Error())
+			return true
+		}
+		if values[c.aliveKey(c.node)] != "" {
+			return true
+		}
+
+		log.WarnF("cluster [%s] heartbeat expired , register items again", c.node)
+		c.mutex.Lock()
+		items := make(map[string]string, len(c.items))
+		for id, userKey := range c.items {
+			items[id] = userKey
+		}
+		c.mutex.Unlock()
+		for id, userKey := range items {
+			if err := c.register(id, userKey); err != nil {
+				log.ErrorF("cluster [%s] register [%s] again error : %s", c.node, id, err.Error())
+			}
+		}
+
+		return true
+	}).Run()
+}
+
+// 发布投递
+func (c *cluster) publish(channel, kind, target string, message network.Message) error {
+	data, err := json.Marshal(envelope{
+		Type:    kind,
+		Target:  target,
+		Origin:  c.node,
+		Message: message,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.store.Publish(channel, data)
+}
+
+// 新建订阅者并订阅本节点通道和全体通道
+func (c *cluster) subscribe() (redis.Subscriber, error) {
+	subscriber, err := c.store.NewSubscriber()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := subscriber.Subscribe(c.nodeChannel(c.node), c.allChannel()); err != nil {
+		_ = subscriber.Close()
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// 订阅期间已停止
+	if c.stopped {
+		_ = subscriber.Close()
+		return nil, ErrClusterStopped
+	}
+	c.subscriber = subscriber
+
+	return subscriber, nil
+}
+
+// 接收投递，订阅连接断开后重新订阅，直到停止
+func (c *cluster) receive(subscriber redis.Subscriber) {
+	for {
+		_, data, err := subscriber.Receive()
+		if err == nil {
+			c.deliver(data)
+			continue
+		}
+
+		_ = subscriber.Close()
+		if c.isStopped() {
+			return
+		}
+		log.ErrorF("cluster [%s] receive error : %s", c.node, err.Error())
+
+		// 重新订阅
+		for {
+			time.Sleep(ResubscribeInterval)
+			if c.isStopped() {
+				return
+			}
+
+			subscriber, err = c.subscribe()
+			if err == nil {
+				break
+			}
+			if err == ErrClusterStopped {
+				return
+			}
+			log.ErrorF("cluster [%s] resubscribe error : %s", c.node, err.Error())
+		}
+	}
+}
+
+// 交由投递处理
+func (c *cluster) deliver(data []byte) {
+	e := envelope{}
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.ErrorF("cluster [%s] unmarshal envelope error : %s", c.node, err.Error())
+		return
+	}
+
+	// 忽略自身发出的全体通道投递
+	if e.Origin == c.node {
+		return
+	}
+
+	switch e.Type {
+	case envelopeTo:
+		c.handler.DeliverTo(e.Target, e.Message)
+	case envelopeUser:
+		c.handler.DeliverToUser(e.Target, e.Message)
+	case envelopeGroup:
+		c.handler.DeliverToGroup(e.Target, e.Message)
+	case envelopeAll:
+		c.handler.DeliverToAll(e.Message)
+	case envelopeKick:
+		c.handler.KickLocal(e.Target)
+	default:
+		log.WarnF("cluster [%s] unknown envelope type : %s", c.node, e.Type)
+	}
+}
+
+// 是否已停止
+func (c *cluster) isStopped() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stopped
+}
+
+// 连接 id -> 节点 哈希表键
+func (c *cluster) itemsKey() string {
+	return c.prefix + "items"
+}
+
+// 用户绑定哈希表键
+func (c *cluster) userKey(userKey string) string {
+	return c.prefix + "users:" + userKey
+}
+
+// 连接 id -> 用户键 哈希表键
+func (c *cluster) bindingsKey() string {
+	return c.prefix + "bindings"
+}
+
+// 节点连接集合键
+func (c *cluster) nodeKey(node string) string {
+	return c.prefix + "node:" + node
+}
+
+// 节点心跳键
+func (c *cluster) aliveKey(node string) string {
+	return c.prefix + "alive:" + node
+}
+
+// 节点通道
+func (c *cluster) nodeChannel(node string) string {
+	return c.prefix + "channel:" + node
+}
+
+// 全体通道
+func (c *cluster) allChannel() string {
+	return c.prefix + "channel:all"
+}
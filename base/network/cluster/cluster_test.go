@@ -0,0 +1,413 @@
+package cluster
+
+import (
+	"errors"
+	"jarvis/base/database/redis"
+	"jarvis/base/network"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// 内存存储，代替 Redis 注册表及发布订阅
+	memoryStore struct {
+		mutex       sync.Mutex
+		values      map[string]string
+		expires     map[string]time.Time
+		hashes      map[string]map[string]string
+		sets        map[string]map[string]struct{}
+		subscribers map[*memorySubscriber]struct{}
+	}
+
+	// 内存订阅者
+	memorySubscriber struct {
+		store    *memoryStore
+		channels map[string]struct{}
+		messages chan [2]string
+		closed   chan struct{}
+		once     sync.Once
+	}
+)
+
+var errSubscriberClosed = errors.New("subscriber closed")
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		values:      make(map[string]string),
+		expires:     make(map[string]time.Time),
+		hashes:      make(map[string]map[string]string),
+		sets:        make(map[string]map[string]struct{}),
+		subscribers: make(map[*memorySubscriber]struct{}),
+	}
+}
+
+func (ms *memoryStore) HSet(key, field, value string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exist := ms.hashes[key]; !exist {
+		ms.hashes[key] = make(map[string]string)
+	}
+	ms.hashes[key][field] = value
+	return nil
+}
+
+func (ms *memoryStore) HMGet(key string, fields ...string) (map[string]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	values := make(map[string]string)
+	for _, field := range fields {
+		values[field] = ms.hashes[key][field]
+	}
+	return values, nil
+}
+
+func (ms *memoryStore) HGetAll(key string) (map[string]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	values := make(map[string]string)
+	for field, value := range ms.hashes[key] {
+		values[field] = value
+	}
+	return values, nil
+}
+
+func (ms *memoryStore) HDel(key string, fields ...string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	for _, field := range fields {
+		delete(ms.hashes[key], field)
+	}
+	if len(ms.hashes[key]) == 0 {
+		delete(ms.hashes, key)
+	}
+	return nil
+}
+
+func (ms *memoryStore) SAdd(key, member string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, exist := ms.sets[key]; !exist {
+		ms.sets[key] = make(map[string]struct{})
+	}
+	ms.sets[key][member] = struct{}{}
+	return nil
+}
+
+func (ms *memoryStore) SRem(key, member string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	delete(ms.sets[key], member)
+	if len(ms.sets[key]) == 0 {
+		delete(ms.sets, key)
+	}
+	return nil
+}
+
+func (ms *memoryStore) SMembers(key string) ([]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	members := make([]string, 0, len(ms.sets[key]))
+	for member := range ms.sets[key] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (ms *memoryStore) Del(keys ...string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(ms.values, key)
+		delete(ms.expires, key)
+		delete(ms.hashes, key)
+		delete(ms.sets, key)
+	}
+	return nil
+}
+
+func (ms *memoryStore) SetWithTimeout(key, value string, timeout time.Duration) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.values[key] = value
+	ms.expires[key] = time.Now().Add(timeout)
+	return nil
+}
+
+func (ms *memoryStore) MGet(keys ...string) (map[string]string, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	values := make(map[string]string)
+	for _, key := range keys {
+		if expire, exist := ms.expires[key]; exist && time.Now().After(expire) {
+			delete(ms.values, key)
+			delete(ms.expires, key)
+		}
+		values[key] = ms.values[key]
+	}
+	return values, nil
+}
+
+func (ms *memoryStore) Publish(channel string, data []byte) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	for s := range ms.subscribers {
+		if _, exist := s.channels[channel]; exist {
+			s.messages <- [2]string{channel, string(data)}
+		}
+	}
+	return nil
+}
+
+func (ms *memoryStore) NewSubscriber() (redis.Subscriber, error) {
+	s := &memorySubscriber{
+		store:    ms,
+		channels: make(map[string]struct{}),
+		messages: make(chan [2]string, 64),
+		closed:   make(chan struct{}),
+	}
+
+	ms.mutex.Lock()
+	ms.subscribers[s] = struct{}{}
+	ms.mutex.Unlock()
+
+	return s, nil
+}
+
+// 哈希表或集合是否存在
+func (ms *memoryStore) exist(key string) bool {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	_, hash := ms.hashes[key]
+	_, set := ms.sets[key]
+	return hash || set
+}
+
+func (s *memorySubscriber) Subscribe(channels ...string) error {
+	s.store.mutex.Lock()
+	defer s.store.mutex.Unlock()
+
+	for _, channel := range channels {
+		s.channels[channel] = struct{}{}
+	}
+	return nil
+}
+
+func (s *memorySubscriber) Unsubscribe(channels ...string) error {
+	s.store.mutex.Lock()
+	defer s.store.mutex.Unlock()
+
+	for _, channel := range channels {
+		delete(s.channels, channel)
+	}
+	return nil
+}
+
+func (s *memorySubscriber) Receive() (string, []byte, error) {
+	select {
+	case message := <-s.messages:
+		return message[0], []byte(message[1]), nil
+	case <-s.closed:
+		return "", nil, errSubscriberClosed
+	}
+}
+
+func (s *memorySubscriber) Close() error {
+	s.store.mutex.Lock()
+	delete(s.store.subscribers, s)
+	s.store.mutex.Unlock()
+
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// 记录投递的处理者
+type recorder struct {
+	delivered chan string
+}
+
+func (r *recorder) DeliverTo(id string, message network.Message) {
+	r.delivered <- "to:" + id + ":" + string(message.Data)
+}
+
+func (r *recorder) DeliverToUser(userKey string, message network.Message) {
+	r.delivered <- "user:" + userKey + ":" + string(message.Data)
+}
+
+func (r *recorder) DeliverToGroup(group string, message network.Message) {
+	r.delivered <- "group:" + group + ":" + string(message.Data)
+}
+
+func (r *recorder) DeliverToAll(message network.Message) {
+	r.delivered <- "all:" + string(message.Data)
+}
+
+func (r *recorder) KickLocal(id string) {
+	r.delivered <- "kick:" + id
+}
+
+func (r *recorder) expect(t *testing.T, want string) {
+	select {
+	case got := <-r.delivered:
+		if got != want {
+			t.Fatalf("delivered %s , want %s", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("delivered nothing , want %s", want)
+	}
+}
+
+// 启动使用同一内存存储的节点
+func startNode(t *testing.T, store *memoryStore, node string) (*cluster, *recorder) {
+	c := newCluster(node, DefaultPrefix, store)
+	r := &recorder{delivered: make(chan string, 8)}
+	if err := c.Start(r); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Stop() })
+
+	return c, r
+}
+
+func TestCluster(t *testing.T) {
+	store := newMemoryStore()
+	a, ra := startNode(t, store, "a")
+	b, rb := startNode(t, store, "b")
+
+	if err := b.Register("item-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.BindUser("item-b", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SendTo("item-b", network.Message{Data: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	rb.expect(t, "to:item-b:1")
+
+	if err := a.SendToUser("user", network.Message{Data: []byte("2")}); err != nil {
+		t.Fatal(err)
+	}
+	rb.expect(t, "user:user:2")
+
+	if err := a.Broadcast("group", network.Message{Data: []byte("3")}); err != nil {
+		t.Fatal(err)
+	}
+	rb.expect(t, "group:group:3")
+
+	if err := a.KickUser("user", ""); err != nil {
+		t.Fatal(err)
+	}
+	rb.expect(t, "kick:item-b")
+
+	// 自身发出的全体投递不会回到自身
+	select {
+	case got := <-ra.delivered:
+		t.Fatalf("origin delivered %s", got)
+	default:
+	}
+
+	// 解除绑定后不再投递到用户
+	if err := b.UnbindUser("item-b"); err != nil {
+		t.Fatal(err)
+	}
+	if nodes, err := a.userNodes("user"); err != nil || len(nodes) != 0 {
+		t.Fatalf("user nodes after unbind = %v , %v", nodes, err)
+	}
+
+	if err := b.Unregister("item-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendTo("item-b", network.Message{}); err != network.ErrItemUnExist {
+		t.Fatalf("send to unregistered item error %v , want %v", err, network.ErrItemUnExist)
+	}
+}
+
+func TestClusterDeadNode(t *testing.T) {
+	store := newMemoryStore()
+	a, _ := startNode(t, store, "a")
+
+	// 未启动或已崩溃的节点没有心跳，登记的连接视为失效
+	dead := newCluster("dead", DefaultPrefix, store)
+	if err := dead.Register("item-dead"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dead.BindUser("item-dead", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if nodes, err := a.userNodes("user"); err != nil || len(nodes) != 0 {
+		t.Fatalf("user nodes = %v , %v , want none", nodes, err)
+	}
+	if err := a.SendTo("item-dead", network.Message{}); err != network.ErrItemUnExist {
+		t.Fatalf("send to dead node = %v , want %v", err, network.ErrItemUnExist)
+	}
+
+	// 失效节点登记的连接、用户绑定及节点集合均被清理
+	if items, _ := store.HMGet(a.itemsKey(), "item-dead"); items["item-dead"] != "" {
+		t.Fatal("items entry of dead node must be reaped")
+	}
+	for _, key := range []string{a.userKey("user"), a.bindingsKey(), a.nodeKey("dead")} {
+		if store.exist(key) {
+			t.Fatalf("%s must be reaped", key)
+		}
+	}
+}
+
+func TestClusterHeartbeatExpired(t *testing.T) {
+	store := newMemoryStore()
+	a := newCluster("a", DefaultPrefix, store)
+	a.ttl = 30 * time.Millisecond
+	if err := a.Start(&recorder{delivered: make(chan string, 8)}); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+	b, _ := startNode(t, store, "b")
+
+	if err := a.Register("item-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.BindUser("item-a", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 心跳过期后被其他节点清理，刷新心跳时重新登记
+	_ = store.Del(a.aliveKey("a"))
+	if err := b.reap("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		node, err := b.locate("item-a")
+		nodes, _ := b.userNodes("user")
+		if err == nil && node == "a" && len(nodes) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("item must be registered again , locate = %s , %v , user nodes = %v", node, err, nodes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 停止后心跳被移除
+	if err := a.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := store.MGet(a.aliveKey("a")); values[a.aliveKey("a")] != "" {
+		t.Fatal("heartbeat must be removed after stop")
+	}
+}
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"jarvis/base/database/redis"
+	"time"
+)
+
+type (
+	// 注册表及投递通道的存储定义，默认由 Redis 实现
+	store interface {
+		// 设置哈希表字段
+		HSet(key, field, value string) error
+
+		// 批量获取哈希表字段，不存在的字段值为空
+		HMGet(key string, fields ...string) (map[string]string, error)
+
+		// 获取哈希表所有字段
+		HGetAll(key string) (map[string]string, error)
+
+		// 删除哈希表字段
+		HDel(key string, fields ...string) error
+
+		// 添加集合成员
+		SAdd(key, member string) error
+
+		// 移除集合成员
+		SRem(key, member string) error
+
+		// 集合所有成员
+		SMembers(key string) ([]string, error)
+
+		// 删除键
+		Del(keys ...string) error
+
+		// 设置值及过期时间
+		SetWithTimeout(key, value string, timeout time.Duration) error
+
+		// 批量获取值，不存在或已过期的键值为空
+		MGet(keys ...string) (map[string]string, error)
+
+		// 发布
+		Publish(channel string, data []byte) error
+
+		// 新建订阅者
+		NewSubscriber() (redis.Subscriber, error)
+	}
+
+	// 基于 Redis 默认连接池的存储实现
+	redisStore struct{}
+)
+
+// 设置哈希表字段
+func (redisStore) HSet(key, field, value string) error {
+	_, err := redis.HSet(key, field, value)
+	return err
+}
+
+// 批量获取哈希表字段
+func (redisStore) HMGet(key string, fields ...string) (map[string]string, error) {
+	return redis.HMGet(key, fields...)
+}
+
+// 获取哈希表所有字段
+func (redisStore) HGetAll(key string) (map[string]string, error) {
+	return redis.HGetAll(key)
+}
+
+// 删除哈希表字段
+func (redisStore) HDel(key string, fields ...string) error {
+	_, err := redis.HDel(key, fields...)
+	return err
+}
+
+// 添加集合成员
+func (redisStore) SAdd(key, member string) error {
+	_, err := redis.SAdd(key, member)
+	return err
+}
+
+// 移除集合成员
+func (redisStore) SRem(key, member string) error {
+	_, err := redis.SRem(key, member)
+	return err
+}
+
+// 集合所有成员
+func (redisStore) SMembers(key string) ([]string, error) {
+	return redis.SMembers(key)
+}
+
+// 删除键
+func (redisStore) Del(keys ...string) error {
+	_, err := redis.Del(keys...)
+	return err
+}
+
+// 设置值及过期时间，精确到毫秒
+func (redisStore) SetWithTimeout(key, value string, timeout time.Duration) error {
+	return redis.SetWithTimeout(key, value, redis.StringSetTimeoutPX, int64(timeout/time.Millisecond))
+}
+
+// 批量获取值
+func (redisStore) MGet(keys ...string) (map[string]string, error) {
+	return redis.MGet(keys)
+}
+
+// 发布
+func (redisStore) Publish(channel string, data []byte) error {
+	_, err := redis.Publish(channel, data)
+	return err
+}
+
+// 新建订阅者
+func (redisStore) NewSubscriber() (redis.Subscriber, error) {
+	return redis.NewSubscriber()
+}
@@ -0,0 +1,298 @@
+// Codec 负责消息与字节组之间的转换，包括 Message 、 Reply 结构本身以及 Message.Data 中的业务数据
+// 内置 JSON 、 Protobuf 、 MessagePack 三种编解码器，JSON 会将 []byte 编码为 base64 ，其余两种直接以二进制携带
+// 连接建立时双方均使用 JSONCodec() ，客户端设置了其他编解码器时，在 Initialize() 中以 JSON 发送一条协商消息，
+// Item 收到协商消息后，若 Service 支持该编解码器，则以 JSON 回复协商结果后切换，客户端收到回复后同样切换，此后双方均使用新的编解码器
+// Service 不支持时回复当前使用的编解码器名，客户端 Initialize() 返回 ErrCodecUnsupported
+// 协商消息与心跳一样由 Item 直接处理，不进入 Service 的路由分发，也不受认证限制
+// 类型化处理函数通过 Context.Codec() 取得当前连接使用的编解码器，解码请求数据、编码响应数据
+// 注意：DefaultEncrypter() 的补位会去除数据末尾的 0 ，只能还原文本数据，Protobuf 、 MessagePack 输出任意字节，需要配合能够还原任意字节的加密器使用，
+// 即需要密钥交换的加密器，加密器不能还原任意字节时 Item 拒绝协商并保持 JSON ，客户端 SetCodec() 返回 ErrEncrypterNotByteSafe
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+type (
+	// 编解码器定义
+	Codec interface {
+		// 名称，协商时以名称标识编解码器
+		Name() string
+
+		// 编码
+		Marshal(interface{}) ([]byte, error)
+
+		// 解码
+		Unmarshal([]byte, interface{}) error
+	}
+
+	// JSON 编解码器实现
+	jsonCodec struct{}
+
+	// Protobuf 编解码器实现
+	protobufCodec struct{}
+
+	// MessagePack 编解码器实现
+	msgpackCodec struct{}
+)
+
+const (
+	// JSON 编解码器名称
+	CodecJSON = "json"
+	// Protobuf 编解码器名称
+	CodecProtobuf = "protobuf"
+	// MessagePack 编解码器名称
+	CodecMessagePack = "msgpack"
+
+	// 编解码器协商保留模块名
+	CodecModule = "codec"
+	// 编解码器协商路由名
+	CodecNegotiateRoute = "negotiate"
+	// 客户端协商请求使用的回覆
+	CodecNegotiateReply = "codec.negotiate"
+)
+
+// 此常量组定义了 Codec 定义及实现中可能会发生的错误文本
+const (
+	ErrNilCodecText             = "codec is nil"
+	ErrCodecUnsupportedText     = "codec is not supported by server"
+	ErrCodecUnsupportedTypeText = "type is not supported by codec"
+)
+
+var (
+	// 编解码器为 nil 错误
+	ErrNilCodec = errors.New(ErrNilCodecText)
+	// 服务端不支持客户端的编解码器 错误
+	ErrCodecUnsupported = errors.New(ErrCodecUnsupportedText)
+	// 编解码器不支持该类型 错误
+	ErrCodecUnsupportedType = errors.New(ErrCodecUnsupportedTypeText)
+)
+
+// JSON 编解码器
+func JSONCodec() Codec {
+	return jsonCodec{}
+}
+
+// Protobuf 编解码器，Message 与 Reply 以内置的 protobuf 结构编码，业务数据必须实现 proto.Message
+//
+//	message Message { string module = 1; string route = 2; bytes data = 3; string reply = 4; }
+//	message Reply   { int64 code = 1; string message = 2; bytes data = 3; }
+func ProtobufCodec() Codec {
+	return protobufCodec{}
+}
+
+// MessagePack 编解码器，沿用 json 标签作为字段名
+func MessagePackCodec() Codec {
+	return msgpackCodec{}
+}
+
+// 编解码器协商消息
+func negotiateMessage(name string) Message {
+	return Message{
+		Module: CodecModule,
+		Route:  CodecNegotiateRoute,
+		Data:   []byte(name),
+		Reply:  CodecNegotiateReply,
+	}
+}
+
+// 是否为编解码器协商消息
+func isNegotiate(message Message) bool {
+	return message.Module == CodecModule && message.Route == CodecNegotiateRoute
+}
+
+// -------------------------------------------------- JSON -------------------------------------------------------------
+// 名称
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+// 编码
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// 解码
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// -------------------------------------------------- Protobuf ---------------------------------------------------------
+// 名称
+func (protobufCodec) Name() string {
+	return CodecProtobuf
+}
+
+// 编码
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case Message:
+		return marshalProtoMessage(&value), nil
+	case *Message:
+		return marshalProtoMessage(value), nil
+	case Reply:
+		return marshalProtoReply(&value), nil
+	case *Reply:
+		return marshalProtoReply(value), nil
+	case proto.Message:
+		return proto.Marshal(value)
+	default:
+		return nil, ErrCodecUnsupportedType
+	}
+}
+
+// 解码
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	switch value := v.(type) {
+	case *Message:
+		return unmarshalProtoMessage(data, value)
+	case *Reply:
+		return unmarshalProtoReply(data, value)
+	case proto.Message:
+		return proto.Unmarshal(data, value)
+	default:
+		return ErrCodecUnsupportedType
+	}
+}
+
+// 以 protobuf 编码 Message ，零值字段不编码，ID 不参与编码
+func marshalProtoMessage(m *Message) []byte {
+	b := make([]byte, 0, len(m.Module)+len(m.Route)+len(m.Data)+len(m.Reply)+16)
+	b = appendProtoString(b, 1, m.Module)
+	b = appendProtoString(b, 2, m.Route)
+	b = appendProtoBytes(b, 3, m.Data)
+	b = appendProtoString(b, 4, m.Reply)
+	return b
+}
+
+// 以 protobuf 解码 Message
+func unmarshalProtoMessage(b []byte, m *Message) error {
+	*m = Message{}
+
+	return consumeProto(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.Module = v
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.Route = v
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			m.Data = append([]byte(nil), v...)
+			return n
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			m.Reply = v
+			return n
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+	})
+}
+
+// 以 protobuf 编码 Reply ，零值字段不编码
+func marshalProtoReply(r *Reply) []byte {
+	b := make([]byte, 0, len(r.Message)+len(r.Data)+16)
+	if r.Code != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(r.Code)))
+	}
+	b = appendProtoString(b, 2, r.Message)
+	b = appendProtoBytes(b, 3, r.Data)
+	return b
+}
+
+// 以 protobuf 解码 Reply
+func unmarshalProtoReply(b []byte, r *Reply) error {
+	*r = Reply{}
+
+	return consumeProto(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.Code = int(int64(v))
+			return n
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			r.Message = v
+			return n
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			r.Data = append([]byte(nil), v...)
+			return n
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+	})
+}
+
+// 逐个读取 protobuf 字段，field 返回读取的字段值长度，长度为负数时表示解码错误
+// 未知字段由 field 跳过，与 protobuf 的兼容规则一致
+func consumeProto(b []byte, field func(protowire.Number, protowire.Type, []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// 追加 string 字段，空字符串不编码
+func appendProtoString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// 追加 bytes 字段，空字节组不编码
+func appendProtoBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// -------------------------------------------------- MessagePack ------------------------------------------------------
+// 名称
+func (msgpackCodec) Name() string {
+	return CodecMessagePack
+}
+
+// 编码
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// 解码
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
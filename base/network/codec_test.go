@@ -0,0 +1,149 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 新建能够互相解密的加密器对，map[名称][发送方, 接收方]
+func encrypterPairs(t *testing.T) map[string][2]Encrypter {
+	pairs := map[string][2]Encrypter{
+		"seter": {DefaultEncrypter(), DefaultEncrypter()},
+		"plain": {plainEncrypter{}, plainEncrypter{}},
+	}
+
+	for _, suite := range []CipherSuite{CipherAESGCM, CipherChaCha20Poly1305} {
+		a, b := sessionPair(t, suite)
+		pairs[suite.String()] = [2]Encrypter{a, b}
+	}
+
+	return pairs
+}
+
+// 末尾为 0 的任意字节，SETer 无法还原
+func binaryPayload() []byte {
+	return append(bytes.Repeat([]byte{0xff, 0x00, 0x7f, 0x80}, 512), 0, 0, 0)
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	codecs := []Codec{JSONCodec(), ProtobufCodec(), MessagePackCodec()}
+	compressors := []Compressor{nil, GzipCompressor(), FlateCompressor()}
+	for _, codec := range codecs {
+		for _, compressor := range compressors {
+			for name, pair := range encrypterPairs(t) {
+				codec, compressor, pair := codec, compressor, pair
+				compressorName := "none"
+				if compressor != nil {
+					compressorName = compressor.Name()
+				}
+				t.Run(codec.Name()+"/"+compressorName+"/"+name, func(t *testing.T) {
+					// 加密器不能还原任意字节时协商被拒绝，只会以 JSON 且不压缩收发
+					if (codec.Name() != CodecJSON || compressor != nil) && !byteSafe(pair[0]) {
+						return
+					}
+
+					message := Message{Module: "test", Route: "echo", Data: binaryPayload(), Reply: "echo"}
+					encoded, err := codec.Marshal(message)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					// 装包者支持标志位时以标志位标记压缩，否则以数据内的压缩标志标记
+					for _, flagged := range []bool{false, true} {
+						data, compressed, err := compress(compressor, DefaultCompressThreshold, encoded, flagged)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if compressor != nil && !compressed {
+							t.Fatal("payload above threshold must be compressed")
+						}
+						flags := FrameFlag(0)
+						if compressed {
+							flags = FrameFlagCompressed
+						}
+
+						data, err = decompress(compressor, pair[1].Decrypt(pair[0].Encrypt(data)), flags, flagged)
+						if err != nil {
+							t.Fatal(err)
+						}
+						decoded := Message{}
+						if err := codec.Unmarshal(data, &decoded); err != nil {
+							t.Fatal(err)
+						}
+						if decoded.Module != message.Module || decoded.Route != message.Route ||
+							decoded.Reply != message.Reply || !bytes.Equal(decoded.Data, message.Data) {
+							t.Fatalf("flagged %v : round trip mismatch , data length %d want %d", flagged, len(decoded.Data), len(message.Data))
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestNegotiateRefusesBinaryCodec(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetCodecs(ProtobufCodec(), MessagePackCodec()); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(addr))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := c.SetCodec(ProtobufCodec()); err != ErrEncrypterNotByteSafe {
+		t.Fatalf("set codec = %v , want %v", err, ErrEncrypterNotByteSafe)
+	}
+
+	// 绕过客户端的检查，服务端同样拒绝协商并保持 JSON
+	c.(*socketClient).codec = MessagePackCodec()
+	if err := c.Initialize(); err != ErrCodecUnsupported {
+		t.Fatalf("initialize = %v , want %v", err, ErrCodecUnsupported)
+	}
+	defer c.Close()
+	if items := s.Items(); len(items) != 1 || items[0].Codec().Name() != CodecJSON {
+		t.Fatal("item codec must stay json with the default encrypter")
+	}
+}
+
+func TestNegotiateRefusesCompression(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetCompression(0, GzipCompressor(), FlateCompressor()); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(addr))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := c.SetCompression(0, GzipCompressor()); err != ErrEncrypterNotByteSafe {
+		t.Fatalf("set compression = %v , want %v", err, ErrEncrypterNotByteSafe)
+	}
+
+	// 绕过客户端的检查，服务端同样拒绝协商，双方均不压缩
+	c.(*socketClient).compressors = []Compressor{GzipCompressor(), FlateCompressor()}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if items := s.Items(); len(items) != 1 || items[0].Compressor() != nil {
+		t.Fatal("item must not compress with the default encrypter")
+	}
+
+	// 超过压缩阈值的请求依旧可以收发
+	data := bytes.Repeat([]byte("jarvis"), DefaultCompressThreshold)
+	response, err := c.RequestSync(Message{Module: "test", Route: "echo", Data: data, Reply: "echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := Reply{}
+	if err := JSONCodec().Unmarshal(response.Data, &reply); err != nil || !bytes.Equal(reply.Data, data) {
+		t.Fatalf("echo reply length %d , %v", len(reply.Data), err)
+	}
+}
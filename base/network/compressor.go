@@ -0,0 +1,242 @@
+// Compressor 在编解码器与加密器之间压缩数据，内置标准库的 gzip 与 flate 两种压缩算法
+// 连接建立时不压缩，客户端设置了压缩算法时，在 Initialize() 中按偏好顺序发送一条压缩协商消息，
+// Item 选择第一个 Service 支持的算法，以原方式回复协商结果后切换，客户端收到回复后同样切换，没有共同支持的算法时回复空字符串，双方均不压缩
+// 协商成功后，装包者支持标志位时以数据帧的 FrameFlagCompressed 标记已压缩的数据；
+// 不支持标志位时每个数据在压缩后、加密前以 1 字节标志开头，compressFlagRaw 表示未压缩，compressFlagCompressed 表示已压缩，
+// 长度小于阈值或压缩后没有变小的数据不压缩
+// 压缩后的数据为任意字节，与二进制编解码器一样需要配合能够还原任意字节的加密器使用，
+// 加密器不能还原任意字节时 Item 回复空字符串不压缩，客户端 SetCompression() 返回 ErrEncrypterNotByteSafe
+package network
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type (
+	// 压缩器定义
+	Compressor interface {
+		// 名称，协商时以名称标识压缩算法
+		Name() string
+
+		// 压缩
+		Compress([]byte) ([]byte, error)
+
+		// 解压
+		Decompress([]byte) ([]byte, error)
+	}
+
+	// gzip 压缩器实现
+	gzipCompressor struct {
+		level int // 压缩等级
+	}
+
+	// flate 压缩器实现
+	flateCompressor struct {
+		level int // 压缩等级
+	}
+)
+
+const (
+	// gzip 压缩器名称
+	CompressorGzip = "gzip"
+	// flate 压缩器名称
+	CompressorFlate = "flate"
+
+	// 默认压缩阈值，长度小于此值的数据不压缩
+	DefaultCompressThreshold = 1024
+	// 解压后数据的最大长度，防止压缩炸弹
+	MaxDecompressSize = 16 * 1024 * 1024
+
+	// 压缩协商路由名，使用编解码器协商保留模块
+	CompressNegotiateRoute = "compress"
+	// 客户端压缩协商请求使用的回覆
+	CompressNegotiateReply = "codec.compress"
+	// 协商消息中压缩算法名的分隔符
+	CompressNameSeparator = ","
+)
+
+// 此常量组定义了压缩标志
+const (
+	compressFlagRaw        byte = iota // 未压缩
+	compressFlagCompressed             // 已压缩
+)
+
+// 此常量组定义了 Compressor 定义及实现中可能会发生的错误文本
+const (
+	ErrNilCompressorText      = "compressor is nil"
+	ErrCompressFlagText       = "invalid compress flag"
+	ErrDecompressTooLargeText = "decompressed data exceeds max size"
+)
+
+var (
+	// 压缩器为 nil 错误
+	ErrNilCompressor = errors.New(ErrNilCompressorText)
+	// 压缩标志不正确 错误
+	ErrCompressFlag = errors.New(ErrCompressFlagText)
+	// 解压后数据超过最大长度 错误
+	ErrDecompressTooLarge = errors.New(ErrDecompressTooLargeText)
+)
+
+// gzip 压缩器，默认压缩等级
+func GzipCompressor() Compressor {
+	return &gzipCompressor{level: gzip.DefaultCompression}
+}
+
+// flate 压缩器，默认压缩等级
+func FlateCompressor() Compressor {
+	return &flateCompressor{level: flate.DefaultCompression}
+}
+
+// 压缩协商消息
+func compressNegotiateMessage(names []string) Message {
+	return Message{
+		Module: CodecModule,
+		Route:  CompressNegotiateRoute,
+		Data:   []byte(strings.Join(names, CompressNameSeparator)),
+		Reply:  CompressNegotiateReply,
+	}
+}
+
+// 是否为压缩协商消息
+func isCompressNegotiate(message Message) bool {
+	return message.Module == CodecModule && message.Route == CompressNegotiateRoute
+}
+
+// 压缩，compressor 为 nil 时原样返回，返回是否已压缩
+// flagged 为 true 时由数据帧标志位标记是否已压缩，否则在数据内附带压缩标志
+func compress(compressor Compressor, threshold int, data []byte, flagged bool) ([]byte, bool, error) {
+	if compressor == nil {
+		return data, false, nil
+	}
+
+	if len(data) >= threshold {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(compressed) < len(data) {
+			if flagged {
+				return compressed, true, nil
+			}
+			return append([]byte{compressFlagCompressed}, compressed...), true, nil
+		}
+	}
+
+	if flagged {
+		return data, false, nil
+	}
+	return append([]byte{compressFlagRaw}, data...), false, nil
+}
+
+// 解压，flagged 为 true 时按数据帧标志位解压，否则按数据内的压缩标志解压，compressor 为 nil 时原样返回
+func decompress(compressor Compressor, data []byte, flags FrameFlag, flagged bool) ([]byte, error) {
+	if flagged {
+		if !flags.Has(FrameFlagCompressed) {
+			return data, nil
+		}
+		if compressor == nil {
+			return nil, ErrCompressFlag
+		}
+		return compressor.Decompress(data)
+	}
+
+	if compressor == nil {
+		return data, nil
+	}
+	if len(data) == 0 {
+		return nil, ErrCompressFlag
+	}
+
+	switch data[0] {
+	case compressFlagRaw:
+		return data[1:], nil
+	case compressFlagCompressed:
+		return compressor.Decompress(data[1:])
+	default:
+		return nil, ErrCompressFlag
+	}
+}
+
+// 读取全部解压数据，超过 MaxDecompressSize 时返回错误
+func readDecompressed(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxDecompressSize {
+		return nil, ErrDecompressTooLarge
+	}
+
+	return data, nil
+}
+
+// -------------------------------------------------- gzip -------------------------------------------------------------
+// 名称
+func (gc *gzipCompressor) Name() string {
+	return CompressorGzip
+}
+
+// 压缩
+func (gc *gzipCompressor) Compress(data []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(&buffer, gc.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// 解压
+func (gc *gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readDecompressed(r)
+}
+
+// -------------------------------------------------- flate ------------------------------------------------------------
+// 名称
+func (fc *flateCompressor) Name() string {
+	return CompressorFlate
+}
+
+// 压缩
+func (fc *flateCompressor) Compress(data []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	w, err := flate.NewWriter(&buffer, fc.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// 解压
+func (fc *flateCompressor) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	return readDecompressed(r)
+}
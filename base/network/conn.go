@@ -4,15 +4,26 @@
 // Conn 的关闭，不可重复关闭，内部 net.Conn 实例为 nil 时报错，会在加互斥锁的情况下将 closed 状态值为 true
 // Conn 的关闭查询，在加互斥锁的情况下返回 closed 的值
 // Conn 通过调用 UniqueSymbol() string 向外返回一个独一无二的标识，这个标识用于 Item 基于此值构造内部唯一标识
+// Conn 通过调用 RemoteAddr() string 向外返回对端地址，用于展示
+// webSocketConn 实现了 UpgradeConn ，通过调用 Upgrade() *UpgradeInfo 向外返回升级请求的请求头、Cookie 及查询参数
+// 三种连接均实现了 SecureConn ，通过调用 TLSState() *tls.ConnectionState 向外返回 TLS 连接状态，非 TLS 连接返回 nil
 package network
 
 import (
+	"crypto/tls"
 	"errors"
 	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 	"jarvis/base/network/grpc"
 	"jarvis/util/rand"
+	uTime "jarvis/util/time"
 	"net"
+	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
@@ -32,6 +43,9 @@ type (
 
 		// 唯一标识
 		UniqueSymbol() string
+
+		// 对端地址
+		RemoteAddr() string
 	}
 
 	// 基础通用结构
@@ -39,19 +53,58 @@ type (
 		closed bool // 是否已关闭
 	}
 
-	// socket 连接实现
+	// socket 连接实现，同时用于 unix 域套接字及 UDP 客户端
 	socketConn struct {
 		baseConn
-		c     net.Conn   // 底层连接
-		mutex sync.Mutex // 对关闭状态的多线程竞态加锁
+		c            net.Conn   // 底层连接
+		bufferLength int        // 每次读取的缓存大小
+		mutex        sync.Mutex // 对关闭状态的多线程竞态加锁
+	}
+
+	// 直通连接定义，实现此接口的连接每次读取、写入的都是以编解码器直接序列化的完整消息，不经过装包者及加密器
+	// 用于 HTTP 一次性请求等自身已经划分了消息边界的连接
+	PlainConn interface {
+		// 是否直通
+		Plain() bool
+	}
+
+	// 一次性连接定义，实现此接口的连接只承载一个请求，例如 HTTP 一次性请求
+	// AuthOption 未指定握手路由时，认证成功后该请求继续路由，而不是只回复认证成功
+	OneShotConn interface {
+		// 是否一次性
+		OneShot() bool
+	}
+
+	// 升级连接定义，由 HTTP 升级而来的连接实现此接口
+	UpgradeConn interface {
+		// 升级请求信息
+		Upgrade() *UpgradeInfo
+	}
+
+	// 活跃连接定义，连接上存在不经过 Read() 的数据（例如 WebSocket 的 pong 控制帧）时实现此接口，空闲检测同样将其视为读取
+	ActiveConn interface {
+		// 最后一次收到不经过 Read() 的数据的时间，从未收到时为零值
+		LastActive() time.Time
+	}
+
+	// 升级请求信息
+	UpgradeInfo struct {
+		Path    string         // 请求路径
+		Header  http.Header    // 请求头
+		Cookies []*http.Cookie // Cookie
+		Query   url.Values     // 查询参数
 	}
 
 	// webSocket 连接实现
+	// 原子操作的时间置于结构起始，保证 32 位平台上的 64 位对齐
 	webSocketConn struct {
+		lastActive int64 // 最后一次收到 pong 控制帧的时间，UnixNano
 		baseConn
-		c          *websocket.Conn // 底层连接
-		mutex      sync.Mutex      // 对关闭状态的多线程竞态加锁
-		writeMutex sync.Mutex      // 当前使用的 "github.com/gorilla/websocket" 库不支持并发写，因此加入锁
+		c           *websocket.Conn // 底层连接
+		messageType int             // 写入使用的消息类型
+		upgrade     *UpgradeInfo    // 升级请求信息，客户端连接为 nil
+		mutex       sync.Mutex      // 对关闭状态的多线程竞态加锁
+		writeMutex  sync.Mutex      // 当前使用的 "github.com/gorilla/websocket" 库不支持并发写，因此加入锁
 	}
 
 	// gRPC 连接接口实现结构
@@ -83,26 +136,66 @@ var (
 
 // 实例化 socketConn 的 Conn 实现，返回表现形式为 Conn
 func NewSocketConn(c net.Conn) Conn {
+	return newSocketConn(c, BufferLength)
+}
+
+// 实例化指定读取缓存大小的 socketConn ，UDP 连接每次读取一个完整的数据报，缓存需要容纳最大的数据报
+func newSocketConn(c net.Conn, bufferLength int) Conn {
 	return &socketConn{
-		baseConn: baseConn{},
-		c:        c,
-		mutex:    sync.Mutex{},
+		baseConn:     baseConn{},
+		c:            c,
+		bufferLength: bufferLength,
+		mutex:        sync.Mutex{},
 	}
 }
 
-// 实例化 webSocketConn 的 Conn 实现，返回表现形式为 Conn
+// 实例化 webSocketConn 的 Conn 实现，返回表现形式为 Conn ，以文本帧写入
 func NewWebSocketConn(c *websocket.Conn) Conn {
+	return newWebSocketConn(c, websocket.TextMessage, nil)
+}
+
+// 实例化 webSocketConn ，以指定消息类型写入
+func newWebSocketConn(c *websocket.Conn, messageType int, upgrade *UpgradeInfo) *webSocketConn {
 	return &webSocketConn{
-		baseConn:   baseConn{},
-		c:          c,
-		mutex:      sync.Mutex{},
-		writeMutex: sync.Mutex{},
+		baseConn:    baseConn{},
+		c:           c,
+		messageType: messageType,
+		upgrade:     upgrade,
+		mutex:       sync.Mutex{},
+		writeMutex:  sync.Mutex{},
+	}
+}
+
+// 由升级请求生成升级请求信息
+func newUpgradeInfo(r *http.Request) *UpgradeInfo {
+	return &UpgradeInfo{
+		Path:    r.URL.Path,
+		Header:  r.Header.Clone(),
+		Cookies: r.Cookies(),
+		Query:   r.URL.Query(),
 	}
 }
 
+// 升级请求信息，未由升级而来的连接返回 nil
+func upgradeInfo(conn Conn) *UpgradeInfo {
+	uc, ok := conn.(UpgradeConn)
+	if !ok {
+		return nil
+	}
+
+	return uc.Upgrade()
+}
+
+// 连接是否只承载一个请求
+func oneShot(conn Conn) bool {
+	oc, ok := conn.(OneShotConn)
+	return ok && oc.OneShot()
+}
+
 // 实例化 gRPCConn 的 Conn 实现，返回表现形式为 Conn
 func NewGRPCConn(ccs grpc.Communicate_ConnectServer) (Conn, chan struct{}) {
-	closeChan := make(chan struct{})
+	// 带缓冲，防止 gate 已经返回后 Close() 阻塞
+	closeChan := make(chan struct{}, 1)
 
 	return &gRPCConn{
 		baseConn:  baseConn{},
@@ -119,11 +212,11 @@ func (sc *socketConn) Read() ([]byte, error) {
 	if sc.c == nil {
 		return nil, ErrNilConn
 	}
-	if sc.closed {
+	if sc.IsClosed() {
 		return nil, ErrConnClosed
 	}
 
-	buffer := make([]byte, BufferLength)
+	buffer := make([]byte, sc.bufferLength)
 	length, err := sc.c.Read(buffer)
 	if err != nil {
 		return nil, err
@@ -137,7 +230,7 @@ func (sc *socketConn) Write(data []byte) error {
 	if sc.c == nil {
 		return ErrNilConn
 	}
-	if sc.closed {
+	if sc.IsClosed() {
 		return ErrConnClosed
 	}
 
@@ -151,11 +244,13 @@ func (sc *socketConn) Close() error {
 	if sc.c == nil {
 		return ErrNilConn
 	}
+
+	// 检查与置位在同一把锁内完成，防止并发重复关闭
+	sc.mutex.Lock()
 	if sc.closed {
+		sc.mutex.Unlock()
 		return ErrConnClosed
 	}
-
-	sc.mutex.Lock()
 	sc.closed = true
 	sc.mutex.Unlock()
 
@@ -171,13 +266,32 @@ func (sc *socketConn) IsClosed() bool {
 
 // 唯一标识
 func (sc *socketConn) UniqueSymbol() string {
-	if sc.c == nil || sc.closed {
+	if sc.c == nil || sc.IsClosed() {
+		return ""
+	}
+
+	// unix 域套接字的对端通常没有地址，以随机字符串区分
+	if _, ok := sc.c.(*net.UnixConn); ok {
+		return rand.RandomString(8)
+	}
+
+	return sc.c.RemoteAddr().String()
+}
+
+// 对端地址
+func (sc *socketConn) RemoteAddr() string {
+	if sc.c == nil {
 		return ""
 	}
 
 	return sc.c.RemoteAddr().String()
 }
 
+// TLS 连接状态
+func (sc *socketConn) TLSState() *tls.ConnectionState {
+	return connTLSState(sc.c)
+}
+
 // --------------------------------------------------- webSocketConn ---------------------------------------------------
 // 读取，一次性阻塞读取
 // 当 err != nil 时，[]byte 为 nil
@@ -185,7 +299,7 @@ func (wsc *webSocketConn) Read() ([]byte, error) {
 	if wsc.c == nil {
 		return nil, ErrNilConn
 	}
-	if wsc.closed {
+	if wsc.IsClosed() {
 		return nil, ErrConnClosed
 	}
 
@@ -202,13 +316,13 @@ func (wsc *webSocketConn) Write(data []byte) error {
 	if wsc.c == nil {
 		return ErrNilConn
 	}
-	if wsc.closed {
+	if wsc.IsClosed() {
 		return ErrConnClosed
 	}
 	wsc.writeMutex.Lock()
 	defer wsc.writeMutex.Unlock()
 
-	return wsc.c.WriteMessage(websocket.TextMessage, data)
+	return wsc.c.WriteMessage(wsc.messageType, data)
 }
 
 // 关闭，重复关闭会报错
@@ -216,11 +330,13 @@ func (wsc *webSocketConn) Close() error {
 	if wsc.c == nil {
 		return ErrNilConn
 	}
+
+	// 检查与置位在同一把锁内完成，防止并发重复关闭
+	wsc.mutex.Lock()
 	if wsc.closed {
+		wsc.mutex.Unlock()
 		return ErrConnClosed
 	}
-
-	wsc.mutex.Lock()
 	wsc.closed = true
 	wsc.mutex.Unlock()
 
@@ -236,13 +352,73 @@ func (wsc *webSocketConn) IsClosed() bool {
 
 // 唯一标识
 func (wsc *webSocketConn) UniqueSymbol() string {
-	if wsc.c == nil || wsc.closed {
+	if wsc.c == nil || wsc.IsClosed() {
+		return ""
+	}
+
+	return wsc.c.RemoteAddr().String()
+}
+
+// 对端地址
+func (wsc *webSocketConn) RemoteAddr() string {
+	if wsc.c == nil {
 		return ""
 	}
 
 	return wsc.c.RemoteAddr().String()
 }
 
+// 升级请求信息
+func (wsc *webSocketConn) Upgrade() *UpgradeInfo {
+	return wsc.upgrade
+}
+
+// 原生 ping/pong 保活，每隔 interval 发送 ping ，wait 内未收到 pong 时读取超时，连接随之关闭
+// 在读取前调用
+func (wsc *webSocketConn) keepAlive(interval, wait time.Duration) {
+	if wsc.c == nil {
+		return
+	}
+
+	_ = wsc.c.SetReadDeadline(time.Now().Add(wait))
+	wsc.c.SetPongHandler(func(string) error {
+		atomic.StoreInt64(&wsc.lastActive, time.Now().UnixNano())
+		return wsc.c.SetReadDeadline(time.Now().Add(wait))
+	})
+
+	// 控制帧可以与数据帧并发写入
+	uTime.NewTicker(interval, func(time.Time) bool {
+		if wsc.IsClosed() {
+			return false
+		}
+
+		if err := wsc.c.WriteControl(websocket.PingMessage, nil, time.Now().Add(wait)); err != nil {
+			return false
+		}
+
+		return true
+	}).Run()
+}
+
+// 最后一次收到 pong 控制帧的时间，只响应浏览器原生 pong 的客户端依靠此时间保持活跃
+func (wsc *webSocketConn) LastActive() time.Time {
+	last := atomic.LoadInt64(&wsc.lastActive)
+	if last == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, last)
+}
+
+// TLS 连接状态，升级请求已经完成 TLS 握手
+func (wsc *webSocketConn) TLSState() *tls.ConnectionState {
+	if wsc.c == nil {
+		return nil
+	}
+
+	return connTLSState(wsc.c.UnderlyingConn())
+}
+
 // --------------------------------------------------- gRPCConn --------------------------------------------------------
 // 读取，一次性阻塞读取
 // 当 err != nil 时，[]byte 为 nil
@@ -250,7 +426,7 @@ func (gc *gRPCConn) Read() ([]byte, error) {
 	if gc.ccs == nil {
 		return nil, ErrNilConn
 	}
-	if gc.closed {
+	if gc.IsClosed() {
 		return nil, ErrConnClosed
 	}
 
@@ -267,7 +443,7 @@ func (gc *gRPCConn) Write(data []byte) error {
 	if gc.ccs == nil {
 		return ErrNilConn
 	}
-	if gc.closed {
+	if gc.IsClosed() {
 		return ErrConnClosed
 	}
 
@@ -279,11 +455,13 @@ func (gc *gRPCConn) Close() error {
 	if gc.ccs == nil {
 		return ErrNilConn
 	}
+
+	// 检查与置位在同一把锁内完成，防止并发重复关闭
+	gc.mutex.Lock()
 	if gc.closed {
+		gc.mutex.Unlock()
 		return ErrConnClosed
 	}
-
-	gc.mutex.Lock()
 	gc.closed = true
 	gc.mutex.Unlock()
 
@@ -302,9 +480,41 @@ func (gc *gRPCConn) IsClosed() bool {
 
 // 唯一标识
 func (gc *gRPCConn) UniqueSymbol() string {
-	if gc.ccs == nil || gc.closed {
+	if gc.ccs == nil || gc.IsClosed() {
 		return ""
 	}
 
 	return rand.RandomString(8)
 }
+
+// 对端地址，从 gRPC 流上下文中取得
+func (gc *gRPCConn) RemoteAddr() string {
+	if gc.ccs == nil {
+		return ""
+	}
+
+	p, ok := peer.FromContext(gc.ccs.Context())
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	return p.Addr.String()
+}
+
+// TLS 连接状态，从 gRPC 流上下文的认证信息中取得
+func (gc *gRPCConn) TLSState() *tls.ConnectionState {
+	if gc.ccs == nil {
+		return nil
+	}
+
+	p, ok := peer.FromContext(gc.ccs.Context())
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	return &info.State
+}
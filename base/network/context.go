@@ -1,10 +1,13 @@
 // context 被设计用于在 BaseRequest 的路由分发上，装载了 BaseRequest 和 *BaseResponse ，所有的 RouteHandleFunc 函数只接收一个
 // context 的接口(即为实现的指针)，context 可以读取请求和发送多次响应，调用 Done() 函数即在调用链中截止
+// context 持有一个标准库 context.Context ，源自请求所属 Item ，在 Item 关闭、Service 关闭或路由超时时被取消，
+// 可以通过 Context() 取得并传入数据库等调用中
 package network
 
 import (
-	"encoding/json"
+	oContext "context"
 	"errors"
+	"time"
 )
 
 type (
@@ -13,6 +16,9 @@ type (
 		// 获取请求
 		Request() Message
 
+		// 匹配到的路由名，模式路由为模式本身，模块或路由不存在时为空，可用作取值有限的指标标签
+		Route() string
+
 		// 设置额外信息
 		SetExtra(string, interface{})
 
@@ -25,6 +31,9 @@ type (
 		// 原始数据返回，不经过 Reply 结构包含，常用于跨服务调用时，中间曾转发
 		BinaryReply(d []byte) error
 
+		// 以 Reply 结构回复
+		Reply(Reply) error
+
 		// 请求成功回复
 		Success([]byte) error
 
@@ -37,18 +46,65 @@ type (
 		// 钩住查询 Item 的函数
 		HookFind(func(string) (Item, error))
 
+		// 钩住端管理者，用于组操作
+		HookManager(Manager)
+
+		// 钩住集群，本地找不到连接时经由集群投递
+		HookCluster(Cluster)
+
+		// 投递到用户绑定的所有连接，包括其他节点
+		SendToUser(string, Message) error
+
+		// 踢掉指定 id 的连接，包括其他节点
+		Kick(string) error
+
+		// 当前连接加入组
+		JoinGroup(string) error
+
+		// 当前连接退出组
+		LeaveGroup(string) error
+
+		// 向组内所有成员广播
+		Broadcast(string, Message) error
+
+		// 将用户键绑定到当前连接
+		Bind(string) error
+
+		// 解除当前连接的用户绑定，包括集群中的登记
+		Unbind() error
+
+		// 当前连接绑定的用户键，未绑定时为空
+		UserKey() string
+
+		// 当前连接的认证主体，未认证时为 nil
+		Principal() interface{}
+
 		// 结束调用链传递
 		Done()
 
 		// 是否已经结束
 		IsDone() bool
+
+		// 获取标准库上下文，在 Item 关闭、Service 关闭或路由超时时被取消
+		Context() oContext.Context
+
+		// 钩住当前连接使用的编解码器
+		HookCodec(Codec)
+
+		// 当前连接使用的编解码器，默认为 JSONCodec()
+		Codec() Codec
 	}
 
 	// 上下文定义实现
 	context struct {
+		ctx      oContext.Context           // 标准库上下文
 		request  Message                    // 请求
+		route    string                     // 匹配到的路由名
 		done     bool                       // 是否中断调用链
 		findFunc func(string) (Item, error) // 寻找响应调用
+		manager  Manager                    // 端管理者
+		cluster  Cluster                    // 集群
+		codec    Codec                      // 编解码器
 		extra    map[string]interface{}     // 额外附带信息
 	}
 )
@@ -56,23 +112,57 @@ type (
 // 此常量组定义了 Context 定义及实现中可能会发生的错误文本
 const (
 	ErrNilFindFuncText = "find function is nil"
+	ErrNilManagerText  = "manager is nil"
 )
 
 // 此变量组定义了 Context 定义及实现中可能会发生的错误
 var (
 	// 寻找 Item 函数为 nil 错误
 	ErrNilFindFunc = errors.New(ErrNilFindFuncText)
+	// 端管理者为 nil 错误
+	ErrNilManager = errors.New(ErrNilManagerText)
 )
 
+// 新建上下文，持有的标准库上下文为 context.Background()
 func NewContext(request Message) Context {
 	return &context{
+		ctx:      oContext.Background(),
 		request:  request,
 		done:     false, // 默认未结束调用链
 		findFunc: nil,   // 默认不持有任何查找 Item 函数
+		codec:    JSONCodec(),
 		extra:    map[string]interface{}{},
 	}
 }
 
+// 新建请求上下文，标准库上下文派生自 parent ，timeout 大于零时附带超时，route 为匹配到的路由名
+// 返回的 CancelFunc 必须在调用链结束后调用，以释放资源
+func newRequestContext(parent oContext.Context, timeout time.Duration, request Message, route string) (Context, oContext.CancelFunc) {
+	if parent == nil {
+		parent = oContext.Background()
+	}
+
+	var (
+		ctx    oContext.Context
+		cancel oContext.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = oContext.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancel = oContext.WithCancel(parent)
+	}
+
+	return &context{
+		ctx:      ctx,
+		request:  request,
+		route:    route,
+		done:     false,
+		findFunc: nil,
+		codec:    JSONCodec(),
+		extra:    map[string]interface{}{},
+	}, cancel
+}
+
 // 获取请求
 func (c *context) Request() Message {
 	// 复制持有的请求
@@ -80,6 +170,11 @@ func (c *context) Request() Message {
 	return request
 }
 
+// 匹配到的路由名
+func (c *context) Route() string {
+	return c.route
+}
+
 // 设置额外信息
 func (c *context) SetExtra(key string, value interface{}) {
 	c.extra[key] = value
@@ -101,6 +196,109 @@ func (c *context) HookFind(findFunc func(string) (Item, error)) {
 	}
 }
 
+// 钩住端管理者
+func (c *context) HookManager(manager Manager) {
+	if manager != nil {
+		c.manager = manager
+	}
+}
+
+// 钩住集群
+func (c *context) HookCluster(cluster Cluster) {
+	if cluster != nil {
+		c.cluster = cluster
+	}
+}
+
+// 投递到用户绑定的所有连接，包括其他节点
+func (c *context) SendToUser(userKey string, message Message) error {
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return sendToUser(c.manager, c.cluster, userKey, message)
+}
+
+// 踢掉指定 id 的连接，包括其他节点
+func (c *context) Kick(id string) error {
+	if id == "" {
+		return ErrNilId
+	}
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return kick(c.manager, c.cluster, id)
+}
+
+// 当前连接加入组
+func (c *context) JoinGroup(group string) error {
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return c.manager.JoinGroup(group, c.request.ID)
+}
+
+// 当前连接退出组
+func (c *context) LeaveGroup(group string) error {
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return c.manager.LeaveGroup(group, c.request.ID)
+}
+
+// 向组内所有成员广播
+func (c *context) Broadcast(group string, message Message) error {
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return broadcastGroup(c.manager, c.cluster, group, message)
+}
+
+// 将用户键绑定到当前连接
+func (c *context) Bind(userKey string) error {
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return bindUser(c.manager, c.cluster, c.request.ID, userKey)
+}
+
+// 解除当前连接的用户绑定
+func (c *context) Unbind() error {
+	if c.manager == nil {
+		return ErrNilManager
+	}
+
+	return c.manager.UnbindUser(c.request.ID)
+}
+
+// 当前连接绑定的用户键
+func (c *context) UserKey() string {
+	if c.manager == nil {
+		return ""
+	}
+
+	return c.manager.UserKey(c.request.ID)
+}
+
+// 当前连接的认证主体
+func (c *context) Principal() interface{} {
+	if c.findFunc == nil {
+		return nil
+	}
+
+	i, err := c.findFunc(c.request.ID)
+	if err != nil {
+		return nil
+	}
+
+	return i.Principal()
+}
+
 // 结束调用链传递
 func (c *context) Done() {
 	c.done = true
@@ -111,6 +309,11 @@ func (c *context) IsDone() bool {
 	return c.done
 }
 
+// 获取标准库上下文
+func (c *context) Context() oContext.Context {
+	return c.ctx
+}
+
 // 根据 id 查询和调用 Item 的 Send() 函数
 func (c *context) FindAndSendReply(id, reply string, data []byte) error {
 	if id == "" {
@@ -120,18 +323,24 @@ func (c *context) FindAndSendReply(id, reply string, data []byte) error {
 		return ErrNilFindFunc
 	}
 
+	message := Message{
+		ID:    id,
+		Data:  data,
+		Reply: reply,
+	}
+
 	// 查找 Item
 	i, err := c.findFunc(id)
 	if err != nil {
+		// 本地不存在时经由集群投递
+		if err == ErrItemUnExist && c.cluster != nil {
+			return c.cluster.SendTo(id, message)
+		}
 		return err
 	}
 
 	// 发送消息
-	i.Send(Message{
-		ID:    id,
-		Data:  data,
-		Reply: reply,
-	})
+	i.Send(message)
 
 	return nil
 }
@@ -141,10 +350,9 @@ func (c *context) BinaryReply(d []byte) error {
 	return c.FindAndSendReply(c.request.ID, c.request.Reply, d)
 }
 
-// 请求成功回复
-func (c *context) Success(d []byte) error {
-	reply := ReplySuccess(d)
-	data, err := json.Marshal(&reply)
+// 以 Reply 结构回复，Reply 以当前连接使用的编解码器序列化
+func (c *context) Reply(reply Reply) error {
+	data, err := c.codec.Marshal(&reply)
 	if err != nil {
 		return err
 	}
@@ -152,22 +360,29 @@ func (c *context) Success(d []byte) error {
 	return c.FindAndSendReply(c.request.ID, c.request.Reply, data)
 }
 
+// 请求成功回复
+func (c *context) Success(d []byte) error {
+	return c.Reply(ReplySuccess(d))
+}
+
 // 请求错误回复
 func (c *context) BadRequest(str string) error {
-	reply := ReplyBadRequest([]byte(str))
-	data, err := json.Marshal(&reply)
-	if err != nil {
-		return err
-	}
-	return c.FindAndSendReply(c.request.ID, c.request.Reply, data)
+	return c.Reply(ReplyBadRequest([]byte(str)))
 }
 
 // 服务器错误回复
 func (c *context) ServerError(e error) error {
-	reply := ReplyServerError([]byte(e.Error()))
-	data, err := json.Marshal(&reply)
-	if err != nil {
-		return err
+	return c.Reply(ReplyServerError([]byte(e.Error())))
+}
+
+// 钩住当前连接使用的编解码器
+func (c *context) HookCodec(codec Codec) {
+	if codec != nil {
+		c.codec = codec
 	}
-	return c.FindAndSendReply(c.request.ID, c.request.Reply, data)
+}
+
+// 当前连接使用的编解码器
+func (c *context) Codec() Codec {
+	return c.codec
 }
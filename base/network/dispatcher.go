@@ -0,0 +1,400 @@
+// Dispatcher 负责将 Service 路由后的请求交由固定数量的工作者执行，取代每条消息一个线程的做法
+// Dispatcher 持有一个有界队列，队列已满时按 DispatchPolicy 处理：阻塞、丢弃最新、丢弃最旧、回复过载
+// Dispatcher 统计排队中、执行中以及累计被拒绝的任务数目
+// Task.Key 不为空的任务进入以 Key 区分的串行通道，同一通道内的任务按分发顺序逐个执行，不同通道之间依旧并发，
+// 通道在队列中以一个通道执行者排队，通道清空后即被移除
+// 队列长度是所有排队中任务的共同上限，串行通道内积压的任务同样占据位置，因此总积压不会随通道数目增长
+package network
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// 分发策略，队列已满时的处理方式
+	DispatchPolicy int
+
+	// 分发模式
+	DispatchMode int
+
+	// 分发任务
+	Task struct {
+		Message Message // 任务所属请求
+		Key     string  // 串行通道键，为空时并发执行，不为空时同一键的任务按分发顺序串行执行
+		Run     func()  // 执行函数
+		Discard func()  // 丢弃函数，任务被拒绝或分发器停止时未执行的任务会调用此函数，可为 nil
+	}
+
+	// 串行通道
+	lane struct {
+		tasks []Task // 积压的任务
+	}
+
+	// 分发统计
+	DispatchStats struct {
+		Queued   int64 // 排队中
+		Running  int64 // 执行中
+		Rejected int64 // 累计被拒绝
+	}
+
+	// 分发器定义
+	Dispatcher interface {
+		// 启动工作者，重复调用只生效一次
+		Start()
+
+		// 分发任务，队列已满时按策略处理，任务被拒绝时返回 ErrDispatcherOverload
+		Dispatch(Task) error
+
+		// 钩住过载反馈函数，DispatchPolicyReply 策略下被拒绝任务的请求会传入此函数
+		HookOverload(func(Message))
+
+		// 统计
+		Stats() DispatchStats
+
+		// 停止，队列中未执行的任务将被丢弃
+		Stop()
+	}
+
+	// 分发器定义实现
+	// 原子操作的计数置于结构起始，保证 32 位平台上的 64 位对齐
+	dispatcher struct {
+		running   int64            // 执行中
+		rejected  int64            // 累计被拒绝
+		workers   int              // 工作者数目
+		policy    DispatchPolicy   // 队列已满时的策略
+		slots     chan struct{}    // 排队位置，每个排队中的任务持有一个，长度即排队中的任务数目
+		queue     chan Task        // 有界队列，存放并发任务及通道执行者
+		overload  func(Message)    // 过载反馈函数
+		stop      chan struct{}    // 停止通知通道
+		startOnce sync.Once        // 启动一次
+		stopOnce  sync.Once        // 停止一次
+		lanes     map[string]*lane // 串行通道
+		laneMutex sync.Mutex       // 串行通道竞态锁
+	}
+)
+
+// 此常量组定义了 Dispatcher 的分发模式
+const (
+	DispatchModeConcurrent DispatchMode = iota // 并发，同一连接的消息在多个工作者中并发执行
+	DispatchModeOrdered                        // 有序，同一连接的消息按到达顺序串行执行
+)
+
+// 此常量组定义了 Dispatcher 的队列已满策略
+const (
+	DispatchPolicyBlock      DispatchPolicy = iota // 阻塞，直到队列有空位
+	DispatchPolicyDropNewest                       // 丢弃最新任务，即当前分发的任务
+	DispatchPolicyDropOldest                       // 丢弃队列中最旧的任务，为当前任务腾出空位
+	DispatchPolicyReply                            // 丢弃当前任务，并回复过载 Reply
+)
+
+const (
+	// 默认工作者数目
+	DefaultDispatcherWorkers = 256
+	// 默认队列长度
+	DefaultDispatcherQueueSize = 5000
+)
+
+// 此常量组定义了 Dispatcher 定义及实现中可能会发生的错误文本
+const (
+	ErrDispatcherOverloadText = "dispatcher queue is full"
+	ErrDispatcherStoppedText  = "dispatcher already stopped"
+)
+
+// 此变量组定义了 Dispatcher 定义及实现中可能会发生的错误
+var (
+	// 队列已满，任务被拒绝 错误
+	ErrDispatcherOverload = errors.New(ErrDispatcherOverloadText)
+	// 分发器已停止 错误
+	ErrDispatcherStopped = errors.New(ErrDispatcherStoppedText)
+)
+
+// 分发策略可读化
+func (dp DispatchPolicy) String() string {
+	switch dp {
+	case DispatchPolicyBlock:
+		return "Block"
+	case DispatchPolicyDropNewest:
+		return "DropNewest"
+	case DispatchPolicyDropOldest:
+		return "DropOldest"
+	case DispatchPolicyReply:
+		return "Reply"
+	default:
+		return "UnKnowPolicy"
+	}
+}
+
+// 分发模式可读化
+func (dm DispatchMode) String() string {
+	switch dm {
+	case DispatchModeConcurrent:
+		return "Concurrent"
+	case DispatchModeOrdered:
+		return "Ordered"
+	default:
+		return "UnKnowMode"
+	}
+}
+
+// 默认分发器
+func DefaultDispatcher() Dispatcher {
+	return NewDispatcher(DefaultDispatcherWorkers, DefaultDispatcherQueueSize, DispatchPolicyBlock)
+}
+
+// 新建分发器
+// workers : 工作者数目，小于等于零时为默认值 256
+// queueSize : 队列长度，所有排队中任务（包括串行通道内积压的任务）的共同上限，小于等于零时为默认值 5000
+// policy : 队列已满时的策略
+func NewDispatcher(workers, queueSize int, policy DispatchPolicy) Dispatcher {
+	if workers <= 0 {
+		workers = DefaultDispatcherWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultDispatcherQueueSize
+	}
+
+	return &dispatcher{
+		workers:  workers,
+		policy:   policy,
+		slots:    make(chan struct{}, queueSize),
+		queue:    make(chan Task, queueSize),
+		overload: nil,
+		stop:     make(chan struct{}),
+		lanes:    make(map[string]*lane),
+	}
+}
+
+// 启动工作者
+func (d *dispatcher) Start() {
+	d.startOnce.Do(func() {
+		for i := 0; i < d.workers; i++ {
+			go d.work()
+		}
+	})
+}
+
+// 分发任务
+func (d *dispatcher) Dispatch(task Task) error {
+	if task.Run == nil {
+		d.discard(task)
+		return ErrNilHandleFunc
+	}
+
+	select {
+	case <-d.stop:
+		d.discard(task)
+		return ErrDispatcherStopped
+	default:
+	}
+
+	// 先取得排队位置，串行任务同样占据一个位置
+	if err := d.acquire(task); err != nil {
+		return err
+	}
+
+	// 串行任务进入通道
+	if task.Key != "" {
+		d.dispatchLane(task)
+		return nil
+	}
+
+	// 队列中的每个任务及通道执行者都持有一个位置，取得位置后队列必然有空位
+	d.queue <- task
+	return nil
+}
+
+// 取得一个排队位置，所有排队中的任务共用队列长度，位置已满时按策略处理
+func (d *dispatcher) acquire(task Task) error {
+	switch d.policy {
+	case DispatchPolicyDropNewest, DispatchPolicyReply:
+		select {
+		case d.slots <- struct{}{}:
+			return nil
+		default:
+			d.reject(task)
+			return ErrDispatcherOverload
+		}
+	case DispatchPolicyDropOldest:
+		for {
+			select {
+			case d.slots <- struct{}{}:
+				return nil
+			default:
+			}
+
+			// 位置已满，取出队列中最旧的任务丢弃，通道执行者本身不占据位置，丢弃整个通道
+			select {
+			case oldest := <-d.queue:
+				if oldest.Key != "" {
+					d.dropLane(oldest.Key, true)
+					continue
+				}
+				d.release()
+				d.reject(oldest)
+			default:
+				// 队列为空，积压都在执行中的通道内，没有可以丢弃的最旧任务，拒绝当前任务
+				d.reject(task)
+				return ErrDispatcherOverload
+			}
+		}
+	default:
+		select {
+		case d.slots <- struct{}{}:
+			return nil
+		case <-d.stop:
+			d.discard(task)
+			return ErrDispatcherStopped
+		}
+	}
+}
+
+// 释放一个排队位置
+func (d *dispatcher) release() {
+	<-d.slots
+}
+
+// 钩住过载反馈函数
+func (d *dispatcher) HookOverload(function func(Message)) {
+	if function != nil {
+		d.overload = function
+	}
+}
+
+// 统计
+func (d *dispatcher) Stats() DispatchStats {
+	return DispatchStats{
+		Queued:   int64(len(d.slots)),
+		Running:  atomic.LoadInt64(&d.running),
+		Rejected: atomic.LoadInt64(&d.rejected),
+	}
+}
+
+// 停止
+func (d *dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+
+		// 丢弃队列中未执行的任务，通道执行者本身不占据位置，由其丢弃函数丢弃整个通道
+		for {
+			select {
+			case task := <-d.queue:
+				if task.Key == "" {
+					d.release()
+				}
+				d.discard(task)
+			default:
+				return
+			}
+		}
+	})
+}
+
+// 工作者，循环从队列中取出任务执行
+func (d *dispatcher) work() {
+	for {
+		select {
+		case <-d.stop:
+			return
+		case task := <-d.queue:
+			// 通道执行者自行释放位置
+			if task.Key != "" {
+				task.Run()
+				continue
+			}
+
+			d.release()
+			atomic.AddInt64(&d.running, 1)
+			task.Run()
+			atomic.AddInt64(&d.running, -1)
+		}
+	}
+}
+
+// 分发已取得位置的串行任务，通道存在时追加到通道末尾，不存在时新建通道并将通道执行者放入队列
+func (d *dispatcher) dispatchLane(task Task) {
+	d.laneMutex.Lock()
+	if l, exist := d.lanes[task.Key]; exist {
+		l.tasks = append(l.tasks, task)
+		d.laneMutex.Unlock()
+		return
+	}
+	d.lanes[task.Key] = &lane{tasks: []Task{task}}
+	d.laneMutex.Unlock()
+
+	// 通道的第一个任务持有位置直到通道执行者开始执行，队列必然有空位
+	d.queue <- Task{
+		Message: task.Message,
+		Key:     task.Key,
+		Run:     func() { d.runLane(task.Key) },
+		Discard: func() { d.dropLane(task.Key, false) },
+	}
+}
+
+// 通道执行者，逐个执行通道内的任务直到通道清空
+func (d *dispatcher) runLane(key string) {
+	for {
+		d.laneMutex.Lock()
+		l, exist := d.lanes[key]
+		if !exist {
+			d.laneMutex.Unlock()
+			return
+		}
+		if len(l.tasks) == 0 {
+			delete(d.lanes, key)
+			d.laneMutex.Unlock()
+			return
+		}
+
+		task := l.tasks[0]
+		l.tasks = l.tasks[1:]
+		d.laneMutex.Unlock()
+		d.release()
+
+		atomic.AddInt64(&d.running, 1)
+		task.Run()
+		atomic.AddInt64(&d.running, -1)
+	}
+}
+
+// 移除整个通道，reject 为 true 时通道内所有任务都被拒绝，否则仅丢弃
+func (d *dispatcher) dropLane(key string, reject bool) {
+	d.laneMutex.Lock()
+	l, exist := d.lanes[key]
+	if exist {
+		delete(d.lanes, key)
+	}
+	d.laneMutex.Unlock()
+
+	if !exist {
+		return
+	}
+
+	for _, task := range l.tasks {
+		d.release()
+		if reject {
+			d.reject(task)
+		} else {
+			d.discard(task)
+		}
+	}
+}
+
+// 拒绝任务，计数后丢弃，DispatchPolicyReply 策略下反馈过载
+func (d *dispatcher) reject(task Task) {
+	atomic.AddInt64(&d.rejected, 1)
+
+	if d.policy == DispatchPolicyReply && d.overload != nil {
+		d.overload(task.Message)
+	}
+
+	d.discard(task)
+}
+
+// 丢弃任务
+func (d *dispatcher) discard(task Task) {
+	if task.Discard != nil {
+		task.Discard()
+	}
+}
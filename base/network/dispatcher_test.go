@@ -0,0 +1,150 @@
+package network
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 计数丢弃次数的任务
+func countingTask(key string, discarded *int64) Task {
+	return Task{
+		Key:     key,
+		Run:     func() {},
+		Discard: func() { atomic.AddInt64(discarded, 1) },
+	}
+}
+
+func TestDispatcherNilRun(t *testing.T) {
+	d := NewDispatcher(1, 2, DispatchPolicyBlock)
+	discarded := int64(0)
+
+	// 没有执行函数的任务同样需要通知丢弃
+	task := countingTask("", &discarded)
+	task.Run = nil
+	if err := d.Dispatch(task); err != ErrNilHandleFunc {
+		t.Fatalf("dispatch = %v , want %v", err, ErrNilHandleFunc)
+	}
+	if n := atomic.LoadInt64(&discarded); n != 1 {
+		t.Fatalf("discarded = %d , want 1", n)
+	}
+	d.Stop()
+}
+
+func TestDispatcherDropOldestLaneAccounting(t *testing.T) {
+	// 不启动工作者，任务只排队
+	d := NewDispatcher(1, 2, DispatchPolicyDropOldest)
+	discarded := int64(0)
+
+	// 通道 a 的两个任务，队列中只有一个通道执行者
+	for i := 0; i < 2; i++ {
+		if err := d.Dispatch(countingTask("a", &discarded)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第二个并发任务使队列已满，最旧的通道执行者被取出，通道内的两个任务都被拒绝
+	for i := 0; i < 2; i++ {
+		if err := d.Dispatch(countingTask("", &discarded)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := d.Stats(); stats.Queued != 2 || stats.Rejected != 2 {
+		t.Fatalf("stats = %+v , want queued 2 rejected 2", stats)
+	}
+	if n := atomic.LoadInt64(&discarded); n != 2 {
+		t.Fatalf("discarded = %d , want 2", n)
+	}
+
+	d.Stop()
+	if stats := d.Stats(); stats.Queued != 0 || stats.Rejected != 2 {
+		t.Fatalf("stats after stop = %+v , want queued 0 rejected 2", stats)
+	}
+	if n := atomic.LoadInt64(&discarded); n != 4 {
+		t.Fatalf("discarded after stop = %d , want 4", n)
+	}
+}
+
+func TestDispatcherStopLaneAccounting(t *testing.T) {
+	d := NewDispatcher(1, 4, DispatchPolicyBlock)
+	discarded := int64(0)
+
+	for _, key := range []string{"a", "a", "b", ""} {
+		if err := d.Dispatch(countingTask(key, &discarded)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := d.Stats(); stats.Queued != 4 {
+		t.Fatalf("queued = %d , want 4", stats.Queued)
+	}
+
+	d.Stop()
+	if stats := d.Stats(); stats.Queued != 0 || stats.Rejected != 0 {
+		t.Fatalf("stats after stop = %+v , want queued 0 rejected 0", stats)
+	}
+	if n := atomic.LoadInt64(&discarded); n != 4 {
+		t.Fatalf("discarded = %d , want 4", n)
+	}
+	if err := d.Dispatch(countingTask("a", &discarded)); err != ErrDispatcherStopped {
+		t.Fatalf("dispatch after stop = %v , want %v", err, ErrDispatcherStopped)
+	}
+}
+
+func TestDispatcherLaneCapacity(t *testing.T) {
+	// 串行通道内积压的任务与并发任务共用队列长度，不随通道数目增长
+	d := NewDispatcher(1, 3, DispatchPolicyDropNewest)
+	discarded := int64(0)
+
+	for _, key := range []string{"a", "b", "a"} {
+		if err := d.Dispatch(countingTask(key, &discarded)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"c", "a", ""} {
+		if err := d.Dispatch(countingTask(key, &discarded)); err != ErrDispatcherOverload {
+			t.Fatalf("dispatch [%s] = %v , want %v", key, err, ErrDispatcherOverload)
+		}
+	}
+	if stats := d.Stats(); stats.Queued != 3 || stats.Rejected != 3 {
+		t.Fatalf("stats = %+v , want queued 3 rejected 3", stats)
+	}
+	d.Stop()
+}
+
+func TestDispatcherOrderedLanes(t *testing.T) {
+	d := NewDispatcher(4, 8, DispatchPolicyBlock)
+	d.Start()
+	defer d.Stop()
+
+	const tasks = 200
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		orders = map[string][]int{}
+	)
+	for i := 0; i < tasks; i++ {
+		key := []string{"a", "b", "c"}[i%3]
+		index := i
+		wg.Add(1)
+		if err := d.Dispatch(Task{Key: key, Run: func() {
+			mutex.Lock()
+			orders[key] = append(orders[key], index)
+			mutex.Unlock()
+			wg.Done()
+		}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	for key, order := range orders {
+		for i := 1; i < len(order); i++ {
+			if order[i] < order[i-1] {
+				t.Fatalf("lane [%s] out of order : %v", key, order)
+			}
+		}
+	}
+	if stats := d.Stats(); stats.Queued != 0 || stats.Rejected != 0 {
+		t.Fatalf("stats = %+v , want queued 0 rejected 0", stats)
+	}
+}
@@ -1,5 +1,10 @@
 package network
 
+import (
+	"errors"
+	"strconv"
+)
+
 type (
 	// 加密器定义
 	Encrypter interface {
@@ -15,6 +20,9 @@ type (
 	// 解密函数签名
 	DecryptionFunc func(uint8, []uint8) []uint8
 
+	// 直通加密器实现，不加密，供 PlainConn 使用
+	plainEncrypter struct{}
+
 	// 二维空间置换算法
 	SETer struct {
 		key           string           // 密钥
@@ -31,9 +39,19 @@ const (
 	DefaultEncryptionKey = "jarvis"
 )
 
-var ()
+// 此常量组定义了 Encrypter 定义及实现中可能会发生的错误文本
+const (
+	ErrEncrypterNotByteSafeText = "encrypter can not restore arbitrary bytes"
+)
+
+var (
+	// 加密器不能还原任意字节，不能配合二进制编解码器或压缩器使用 错误
+	ErrEncrypterNotByteSafe = errors.New(ErrEncrypterNotByteSafeText)
+)
 
 // 默认加密器
+// 补位以 0 填充，解密时去除末尾的 0 ，因此只能还原 JSON 等文本数据，不能还原任意字节
+// 不具备认证及防重放能力，仅供旧客户端使用，新客户端应当使用 NewSessionEncrypter()
 func DefaultEncrypter() Encrypter {
 	return NewSETer(DefaultEncryptionKey, DefaultCommonDivisor)
 }
@@ -283,6 +301,28 @@ func (s *SETer) revSpaceExchange(n uint8, v []uint8) []uint8 {
 	return append(a, d...)
 }
 
+// 加密器的标识，标识相同的加密器对同一数据加密出相同的密文，不是内置实现或使用会话密钥时无法判断，返回空字符串
+func encrypterIdentity(encrypter Encrypter) string {
+	switch e := encrypter.(type) {
+	case *SETer:
+		return "seter:" + strconv.Itoa(e.commonDivisor) + ":" + e.key
+	case plainEncrypter:
+		return "plain"
+	default:
+		return ""
+	}
+}
+
+// 加密器是否能够还原任意字节，需要密钥交换的加密器及直通加密器可以，SETer 的补位会去除末尾的 0 ，不可以
+// 二进制编解码器及压缩器只能配合能够还原任意字节的加密器使用
+func byteSafe(encrypter Encrypter) bool {
+	if _, ok := encrypter.(KeyExchanger); ok {
+		return true
+	}
+	_, ok := encrypter.(plainEncrypter)
+	return ok
+}
+
 // 最大公约数
 func maxCommonDivisor(a, b int) int {
 	if a == 0 {
@@ -323,3 +363,14 @@ func reverse(v []uint8) []uint8 {
 	}
 	return a
 }
+
+// -------------------------------------------------- plainEncrypter ---------------------------------------------------
+// 加密，原样返回
+func (plainEncrypter) Encrypt(data []byte) []byte {
+	return data
+}
+
+// 解密，原样返回
+func (plainEncrypter) Decrypt(data []byte) []byte {
+	return data
+}
@@ -0,0 +1,34 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSETerRoundTrip(t *testing.T) {
+	e := DefaultEncrypter()
+	for _, data := range []string{"j", "jarvis", `{"module":"test","route":"echo","data":"AAEC"}`, string(bytes.Repeat([]byte("jarvis"), 100))} {
+		encrypted := e.Encrypt([]byte(data))
+		if bytes.Equal(encrypted, []byte(data)) {
+			t.Fatalf("%q must be encrypted", data)
+		}
+		if plain := e.Decrypt(encrypted); string(plain) != data {
+			t.Fatalf("round trip = %q , want %q", plain, data)
+		}
+	}
+
+	// 补位的 0 在解密时去除，末尾为 0 的任意字节无法还原
+	data := []byte{'j', 0, 0}
+	if plain := e.Decrypt(e.Encrypt(data)); bytes.Equal(plain, data) {
+		t.Fatal("trailing zeros are expected to be lost")
+	}
+}
+
+func TestByteSafe(t *testing.T) {
+	if byteSafe(DefaultEncrypter()) {
+		t.Fatal("SETer must not be byte safe")
+	}
+	if !byteSafe(plainEncrypter{}) || !byteSafe(NewSessionEncrypter(CipherAESGCM)) {
+		t.Fatal("plain and session encrypters must be byte safe")
+	}
+}
@@ -0,0 +1,270 @@
+// FramePackager 是带版本的紧凑二进制装包者，与 DefaultPackager() 并存，由 Service.SetPackager() 及客户端构造函数选用
+// 数据帧格式，多字节整数均为大端序：
+//
+//	+--------+---------+-------+----------+---------+------------+
+//	| 2 魔数 | 1 版本  | 1 标志 | 4 长度   | 数据     | 4 CRC32    |
+//	+--------+---------+-------+----------+---------+------------+
+//
+// 魔数为 FrameMagic ，版本为 FrameVersion ，长度为数据的长度，CRC32 仅在标志包含 FrameFlagChecksum 时存在，为数据的 IEEE 校验和
+// 解包时对收到的数据帧按标志校验 CRC32 ，是否附带校验只由发送方决定
+// 损坏的输入：魔数或版本不匹配、校验失败时记一次装包者错误，从该位置的下一个字节开始寻找下一个魔数，丢弃其间的数据
+// 超过最大长度：长度大于 MaxFrameSize 时不再等待数据，清空缓存，Err() 返回 ErrFrameTooLarge ，此后不再解包，使用者应当关闭连接
+// 标志位：Item 及客户端发送时以 FrameFlagCompressed 标记已压缩的数据，此时数据内不再附带压缩标志；
+// 以 FrameFlagEncrypted 标记会话密钥加密的数据，以 FrameFlagHeartbeat 标记心跳，以 FrameFlagHandshake 标记密钥交换握手
+// 接收时按标志位解压，会话密钥加密的连接上缺少 FrameFlagEncrypted 、握手数据帧缺少 FrameFlagHandshake 时返回 ErrFrameFlags 并关闭连接，
+// 带有 FrameFlagHeartbeat 的数据帧不会进入服务的进入流
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+type (
+	// 数据帧标志位
+	FrameFlag uint8
+
+	// 数据帧
+	Frame struct {
+		Flags FrameFlag // 标志位
+		Data  []byte    // 数据
+	}
+
+	// 带标志位的装包者定义
+	FlagPackager interface {
+		Packager
+
+		// 以指定标志位打包
+		PackFlags([]byte, FrameFlag) []byte
+
+		// 解包，同时返回每个数据帧的标志位
+		UnpackFrames([]byte) []Frame
+
+		// 致命错误，不为 nil 时不再解包，使用者应当关闭连接
+		Err() error
+	}
+
+	// 带版本装包者选项
+	FrameOption struct {
+		Checksum     bool // 打包时是否附带 CRC32 校验
+		MaxFrameSize int  // 数据最大长度，小于等于零时为 DefaultMaxFrameSize
+	}
+
+	// 带版本装包者实现
+	framePackager struct {
+		option FrameOption // 选项
+		buffer []byte      // 缓存
+		err    error       // 致命错误
+	}
+)
+
+// 此常量组定义了数据帧的格式
+const (
+	FrameMagic          = "JV"            // 魔数
+	FrameVersion        = 1               // 协议版本
+	FrameHeaderLen      = 8               // 头部长度，魔数 2 + 版本 1 + 标志 1 + 长度 4
+	FrameChecksumLen    = 4               // CRC32 校验长度
+	DefaultMaxFrameSize = 4 * 1024 * 1024 // 默认数据最大长度
+)
+
+// 此常量组定义了数据帧的标志位
+const (
+	FrameFlagCompressed FrameFlag = 1 << iota // 数据已压缩
+	FrameFlagEncrypted                        // 数据已加密
+	FrameFlagHeartbeat                        // 心跳
+	FrameFlagChecksum                         // 附带 CRC32 校验
+	FrameFlagHandshake                        // 密钥交换握手
+)
+
+// 此常量组定义了 FramePackager 定义及实现中可能会发生的错误文本
+const (
+	ErrFrameTooLargeText = "frame exceeds max frame size"
+	ErrFrameFlagsText    = "frame flags don't match the connection"
+)
+
+var (
+	// 数据帧超过最大长度 错误
+	ErrFrameTooLarge = errors.New(ErrFrameTooLargeText)
+	// 数据帧标志位与连接不符 错误
+	ErrFrameFlags = errors.New(ErrFrameFlagsText)
+)
+
+// 新建带版本装包者
+func NewFramePackager(option FrameOption) FlagPackager {
+	if option.MaxFrameSize <= 0 {
+		option.MaxFrameSize = DefaultMaxFrameSize
+	}
+
+	return &framePackager{
+		option: option,
+		buffer: make([]byte, 0),
+		err:    nil,
+	}
+}
+
+// 是否包含标志位
+func (f FrameFlag) Has(flag FrameFlag) bool {
+	return f&flag == flag
+}
+
+// 消息对应的数据帧标志位
+func messageFlags(heartbeat Heartbeat, message Message) FrameFlag {
+	if heartbeat.IsPing(message) || heartbeat.IsPong(message) {
+		return FrameFlagHeartbeat
+	}
+
+	return 0
+}
+
+// 装包者是否支持标志位
+func hasFlags(packager Packager) bool {
+	_, ok := packager.(FlagPackager)
+	return ok
+}
+
+// 打包，装包者支持标志位时附带标志位
+func pack(packager Packager, data []byte, flags FrameFlag) []byte {
+	if fp, ok := packager.(FlagPackager); ok {
+		return fp.PackFlags(data, flags)
+	}
+
+	return packager.Pack(data)
+}
+
+// 解包，装包者支持标志位时一并返回每个数据帧的标志位及其致命错误，不支持时标志位均为 0
+func unpack(packager Packager, data []byte) ([]Frame, error) {
+	if fp, ok := packager.(FlagPackager); ok {
+		return fp.UnpackFrames(data), fp.Err()
+	}
+
+	datas := packager.Unpack(data)
+	frames := make([]Frame, 0, len(datas))
+	for _, d := range datas {
+		frames = append(frames, Frame{Data: d})
+	}
+
+	return frames, nil
+}
+
+// 克隆一个同类装包者，选项相同，缓存及错误不复制
+func (p *framePackager) Clone() Packager {
+	return NewFramePackager(p.option)
+}
+
+// 打包
+func (p *framePackager) Pack(data []byte) []byte {
+	return p.PackFlags(data, 0)
+}
+
+// 以指定标志位打包，FrameFlagChecksum 由选项决定
+func (p *framePackager) PackFlags(data []byte, flags FrameFlag) []byte {
+	flags &^= FrameFlagChecksum
+	size := FrameHeaderLen + len(data)
+	if p.option.Checksum {
+		flags |= FrameFlagChecksum
+		size += FrameChecksumLen
+	}
+
+	frame := make([]byte, FrameHeaderLen, size)
+	copy(frame, FrameMagic)
+	frame[2] = FrameVersion
+	frame[3] = byte(flags)
+	binary.BigEndian.PutUint32(frame[4:FrameHeaderLen], uint32(len(data)))
+	frame = append(frame, data...)
+	if p.option.Checksum {
+		frame = append(frame, make([]byte, FrameChecksumLen)...)
+		binary.BigEndian.PutUint32(frame[size-FrameChecksumLen:], crc32.ChecksumIEEE(data))
+	}
+
+	return frame
+}
+
+// 解包
+func (p *framePackager) Unpack(data []byte) [][]byte {
+	frames := p.UnpackFrames(data)
+	datas := make([][]byte, 0, len(frames))
+	for _, frame := range frames {
+		datas = append(datas, frame.Data)
+	}
+
+	return datas
+}
+
+// 解包，同时返回每个数据帧的标志位
+func (p *framePackager) UnpackFrames(data []byte) []Frame {
+	frames := make([]Frame, 0)
+	if p.err != nil {
+		return frames
+	}
+
+	p.buffer = append(p.buffer, data...)
+
+	i := 0
+	for len(p.buffer)-i >= FrameHeaderLen {
+		rest := p.buffer[i:]
+
+		// 魔数或版本不匹配，寻找下一个魔数
+		if string(rest[:len(FrameMagic)]) != FrameMagic || rest[2] != FrameVersion {
+			metricPackagerErrors.Inc()
+			i += p.resync(rest)
+			continue
+		}
+
+		flags := FrameFlag(rest[3])
+		length := int(binary.BigEndian.Uint32(rest[4:FrameHeaderLen]))
+		if length > p.option.MaxFrameSize {
+			metricPackagerErrors.Inc()
+			p.err = ErrFrameTooLarge
+			p.buffer = nil
+			return frames
+		}
+
+		total := FrameHeaderLen + length
+		if flags.Has(FrameFlagChecksum) {
+			total += FrameChecksumLen
+		}
+		if len(rest) < total { // 缓存长度不足以获取完整数据，等待后续数据
+			break
+		}
+
+		payload := rest[FrameHeaderLen : FrameHeaderLen+length]
+		if flags.Has(FrameFlagChecksum) &&
+			crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(rest[total-FrameChecksumLen:total]) {
+			metricPackagerErrors.Inc()
+			i += p.resync(rest)
+			continue
+		}
+
+		// 复制数据，缓存会被后续数据覆盖
+		frames = append(frames, Frame{
+			Flags: flags,
+			Data:  append([]byte(nil), payload...),
+		})
+		i += total
+	}
+
+	// 移除已处理的数据，剩余数据移动到缓存起始位置，缓存不会无限增长
+	p.buffer = append(p.buffer[:0], p.buffer[i:]...)
+
+	return frames
+}
+
+// 从 rest 的下一个字节开始寻找魔数，返回应当跳过的字节数
+// 未找到时保留可能是魔数开头的最后一个字节
+func (p *framePackager) resync(rest []byte) int {
+	if next := bytes.Index(rest[1:], []byte(FrameMagic)); next >= 0 {
+		return next + 1
+	}
+	if rest[len(rest)-1] == FrameMagic[0] {
+		return len(rest) - 1
+	}
+
+	return len(rest)
+}
+
+// 致命错误
+func (p *framePackager) Err() error {
+	return p.err
+}
@@ -0,0 +1,211 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFramePackagerFlags(t *testing.T) {
+	p := NewFramePackager(FrameOption{Checksum: true})
+	frames := p.UnpackFrames(append(p.PackFlags([]byte("hello"), FrameFlagHandshake), p.Pack([]byte("data"))...))
+	if len(frames) != 2 {
+		t.Fatalf("frames = %d , want 2", len(frames))
+	}
+	if frames[0].Flags != FrameFlagHandshake|FrameFlagChecksum || string(frames[0].Data) != "hello" {
+		t.Fatalf("handshake frame = %+v", frames[0])
+	}
+	if frames[1].Flags != FrameFlagChecksum || string(frames[1].Data) != "data" {
+		t.Fatalf("data frame = %+v", frames[1])
+	}
+}
+
+func TestFramePackagerCompression(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPackager(NewFramePackager(FrameOption{Checksum: true})); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetEncrypter(SessionEncrypterFactory(CipherAESGCM)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetCompression(0, GzipCompressor()); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(addr))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, NewFramePackager(FrameOption{}), NewSessionEncrypter(CipherAESGCM))
+	if err := c.SetCompression(0, GzipCompressor()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 双方均以 FrameFlagCompressed 标记压缩，会话密钥加密的数据帧带有 FrameFlagEncrypted
+	data := bytes.Repeat([]byte("jarvis"), DefaultCompressThreshold)
+	response, err := c.RequestSync(Message{Module: "test", Route: "echo", Data: data, Reply: "echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := Reply{}
+	if err := JSONCodec().Unmarshal(response.Data, &reply); err != nil || !bytes.Equal(reply.Data, data) {
+		t.Fatalf("echo reply length %d , %v", len(reply.Data), err)
+	}
+	if items := s.Items(); len(items) != 1 || items[0].Compressor() == nil {
+		t.Fatal("item must compress after negotiation")
+	}
+}
+
+func TestFramePackagerUnpack(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		p := NewFramePackager(FrameOption{Checksum: checksum})
+		datas := [][]byte{[]byte("jarvis"), binaryPayload(), {}, []byte(FrameMagic)}
+		stream := make([]byte, 0)
+		for _, data := range datas {
+			stream = append(stream, p.Pack(data)...)
+		}
+
+		// 逐字节写入，数据帧被任意切分时依旧按序解出
+		unpacked := make([][]byte, 0)
+		for _, b := range stream {
+			unpacked = append(unpacked, p.Unpack([]byte{b})...)
+		}
+		if len(unpacked) != len(datas) || p.Err() != nil {
+			t.Fatalf("checksum %v : unpacked = %d , want %d , %v", checksum, len(unpacked), len(datas), p.Err())
+		}
+		for i := range datas {
+			if !bytes.Equal(unpacked[i], datas[i]) {
+				t.Fatalf("checksum %v : frame %d mismatch", checksum, i)
+			}
+		}
+	}
+}
+
+func TestFramePackagerResync(t *testing.T) {
+	p := NewFramePackager(FrameOption{Checksum: true})
+
+	corrupted := p.Pack([]byte("corrupted"))
+	corrupted[FrameHeaderLen] ^= 0xff
+	badVersion := p.Pack([]byte("version"))
+	badVersion[2] = FrameVersion + 1
+
+	stream := []byte("garbage")
+	stream = append(stream, corrupted...)
+	stream = append(stream, badVersion...)
+	stream = append(stream, p.Pack([]byte("jarvis"))...)
+
+	// 校验失败、版本不匹配的数据帧及其间的数据被丢弃，之后的数据帧正常解出
+	datas := p.Unpack(stream)
+	if len(datas) != 1 || string(datas[0]) != "jarvis" || p.Err() != nil {
+		t.Fatalf("unpacked = %q , %v , want [jarvis]", datas, p.Err())
+	}
+}
+
+func TestFramePackagerTooLarge(t *testing.T) {
+	p := NewFramePackager(FrameOption{MaxFrameSize: 8})
+	if datas := p.Unpack(p.Pack([]byte("jarvis"))); len(datas) != 1 {
+		t.Fatalf("unpacked = %d , want 1", len(datas))
+	}
+
+	// 超过最大长度时不等待数据，之后不再解包
+	if datas := p.Unpack(p.Pack([]byte("too large frame"))[:FrameHeaderLen]); len(datas) != 0 || p.Err() != ErrFrameTooLarge {
+		t.Fatalf("unpacked = %d , err = %v , want %v", len(datas), p.Err(), ErrFrameTooLarge)
+	}
+	if datas := p.Unpack(p.Pack([]byte("jarvis"))); len(datas) != 0 {
+		t.Fatal("packager must stop unpacking after a fatal error")
+	}
+
+	// 克隆的装包者选项相同，错误不复制
+	clone := p.Clone().(FlagPackager)
+	if clone.Err() != nil || len(clone.Unpack(clone.Pack([]byte("jarvis")))) != 1 {
+		t.Fatal("clone must start without error")
+	}
+	if datas := clone.Unpack(clone.Pack([]byte("too large frame"))); len(datas) != 0 || clone.Err() != ErrFrameTooLarge {
+		t.Fatal("clone must keep max frame size")
+	}
+}
+
+func TestFrameFlagsOnSend(t *testing.T) {
+	i := pipeItem(t, NewFramePackager(FrameOption{}), DefaultEncrypter()).(*item)
+	i.compressor = GzipCompressor()
+	p := NewFramePackager(FrameOption{})
+
+	// 已压缩的数据帧带有压缩标志，数据内不再附带压缩标志
+	data := bytes.Repeat([]byte("jarvis"), DefaultCompressThreshold)
+	frame, err := i.Frame(Message{Module: "test", Route: "echo", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := p.UnpackFrames(frame)
+	if len(frames) != 1 || frames[0].Flags != FrameFlagCompressed {
+		t.Fatalf("frames = %d , flags = %v , want compressed", len(frames), frames[0].Flags)
+	}
+	plain, err := GzipCompressor().Decompress(DefaultEncrypter().Decrypt(frames[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := Message{}
+	if err := JSONCodec().Unmarshal(plain, &message); err != nil || !bytes.Equal(message.Data, data) {
+		t.Fatalf("decompressed message length %d , %v", len(message.Data), err)
+	}
+
+	// 心跳带有心跳标志，低于阈值的数据不压缩
+	frame, err = i.Frame(i.heartbeat.PingMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames := p.UnpackFrames(frame); len(frames) != 1 || frames[0].Flags != FrameFlagHeartbeat {
+		t.Fatalf("heartbeat flags = %v , want %v", frames[0].Flags, FrameFlagHeartbeat)
+	}
+}
+
+func TestFrameFlagsOnReceive(t *testing.T) {
+	c, peer := net.Pipe()
+	defer peer.Close()
+	p := NewFramePackager(FrameOption{})
+	i := NewItem(NewSocketConn(c), p.Clone(), DefaultEncrypter())
+	received := make(chan Message, 2)
+	go i.Receive(received)
+
+	write := func(message Message, flags FrameFlag) {
+		data, err := JSONCodec().Marshal(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := peer.Write(p.PackFlags(DefaultEncrypter().Encrypt(data), flags)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 带心跳标志位的数据帧不进入进入流
+	write(Message{Module: "test", Route: "heartbeat"}, FrameFlagHeartbeat)
+	write(Message{Module: "test", Route: "echo"}, 0)
+	select {
+	case request := <-received:
+		if request.Route != "echo" {
+			t.Fatalf("received route %s , want echo", request.Route)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("data frame must be received")
+	}
+
+	// 没有会话密钥的连接上出现加密标志，以数据帧错误关闭
+	write(Message{Module: "test", Route: "echo"}, FrameFlagEncrypted)
+	deadline := time.Now().Add(time.Second)
+	for i.State() != ItemStateFrameErrorClose {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s , want %s", i.State(), ItemStateFrameErrorClose)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(received) != 0 {
+		t.Fatal("frame with mismatched flags must not be received")
+	}
+}
@@ -1,13 +1,19 @@
 package network
 
 import (
+	"crypto/tls"
 	"errors"
 	"github.com/gorilla/websocket"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"jarvis/base/log"
 	gRPC "jarvis/base/network/grpc"
 	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 type (
@@ -26,23 +32,52 @@ type (
 		Destroy() error
 	}
 
+	// 可以优雅关闭的入口定义，Service.Shutdown() 先调用 StopAccept() ，所有 Item 关闭后再调用 Destroy()
+	GracefulGate interface {
+		Gate
+
+		// 只停止接收新连接，已有连接保持可用
+		StopAccept() error
+	}
+
 	// 入口基础
 	baseGate struct {
-		address string // 地址
+		address   string       // 地址
+		tlsOption *TLSOption   // TLS 选项，为 nil 时不使用 TLS
+		tlsConfig *tls.Config  // Initialize() 中由 tlsOption 生成的 TLS 配置
+		f         func(Conn)   // Running() 中持有的钩子函数
+		fMutex    sync.RWMutex // 钩子函数竞态锁，挂载的入口可能在 Running() 前收到连接
 	}
 
-	// socket 入口实现
+	// socket 入口实现，同时用于 unix 域套接字
 	socketGate struct {
 		baseGate
+		name     string       // 入口名称
+		network  string       // 网络类型
 		listener net.Listener // 监听者
 	}
 
+	// websocket 入口选项，零值字段使用默认值
+	WebSocketOption struct {
+		Path              string                      // 路径，为空时为 DefaultWebSocketPath
+		AllowedOrigins    []string                    // 允许的 Origin ，为空或包含 "*" 时允许所有来源，不带 Origin 的非浏览器请求总是允许
+		ReadBufferSize    int                         // 读缓存大小，小于等于零时为 DefaultUpgraderReadBufferSize
+		WriteBufferSize   int                         // 写缓存大小，小于等于零时为 DefaultUpgraderWriteBufferSize
+		Binary            bool                        // 是否以二进制帧发送，默认以文本帧发送，二进制编解码器或加密器应当开启
+		EnableCompression bool                        // 是否协商 permessage-deflate 压缩
+		ReadLimit         int64                       // 单条消息最大长度，小于等于零时不限制，超过时关闭连接，开启压缩时按传输长度计算
+		PingInterval      time.Duration               // 原生 ping 间隔，小于等于零时不发送
+		PongWait          time.Duration               // 等待 pong 的时间，超时后读取失败并关闭连接，小于等于零时为 PingInterval 的两倍
+		OnUpgrade         func(r *http.Request) error // 升级前调用，返回错误时以 403 拒绝升级，可用于校验令牌等
+	}
+
 	// websocket 入口实现
 	webSocketGate struct {
 		baseGate
+		option   WebSocketOption
 		server   *http.Server
 		upgrader *websocket.Upgrader
-		f        func(Conn)
+		mounted  bool // 是否挂载在使用者的 HTTP 路由上，挂载时不校验路径
 	}
 
 	// gRPC 入口实现
@@ -50,7 +85,6 @@ type (
 		baseGate
 		server   *grpc.Server
 		listener net.Listener
-		f        func(Conn)
 	}
 )
 
@@ -61,6 +95,8 @@ const (
 	DefaultUpgraderReadBufferSize = 1024
 	// 默认升级器写大小
 	DefaultUpgraderWriteBufferSize = 1024
+	// 默认 gRPC server 优雅停止的超时时间，超时后强制停止
+	DefaultGracefulStopTimeout = time.Second * time.Duration(10)
 )
 
 const (
@@ -70,8 +106,12 @@ const (
 	WebSocketGateName = "WebSocket Gate"
 	// gRPC gate 名称
 	GRPCGateName = "GRPC Gate"
+	// Unix gate 名称
+	UnixGateName = "Unix Gate"
 	// network
 	DefaultNetwork = "tcp"
+	// unix 域套接字 network
+	UnixNetwork = "unix"
 )
 
 // 此变量组定义了 Gate 定义及实现中可能会发生的错误文本
@@ -81,6 +121,7 @@ const (
 	ErrNilServerText    = "server is nil"
 	ErrNilUpgraderText  = "upgrader is nil"
 	ErrNilHookFuncText  = "hook function is nil"
+	ErrGateNotRunText   = "gate is not running"
 )
 
 // 此变量组定义了 Gate 定义及实现中可能会发生的错误
@@ -95,20 +136,37 @@ var (
 	ErrNilUpgrader = errors.New(ErrNilUpgraderText)
 	// hook function 为 nil 错误
 	ErrNilHookFunc = errors.New(ErrNilHookFuncText)
+	// 入口未运行 错误
+	ErrGateNotRun = errors.New(ErrGateNotRunText)
 )
 
 // 实例化 socketGate 的 Gate 实现，返回表现形式为 Gate
 func NewSocketGate(addr string) Gate {
 	return &socketGate{
 		baseGate: baseGate{address: addr},
+		name:     SocketGateName,
+		network:  DefaultNetwork,
+		listener: nil,
+	}
+}
+
+// 实例化监听 unix 域套接字的 socketGate ，供同一主机上的边车进程使用，连接与 socketGate 的连接完全一致
+// 套接字文件存在但无人监听时（例如进程异常退出后残留）会先删除，销毁时删除套接字文件
+func NewUnixGate(path string) Gate {
+	return &socketGate{
+		baseGate: baseGate{address: path},
+		name:     UnixGateName,
+		network:  UnixNetwork,
 		listener: nil,
 	}
 }
 
 // 实例化 webSocketGate 的 Gate 实现，返回表现形式为 Gate
-func NewWebSocketGate(addr string) Gate {
+// 可选的 WebSocketOption 只取第一个，未给出时使用默认选项
+func NewWebSocketGate(addr string, options ...WebSocketOption) Gate {
 	return &webSocketGate{
 		baseGate: baseGate{address: addr},
+		option:   webSocketOption(options),
 	}
 }
 
@@ -119,10 +177,87 @@ func NewGRPCGate(addr string) Gate {
 	}
 }
 
+// 实例化使用 TLS 的 socketGate ，TLS 握手完成后才将连接交给 Service
+func NewSocketGateTLS(addr string, option TLSOption) Gate {
+	return &socketGate{
+		baseGate: baseGate{address: addr, tlsOption: &option},
+		name:     SocketGateName,
+		network:  DefaultNetwork,
+		listener: nil,
+	}
+}
+
+// 实例化使用 TLS 的 webSocketGate ，客户端以 wss:// 连接
+func NewWebSocketGateTLS(addr string, option TLSOption, options ...WebSocketOption) Gate {
+	return &webSocketGate{
+		baseGate: baseGate{address: addr, tlsOption: &option},
+		option:   webSocketOption(options),
+	}
+}
+
+// 实例化使用 TLS 的 gRPCGate
+func NewGRPCGateTLS(addr string, option TLSOption) Gate {
+	return &gRPCGate{
+		baseGate: baseGate{address: addr, tlsOption: &option},
+	}
+}
+
+// 取第一个 websocket 入口选项，填充默认值
+func webSocketOption(options []WebSocketOption) WebSocketOption {
+	option := WebSocketOption{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	if option.Path == "" {
+		option.Path = DefaultWebSocketPath
+	}
+	if option.ReadBufferSize <= 0 {
+		option.ReadBufferSize = DefaultUpgraderReadBufferSize
+	}
+	if option.WriteBufferSize <= 0 {
+		option.WriteBufferSize = DefaultUpgraderWriteBufferSize
+	}
+	if option.PongWait <= 0 {
+		option.PongWait = option.PingInterval * 2
+	}
+
+	return option
+}
+
+// 持有钩子函数
+func (bg *baseGate) hook(function func(Conn)) {
+	bg.fMutex.Lock()
+	defer bg.fMutex.Unlock()
+	bg.f = function
+}
+
+// 钩子函数，Running() 前为 nil
+func (bg *baseGate) hookFunc() func(Conn) {
+	bg.fMutex.RLock()
+	defer bg.fMutex.RUnlock()
+	return bg.f
+}
+
+// 由 TLS 选项生成 TLS 配置，未设置 TLS 选项时不生成
+func (bg *baseGate) initTLS() error {
+	if bg.tlsOption == nil {
+		return nil
+	}
+
+	config, err := bg.tlsOption.ServerConfig()
+	if err != nil {
+		return err
+	}
+
+	bg.tlsConfig = config
+	return nil
+}
+
 // --------------------------------------------------- SocketGate ------------------------------------------------------
 // 入口名称
 func (sg *socketGate) Name() string {
-	return SocketGateName
+	return sg.name
 }
 
 // 初始化
@@ -130,12 +265,23 @@ func (sg *socketGate) Initialize() error {
 	if sg.address == "" {
 		return ErrEmptyAddress
 	}
+	if err := sg.initTLS(); err != nil {
+		return err
+	}
+
+	// 删除残留的 unix 域套接字文件
+	if sg.network == UnixNetwork {
+		removeStaleUnixSocket(sg.address)
+	}
 
 	// 实例化监听
-	l, err := net.Listen(DefaultNetwork, sg.address)
+	l, err := net.Listen(sg.network, sg.address)
 	if err != nil {
 		return err
 	}
+	if sg.tlsConfig != nil {
+		l = tls.NewListener(l, sg.tlsConfig)
+	}
 
 	sg.listener = l
 
@@ -151,21 +297,68 @@ func (sg *socketGate) Running(function func(Conn)) error {
 		return ErrNilHookFunc
 	}
 
+	// 持有局部监听者，Destroy() 会将 sg.listener 置为 nil
+	listener := sg.listener
+
 	var e error
 	for {
-		c, err := sg.listener.Accept()
+		c, err := listener.Accept()
 		if err != nil {
 			e = err // 捕捉接收连接错误，反馈到 Service 中
 			break
 		}
+		// TLS 连接在独立的协程中完成握手，防止慢速握手阻塞接收
+		if tc, ok := c.(*tls.Conn); ok {
+			go sg.handshake(tc, function)
+			continue
+		}
+
 		conn := NewSocketConn(c)
 		function(conn) // 实例化 Conn ，下放到 Service.Manager 中管理
 	}
 	return e
 }
 
+// 在 DefaultTLSHandshakeTimeout 内完成 TLS 握手，成功后将连接交给 Service
+func (sg *socketGate) handshake(c *tls.Conn, function func(Conn)) {
+	if err := c.SetDeadline(time.Now().Add(DefaultTLSHandshakeTimeout)); err != nil {
+		log.ErrorF("socket Gate set handshake deadline error : %s", err.Error())
+	}
+	if err := c.Handshake(); err != nil {
+		log.ErrorF("socket Gate tls handshake with [%s] error : %s", c.RemoteAddr().String(), err.Error())
+		_ = c.Close()
+		return
+	}
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		log.ErrorF("socket Gate clear handshake deadline error : %s", err.Error())
+	}
+
+	function(NewSocketConn(c))
+}
+
+// 删除无人监听的 unix 域套接字文件，仍有进程监听时保留，由 Listen() 报告地址已被使用
+func removeStaleUnixSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if c, err := net.Dial(UnixNetwork, path); err == nil {
+		_ = c.Close()
+		return
+	}
+
+	if err := os.Remove(path); err != nil {
+		log.ErrorF("remove stale unix socket [%s] error : %s", path, err.Error())
+	}
+}
+
 // 销毁
 func (sg *socketGate) Destroy() error {
+	if sg.listener == nil {
+		return ErrNilListener
+	}
+
 	// 关闭监听并且置为 nil
 	if err := sg.listener.Close(); err != nil {
 		return err
@@ -187,28 +380,33 @@ func (wsg *webSocketGate) Initialize() error {
 	if wsg.address == "" {
 		return ErrEmptyAddress
 	}
+	if err := wsg.initTLS(); err != nil {
+		return err
+	}
 
 	// 实例化 server，处理器指定为自身，自身实现了 ServeHTTP(http.ResponseWriter,*http.Request)
 	server := &http.Server{
-		Addr:    wsg.address,
-		Handler: wsg,
-	}
-
-	// 实例化升级器，用于升级链接
-	upgrader := &websocket.Upgrader{
-		ReadBufferSize:  DefaultUpgraderReadBufferSize,
-		WriteBufferSize: DefaultUpgraderWriteBufferSize,
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		Addr:      wsg.address,
+		Handler:   wsg,
+		TLSConfig: wsg.tlsConfig,
 	}
 
 	wsg.server = server
-	wsg.upgrader = upgrader
+	wsg.upgrader = wsg.newUpgrader()
 
 	return nil
 }
 
+// 实例化升级器，用于升级链接
+func (wsg *webSocketGate) newUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    wsg.option.ReadBufferSize,
+		WriteBufferSize:   wsg.option.WriteBufferSize,
+		EnableCompression: wsg.option.EnableCompression,
+		CheckOrigin:       wsg.checkOrigin,
+	}
+}
+
 // 运行
 func (wsg *webSocketGate) Running(function func(Conn)) error {
 	if wsg.server == nil {
@@ -222,8 +420,12 @@ func (wsg *webSocketGate) Running(function func(Conn)) error {
 	}
 
 	// 持有钩子函数，用于 ServeHTTP() 函数中使用
-	wsg.f = function
+	wsg.hook(function)
 
+	// 证书已经在 TLS 配置中，不需要文件参数
+	if wsg.tlsConfig != nil {
+		return wsg.server.ListenAndServeTLS("", "")
+	}
 	return wsg.server.ListenAndServe()
 }
 
@@ -242,23 +444,63 @@ func (wsg *webSocketGate) Destroy() error {
 
 // 内部 HTTP 服务器函数
 func (wsg *webSocketGate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 路径非 /ws
-	if r.URL.Path != DefaultWebSocketPath {
+	// 路径不匹配，挂载时路径由使用者的路由决定
+	if !wsg.mounted && r.URL.Path != wsg.option.Path {
+		return
+	}
+
+	// 未运行时不升级，防止连接无人管理
+	function := wsg.hookFunc()
+	if function == nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		return
 	}
 
+	// 升级前钩子
+	if wsg.option.OnUpgrade != nil {
+		if err := wsg.option.OnUpgrade(r); err != nil {
+			log.ErrorF("websocket Gate upgrade request from [%s] rejected : %s", r.RemoteAddr, err.Error())
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+
 	// 升级请求为 webSocket
 	c, err := wsg.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.ErrorF("websocket Gate upgrade request error : %s", err.Error())
 		return
 	}
+	if wsg.option.ReadLimit > 0 {
+		c.SetReadLimit(wsg.option.ReadLimit)
+	}
 
-	// 实例化 Conn 交由 Service
-	conn := NewWebSocketConn(c)
-	if wsg.f != nil {
-		wsg.f(conn)
+	// 实例化 Conn 交由 Service ，携带升级请求信息
+	messageType := websocket.TextMessage
+	if wsg.option.Binary {
+		messageType = websocket.BinaryMessage
+	}
+	conn := newWebSocketConn(c, messageType, newUpgradeInfo(r))
+	if wsg.option.PingInterval > 0 {
+		conn.keepAlive(wsg.option.PingInterval, wsg.option.PongWait)
 	}
+	function(conn)
+}
+
+// 按允许的 Origin 列表校验来源
+func (wsg *webSocketGate) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(wsg.option.AllowedOrigins) == 0 {
+		return true
+	}
+
+	for _, allowed := range wsg.option.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // --------------------------------------------------- GRPCGate --------------------------------------------------------
@@ -272,6 +514,9 @@ func (gg *gRPCGate) Initialize() error {
 	if gg.address == "" {
 		return ErrEmptyAddress
 	}
+	if err := gg.initTLS(); err != nil {
+		return err
+	}
 
 	// 实例化监听和 server
 	l, err := net.Listen(DefaultNetwork, gg.address)
@@ -279,7 +524,11 @@ func (gg *gRPCGate) Initialize() error {
 		return err
 	}
 
-	server := grpc.NewServer()
+	options := make([]grpc.ServerOption, 0)
+	if gg.tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(gg.tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
 
 	gg.server = server
 	gg.listener = l
@@ -297,7 +546,7 @@ func (gg *gRPCGate) Running(function func(Conn)) error {
 	}
 
 	// 持有钩子函数
-	gg.f = function
+	gg.hook(function)
 
 	// 注册 server ，指定处理器为自身，自身实现了 CommunicateServer 接口
 	gRPC.RegisterCommunicateServer(gg.server, gg)
@@ -305,27 +554,71 @@ func (gg *gRPCGate) Running(function func(Conn)) error {
 	return gg.server.Serve(gg.listener)
 }
 
-// 销毁
+// 停止接收新连接，已有的流保持可用，Running() 随之返回
+func (gg *gRPCGate) StopAccept() error {
+	if gg.listener == nil {
+		return ErrNilListener
+	}
+
+	return closeListener(gg.listener)
+}
+
+// 销毁，优雅停止 server ，等待已有的流结束
 func (gg *gRPCGate) Destroy() error {
+	if gg.listener == nil {
+		return ErrNilListener
+	}
+
 	// 停止 server
-	gg.server.Stop()
+	gracefulStop(gg.server)
 
-	// 停止监听
-	return gg.listener.Close()
+	// 停止监听，server 可能已经关闭了监听
+	return closeListener(gg.listener)
+}
+
+// 在 DefaultGracefulStopTimeout 内优雅停止 gRPC server ，超时后强制停止
+func gracefulStop(server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(DefaultGracefulStopTimeout):
+		log.WarnF("gRPC server graceful stop timeout, force stop")
+		server.Stop()
+	}
+}
+
+// 关闭监听，忽略已经关闭的错误
+func closeListener(listener net.Listener) error {
+	if err := listener.Close(); err != nil && !strings.Contains(err.Error(), ErrNetClosingText) {
+		return err
+	}
+
+	return nil
 }
 
 func (gg *gRPCGate) Connect(ccs gRPC.Communicate_ConnectServer) error {
+	// 未运行时拒绝连接，防止连接无人管理
+	function := gg.hookFunc()
+	if function == nil {
+		return ErrGateNotRun
+	}
+
 	// 实例化 Conn ，且得到一个关闭的 channel
 	conn, closeChannel := NewGRPCConn(ccs)
 
 	// 将 Conn 发送到 Service
-	if gg.f != nil {
-		gg.f(conn)
-	}
+	function(conn)
 
-	// 阻塞当前调用，防止 ccs 关闭
+	// 阻塞当前调用，防止 ccs 关闭，server 停止时流上下文会被取消
 	select {
 	case <-closeChannel:
 		return nil
+	case <-ccs.Context().Done():
+		return nil
 	}
 }
@@ -0,0 +1,39 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixAndUDPGates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jarvis-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	udpAddress, unixPath := freeAddress(t), filepath.Join(dir, "jarvis.sock")
+
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewUnixGate(unixPath), NewUDPGate(udpAddress))
+	defer s.Shutdown(nil)
+
+	clients := map[string]Client{
+		"unix": NewUnixClient(unixPath, DefaultPackager(), DefaultEncrypter()),
+		"udp":  NewUDPClient(udpAddress, DefaultPackager(), DefaultEncrypter()),
+	}
+	for name, c := range clients {
+		if err := c.Initialize(); err != nil {
+			t.Fatalf("[%s] initialize : %v", name, err)
+		}
+		defer c.Close()
+
+		if reply := requestReply(t, c, "test", "echo", []byte(name)); reply.Code != ReplySuccessCode || string(reply.Data) != name {
+			t.Fatalf("[%s] echo = %+v", name, reply)
+		}
+	}
+}
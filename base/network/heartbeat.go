@@ -0,0 +1,70 @@
+// Heartbeat 定义了心跳使用的保留模块、路由以及间隔和超时
+// 服务端 Item 收到 ping 消息时直接回复 pong ，不进入 Service 的路由分发
+// 服务端按 Interval 巡检所有 Item ，最后读取时间距今超过 Timeout 的 Item 以 ItemStateTimeoutClose 状态关闭
+// 空闲检测默认关闭，DefaultHeartbeat() 的 Timeout 为零，开启时（例如设置为 DefaultHeartbeatTimeout）客户端必须按时发送 ping ，
+// 或者是开启了 WebSocketOption.PingInterval 的 WebSocket 连接，其原生 pong 控制帧同样视为读取
+// 客户端按 Interval 发送 ping 消息，收到的 pong 消息不会进入接收管道
+package network
+
+import "time"
+
+type (
+	// 心跳定义
+	Heartbeat struct {
+		Module   string        // 保留模块名
+		Ping     string        // ping 路由名
+		Pong     string        // pong 路由名
+		Interval time.Duration // 间隔，客户端发送 ping 的间隔，服务端巡检的间隔，小于等于零时不发送、不巡检
+		Timeout  time.Duration // 空闲超时，服务端关闭超过此时间未读取到数据的 Item ，小于等于零时不检测
+	}
+)
+
+const (
+	// 默认心跳保留模块名
+	DefaultHeartbeatModule = "heartbeat"
+	// 默认 ping 路由名
+	DefaultHeartbeatPing = "ping"
+	// 默认 pong 路由名
+	DefaultHeartbeatPong = "pong"
+	// 默认心跳间隔
+	DefaultHeartbeatInterval = time.Second * time.Duration(15)
+	// 建议的空闲超时，默认心跳不开启空闲检测
+	DefaultHeartbeatTimeout = time.Second * time.Duration(45)
+)
+
+// 默认心跳
+func DefaultHeartbeat() Heartbeat {
+	return Heartbeat{
+		Module:   DefaultHeartbeatModule,
+		Ping:     DefaultHeartbeatPing,
+		Pong:     DefaultHeartbeatPong,
+		Interval: DefaultHeartbeatInterval,
+		Timeout:  0,
+	}
+}
+
+// 是否为 ping 消息
+func (h Heartbeat) IsPing(message Message) bool {
+	return h.Module != "" && message.Module == h.Module && message.Route == h.Ping
+}
+
+// 是否为 pong 消息
+func (h Heartbeat) IsPong(message Message) bool {
+	return h.Module != "" && message.Module == h.Module && message.Route == h.Pong
+}
+
+// ping 消息
+func (h Heartbeat) PingMessage() Message {
+	return Message{
+		Module: h.Module,
+		Route:  h.Ping,
+	}
+}
+
+// pong 消息
+func (h Heartbeat) PongMessage() Message {
+	return Message{
+		Module: h.Module,
+		Route:  h.Pong,
+	}
+}
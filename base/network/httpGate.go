@@ -0,0 +1,349 @@
+// HTTPGate 为无法保持长连接的调用方提供一次性请求，请求格式为 POST {Prefix}/{module}/{route} ，请求体即为 Message.Data
+// 每个请求建立一个短暂的 Item ，经由 Service 的正常流程（认证、限流、调用链）处理，取得第一个回覆后结束请求并关闭 Item
+// 连接为直通连接，不经过装包者及加密器，消息以 JSONCodec() 编解码，不能协商编解码器及压缩器
+// 响应体通常为 JSON 格式的 Reply ，状态码取自 Reply.Code ，Code 不是 HTTP 状态码时为 200
+// 回覆不是 Reply 结构时（例如 Context.BinaryReply()）响应体为原始数据，状态码为 200 ，不是 JSON 时 Content-Type 为 application/octet-stream
+// 超时未回覆时为 504 ，Item 在回覆前被关闭时为 503
+// AuthOption 未指定握手路由时，请求先交由 Authenticator 认证，成功后继续路由，响应为路由的回覆
+// 请求头、Cookie 及查询参数通过 Item.Upgrade() 取得，可用于认证
+package network
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"jarvis/base/log"
+	"jarvis/util/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// HTTP 入口选项，零值字段使用默认值
+	HTTPOption struct {
+		Prefix      string        // 路径前缀，例如 "/api" ，默认为空
+		Timeout     time.Duration // 等待回覆的超时时间，小于等于零时为 DefaultHTTPTimeout
+		MaxBodySize int64         // 请求体最大长度，小于等于零时为 DefaultMaxFrameSize
+	}
+
+	// HTTP 入口实现
+	httpGate struct {
+		baseGate
+		option HTTPOption
+		server *http.Server
+	}
+
+	// HTTP 一次性请求连接实现
+	httpConn struct {
+		baseConn
+		request    chan []byte          // 请求消息，只读取一次
+		response   chan []byte          // 第一个回覆的数据
+		reply      string               // 请求消息的回覆，只接收此回覆
+		remoteAddr string               // 对端地址
+		upgrade    *UpgradeInfo         // 请求信息
+		state      *tls.ConnectionState // TLS 连接状态
+		done       chan struct{}        // 请求结束时关闭，此后读取返回 io.EOF
+		once       sync.Once            // 保证 done 只关闭一次
+		mutex      sync.Mutex           // 对关闭状态的多线程竞态加锁
+	}
+)
+
+const (
+	// HTTP gate 名称
+	HTTPGateName = "HTTP Gate"
+	// 默认等待回覆的超时时间
+	DefaultHTTPTimeout = time.Second * time.Duration(10)
+	// HTTP 请求消息使用的回覆
+	HTTPReply = "http"
+)
+
+// 实例化 httpGate 的 Gate 实现，可选的 HTTPOption 只取第一个
+func NewHTTPGate(addr string, options ...HTTPOption) Gate {
+	return &httpGate{
+		baseGate: baseGate{address: addr},
+		option:   httpOption(options),
+	}
+}
+
+// 实例化使用 TLS 的 httpGate
+func NewHTTPGateTLS(addr string, option TLSOption, options ...HTTPOption) Gate {
+	return &httpGate{
+		baseGate: baseGate{address: addr, tlsOption: &option},
+		option:   httpOption(options),
+	}
+}
+
+// 取第一个 HTTP 入口选项，填充默认值
+func httpOption(options []HTTPOption) HTTPOption {
+	option := HTTPOption{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+
+	option.Prefix = strings.TrimRight(option.Prefix, "/")
+	if option.Timeout <= 0 {
+		option.Timeout = DefaultHTTPTimeout
+	}
+	if option.MaxBodySize <= 0 {
+		option.MaxBodySize = DefaultMaxFrameSize
+	}
+
+	return option
+}
+
+// 回覆码对应的 HTTP 状态码
+func replyStatus(code int) int {
+	if code >= 200 && code < 600 && http.StatusText(code) != "" {
+		return code
+	}
+
+	return http.StatusOK
+}
+
+// --------------------------------------------------- HTTPGate --------------------------------------------------------
+// 入口名称
+func (hg *httpGate) Name() string {
+	return HTTPGateName
+}
+
+// 初始化
+func (hg *httpGate) Initialize() error {
+	if hg.address == "" {
+		return ErrEmptyAddress
+	}
+	if err := hg.initTLS(); err != nil {
+		return err
+	}
+
+	hg.server = &http.Server{
+		Addr:      hg.address,
+		Handler:   hg,
+		TLSConfig: hg.tlsConfig,
+	}
+
+	return nil
+}
+
+// 运行
+func (hg *httpGate) Running(function func(Conn)) error {
+	if hg.server == nil {
+		return ErrNilServer
+	}
+	if function == nil {
+		return ErrNilHookFunc
+	}
+
+	hg.hook(function)
+
+	if hg.tlsConfig != nil {
+		return hg.server.ListenAndServeTLS("", "")
+	}
+	return hg.server.ListenAndServe()
+}
+
+// 销毁
+func (hg *httpGate) Destroy() error {
+	if hg.server == nil {
+		return ErrNilServer
+	}
+
+	return hg.server.Close()
+}
+
+// 内部 HTTP 服务器函数
+func (hg *httpGate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 解析 {Prefix}/{module}/{route}
+	if !strings.HasPrefix(r.URL.Path, hg.option.Prefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, hg.option.Prefix+"/"), "/")
+	// 编解码器协商等保留模块只用于长连接
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == CodecModule {
+		http.NotFound(w, r)
+		return
+	}
+
+	function := hg.hookFunc()
+	if function == nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, hg.option.MaxBodySize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	request, err := JSONCodec().Marshal(Message{Module: parts[0], Route: parts[1], Data: data, Reply: HTTPReply})
+	if err != nil {
+		log.ErrorF("HTTP Gate marshal request error : %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// 交由 Service 处理，等待第一个回覆
+	conn := newHTTPConn(r, request)
+	function(conn)
+	defer conn.finish()
+
+	timer := time.NewTimer(hg.option.Timeout)
+	defer timer.Stop()
+
+	var response []byte
+	select {
+	case response = <-conn.response:
+	case <-conn.done:
+		// Item 可能在回覆后立即关闭，例如认证失败
+		select {
+		case response = <-conn.response:
+		default:
+		}
+	case <-timer.C:
+		http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+		return
+	case <-r.Context().Done():
+		return
+	}
+	if response == nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	// 回覆不是 Reply 结构时（例如 Context.BinaryReply() 的原始数据）原样返回
+	status, contentType := http.StatusOK, "application/octet-stream"
+	reply := Reply{}
+	if err := json.Unmarshal(response, &reply); err == nil {
+		status, contentType = replyStatus(reply.Code), "application/json"
+	} else if json.Valid(response) {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err := w.Write(response); err != nil {
+		log.ErrorF("HTTP Gate write response error : %s", err.Error())
+	}
+}
+
+// --------------------------------------------------- httpConn --------------------------------------------------------
+// 新建 HTTP 一次性请求连接
+func newHTTPConn(r *http.Request, request []byte) *httpConn {
+	requestChan := make(chan []byte, 1)
+	requestChan <- request
+
+	return &httpConn{
+		baseConn:   baseConn{},
+		request:    requestChan,
+		response:   make(chan []byte, 1),
+		reply:      HTTPReply,
+		remoteAddr: r.RemoteAddr,
+		upgrade:    newUpgradeInfo(r),
+		state:      r.TLS,
+		done:       make(chan struct{}),
+		once:       sync.Once{},
+		mutex:      sync.Mutex{},
+	}
+}
+
+// 结束请求，此后读取返回 io.EOF ，Item 随之关闭
+func (hc *httpConn) finish() {
+	hc.once.Do(func() {
+		close(hc.done)
+	})
+}
+
+// 读取，第一次返回请求消息，之后阻塞到请求结束
+func (hc *httpConn) Read() ([]byte, error) {
+	select {
+	case request := <-hc.request:
+		return request, nil
+	case <-hc.done:
+		return nil, io.EOF
+	}
+}
+
+// 写入，只接收请求消息的第一个回覆，其余消息（如广播）丢弃
+func (hc *httpConn) Write(data []byte) error {
+	if hc.IsClosed() {
+		return ErrConnClosed
+	}
+
+	message := Message{}
+	if err := JSONCodec().Unmarshal(data, &message); err != nil {
+		return err
+	}
+	if message.Reply != hc.reply {
+		return nil
+	}
+
+	select {
+	case hc.response <- message.Data:
+	default:
+	}
+	return nil
+}
+
+// 关闭，重复关闭会报错
+func (hc *httpConn) Close() error {
+	hc.mutex.Lock()
+	if hc.closed {
+		hc.mutex.Unlock()
+		return ErrConnClosed
+	}
+	hc.closed = true
+	hc.mutex.Unlock()
+
+	hc.finish()
+	return nil
+}
+
+// 询问是否已关闭
+func (hc *httpConn) IsClosed() bool {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	return hc.closed
+}
+
+// 唯一标识
+func (hc *httpConn) UniqueSymbol() string {
+	if hc.IsClosed() {
+		return ""
+	}
+
+	return rand.RandomString(8)
+}
+
+// 对端地址
+func (hc *httpConn) RemoteAddr() string {
+	return hc.remoteAddr
+}
+
+// 直通
+func (hc *httpConn) Plain() bool {
+	return true
+}
+
+// 一次性
+func (hc *httpConn) OneShot() bool {
+	return true
+}
+
+// 请求信息
+func (hc *httpConn) Upgrade() *UpgradeInfo {
+	return hc.upgrade
+}
+
+// TLS 连接状态
+func (hc *httpConn) TLSState() *tls.ConnectionState {
+	return hc.state
+}
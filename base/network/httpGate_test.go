@@ -0,0 +1,119 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 以原始数据回复的模块
+type binaryModule struct{}
+
+func (binaryModule) Name() string { return "binary" }
+
+func (binaryModule) Route() map[string][]RouteHandleFunc {
+	return map[string][]RouteHandleFunc{
+		"raw": {func(ctx Context) { _ = ctx.BinaryReply(ctx.Request().Data) }},
+	}
+}
+
+// 发送 HTTP 请求，返回状态码、Content-Type 及响应体
+func httpPost(t *testing.T, url, body string) (int, string, []byte) {
+	response, err := http.Post(url, "application/octet-stream", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response.StatusCode, response.Header.Get("Content-Type"), data
+}
+
+func TestHTTPGate(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewHTTPGate(addr))
+	defer s.Shutdown(nil)
+
+	// 响应体即为 JSON 格式的 Reply
+	response, err := http.Post("http://"+addr+"/test/echo", "application/octet-stream", strings.NewReader("http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := Reply{}
+	if err := json.Unmarshal(body, &reply); err != nil || response.StatusCode != http.StatusOK || string(reply.Data) != "http" {
+		t.Fatalf("http echo = %d %s , %v", response.StatusCode, body, err)
+	}
+
+	// 路由不存在时状态码取自 Reply.Code
+	response, err = http.Post("http://"+addr+"/test/missing", "application/octet-stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing route status = %d , want %d", response.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHTTPGateBinaryReply(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(binaryModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewHTTPGate(addr))
+	defer s.Shutdown(nil)
+
+	// 不是 Reply 结构的回覆原样返回
+	if status, contentType, body := httpPost(t, "http://"+addr+"/binary/raw", "raw"); status != http.StatusOK || contentType != "application/octet-stream" || string(body) != "raw" {
+		t.Fatalf("binary reply = %d %s %q", status, contentType, body)
+	}
+	if status, contentType, body := httpPost(t, "http://"+addr+"/binary/raw", "[1,2]"); status != http.StatusOK || contentType != "application/json" || string(body) != "[1,2]" {
+		t.Fatalf("json binary reply = %d %s %q", status, contentType, body)
+	}
+}
+
+func TestHTTPGateAuthenticate(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	authenticator := AuthenticatorFunc(func(ctx Context) (interface{}, error) {
+		if string(ctx.Request().Data) != "secret" {
+			return nil, errors.New("wrong secret")
+		}
+		return "frank", nil
+	})
+	if err := s.SetAuthenticator(authenticator, AuthOption{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewHTTPGate(addr))
+	defer s.Shutdown(nil)
+
+	// 未指定握手路由时，认证成功的请求继续路由，响应为路由的回覆
+	status, _, body := httpPost(t, "http://"+addr+"/test/echo", "secret")
+	reply := Reply{}
+	if err := json.Unmarshal(body, &reply); err != nil || status != http.StatusOK || string(reply.Data) != "secret" {
+		t.Fatalf("authenticated echo = %d %s , %v", status, body, err)
+	}
+
+	if status, _, body := httpPost(t, "http://"+addr+"/test/echo", "wrong"); status != ReplyUnauthorizedCode {
+		t.Fatalf("unauthenticated echo = %d %s , want %d", status, body, ReplyUnauthorizedCode)
+	}
+}
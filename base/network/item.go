@@ -1,14 +1,25 @@
 // Item 是对 Conn 的业务包装，统一负责读取、写入、关闭、断开逆反馈
 // Item 在 Conn.IsClosed() == false 的情况下，于单个线程内阻塞式读取消息，并将读取的字节组输入到上层统一的 Packager 中进行解包，解密
 // Item 在写入数据时，通过 Packager 进行加密、打包成字节组，再调用 Conn 的 Write() 函数进行发送到客户端
-// Item 共有5种状态，创建、运行、主动关闭、被动关闭、未知关闭，被动关闭和未知关闭状态下会调用一次 Close() 关闭 Conn 并上报反馈，服务端主动
-// 关闭 Item 的情况下，直接调用 Item.Close() 也会触发上报反馈
+// Item 共有10种状态，创建、运行、主动关闭、被动关闭、未知关闭、超时关闭、被踢关闭、未认证关闭、数据帧错误关闭、握手失败关闭，被动关闭和未知关闭状态下会调用一次 Close() 关闭 Conn 并上报反馈，
+// 服务端主动关闭 Item 的情况下，直接调用 Item.Close() 也会触发上报反馈，调用 CloseWithState() 可以指定关闭状态
+// Item 记录最后一次读取和写入的时间，收到心跳 ping 消息时直接回复 pong ，不进入 Service
+// Item 以 JSONCodec() 开始收发且不压缩，收到编解码器或压缩协商消息时直接回复协商结果并切换，不进入 Service
+// Item 的加密器需要密钥交换时，收到的第一个数据帧必须是对端的握手数据，握手完成前不发送消息，握手失败、认证失败或重放时关闭
+// Item 记录所属入口、对端地址、建立时间以及读取和写入的字节数，用于运维查看
+// Item 保存认证成功后的认证主体
 // Item 默认 Hook 了 上层 Manager 的 RemoveItem() 函数，因此 Close() 的时候会调用此函数将自己从管理中移除
+// Item 持有一个标准库 context.Context ，Close() 时取消，由其派生的请求上下文随之取消
 package network
 
 import (
+	oContext "context"
+	"crypto/x509"
 	"jarvis/base/log"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
@@ -29,31 +40,120 @@ type (
 		// 发送消息
 		Send(Message)
 
+		// 将消息以当前编解码器序列化、加密、打包为可直接写入的数据帧
+		Frame(Message) ([]byte, error)
+
+		// 数据帧复用键，键相同的端可以写入同一个数据帧，键包含装包者、加密器、编解码器及压缩器的标识
+		// 加密器使用会话密钥，或装包者、加密器不是内置实现时，每个端的键均不相同
+		FrameKey() string
+
+		// 写入已打包的数据帧，常用于广播时复用同一个数据帧
+		SendFrame([]byte) error
+
 		// 关闭
 		Close()
 
+		// 以指定状态关闭，Receive() 结束时不再根据错误推断状态
+		CloseWithState(ItemState)
+
+		// 当前状态
+		State() ItemState
+
+		// 最后一次读取到数据的时间，连接实现了 ActiveConn 时包括不经过读取的控制帧
+		LastRead() time.Time
+
+		// 最后一次写入数据的时间
+		LastWrite() time.Time
+
+		// 设置认证主体，同时标记为已认证
+		SetPrincipal(interface{})
+
+		// 认证主体
+		Principal() interface{}
+
+		// 是否已认证
+		IsAuthenticated() bool
+
 		// 客户端断开反馈
 		PassiveCloseFeedback(PassiveCloseFeedbackFunc)
+
+		// 获取标准库上下文，Close() 后被取消
+		Context() oContext.Context
+
+		// 所属入口名
+		Gate() string
+
+		// 对端地址
+		RemoteAddr() string
+
+		// 建立时间
+		ConnectedAt() time.Time
+
+		// 读取的字节数
+		BytesIn() int64
+
+		// 写入的字节数
+		BytesOut() int64
+
+		// 当前使用的编解码器
+		Codec() Codec
+
+		// 当前使用的压缩器，未压缩时为 nil
+		Compressor() Compressor
+
+		// 校验通过的对端证书，非双向 TLS 连接为 nil
+		PeerCertificate() *x509.Certificate
+
+		// WebSocket 升级请求或 HTTP 一次性请求的请求头、Cookie 及查询参数，其他连接为 nil
+		Upgrade() *UpgradeInfo
 	}
 
 	// 端定义实现
+	// 原子操作的时间置于结构起始，保证 32 位平台上的 64 位对齐
 	item struct {
-		id        ID                       // 内部唯一标识
-		conn      Conn                     // 连接
-		state     ItemState                // 状态
-		packager  Packager                 // 装包者
-		encrypter Encrypter                // 加密器
-		FbFunc    PassiveCloseFeedbackFunc // 客户端断开反馈函数
+		lastRead      int64                    // 最后一次读取时间，UnixNano
+		lastWrite     int64                    // 最后一次写入时间，UnixNano
+		bytesIn       int64                    // 读取的字节数
+		bytesOut      int64                    // 写入的字节数
+		gate          string                   // 所属入口名
+		remoteAddr    string                   // 对端地址
+		peerCert      *x509.Certificate        // 校验通过的对端证书
+		upgrade       *UpgradeInfo             // 升级请求信息
+		connectedAt   time.Time                // 建立时间
+		ctx           oContext.Context         // 标准库上下文
+		cancel        oContext.CancelFunc      // 取消标准库上下文
+		id            ID                       // 内部唯一标识
+		conn          Conn                     // 连接
+		state         ItemState                // 状态
+		mutex         sync.Mutex               // 状态竞态锁
+		heartbeat     Heartbeat                // 心跳
+		principal     interface{}              // 认证主体
+		authenticated bool                     // 是否已认证
+		packager      Packager                 // 装包者
+		encrypter     Encrypter                // 加密器
+		exchanger     KeyExchanger             // 需要密钥交换的加密器，与 encrypter 为同一个实例，不需要时为 nil
+		codec         Codec                    // 当前使用的编解码器，只在 Receive() 中切换
+		codecs        map[string]Codec         // 可以协商的编解码器，map[名称]编解码器
+		compressor    Compressor               // 当前使用的压缩器，只在 Receive() 中切换，为 nil 时不压缩
+		compressors   map[string]Compressor    // 可以协商的压缩器，map[名称]压缩器
+		threshold     int                      // 压缩阈值
+		pipeMutex     sync.RWMutex             // 编解码器及压缩器竞态锁，切换时持有写锁，保证切换前后的数据帧按序写入
+		FbFunc        PassiveCloseFeedbackFunc // 客户端断开反馈函数
 	}
 )
 
 // 此常量组定义了 Item 存在的状态
 const (
-	ItemStateCreate          ItemState = iota // 创建
-	ItemStateRunning                          // 运行
-	ItemStateInitiativeClose                  // 服务端主动关闭
-	ItemStatePassiveClose                     // 服务端被动关闭，即客户端主动断开
-	ItemStateUnKnowClose                      // 服务端接收到未知错误，主动关闭
+	ItemStateCreate            ItemState = iota // 创建
+	ItemStateRunning                            // 运行
+	ItemStateInitiativeClose                    // 服务端主动关闭
+	ItemStatePassiveClose                       // 服务端被动关闭，即客户端主动断开
+	ItemStateUnKnowClose                        // 服务端接收到未知错误，主动关闭
+	ItemStateTimeoutClose                       // 服务端检测到空闲超时，主动关闭
+	ItemStateKickedClose                        // 同一用户在其他连接登录，服务端主动关闭
+	ItemStateUnauthorizedClose                  // 认证失败或认证超时，服务端主动关闭
+	ItemStateFrameErrorClose                    // 装包者出现致命错误，如数据帧超过最大长度，或解密失败，服务端主动关闭
+	ItemStateHandshakeClose                     // 密钥交换握手失败，服务端主动关闭
 )
 
 // 此常量组定义了 Item 定义及实现中可能会发生的错误文本
@@ -68,15 +168,40 @@ const (
 
 // 新建端
 func NewItem(conn Conn, packager Packager, encrypter Encrypter) Item {
+	return newItem(oContext.Background(), conn, packager, encrypter)
+}
+
+// 新建端，标准库上下文派生自 parent
+func newItem(parent oContext.Context, conn Conn, packager Packager, encrypter Encrypter) *item {
 	id := ID(conn.UniqueSymbol()) // 对 Conn 的唯一标识进行包装
+	exchanger, _ := encrypter.(KeyExchanger)
+	ctx, cancel := oContext.WithCancel(parent)
+	now := time.Now()
 
 	return &item{
-		id:        EncryptID(id), // 加密
-		conn:      conn,
-		state:     ItemStateCreate,
-		packager:  packager,
-		encrypter: encrypter,
-		FbFunc:    nil,
+		lastRead:    now.UnixNano(),
+		lastWrite:   now.UnixNano(),
+		remoteAddr:  conn.RemoteAddr(),
+		peerCert:    verifiedPeerCertificate(conn),
+		upgrade:     upgradeInfo(conn),
+		connectedAt: now,
+		ctx:         ctx,
+		cancel:      cancel,
+		id:          EncryptID(id), // 加密
+		conn:        conn,
+		state:       ItemStateCreate,
+		mutex:       sync.Mutex{},
+		heartbeat:   DefaultHeartbeat(),
+		packager:    packager,
+		encrypter:   encrypter,
+		exchanger:   exchanger,
+		codec:       JSONCodec(),
+		codecs:      nil,
+		compressor:  nil,
+		compressors: nil,
+		threshold:   DefaultCompressThreshold,
+		pipeMutex:   sync.RWMutex{},
+		FbFunc:      nil,
 	}
 }
 
@@ -93,6 +218,16 @@ func (is ItemState) String() string {
 		return "PassiveClose"
 	case ItemStateUnKnowClose:
 		return "UnKnowClose"
+	case ItemStateTimeoutClose:
+		return "TimeoutClose"
+	case ItemStateKickedClose:
+		return "KickedClose"
+	case ItemStateUnauthorizedClose:
+		return "UnauthorizedClose"
+	case ItemStateFrameErrorClose:
+		return "FrameErrorClose"
+	case ItemStateHandshakeClose:
+		return "HandshakeClose"
 	default:
 		return "UnKnowState"
 	}
@@ -106,7 +241,7 @@ func (i *item) ID() ID {
 // 接收消息
 func (i *item) Receive(channel chan<- Message) {
 	// 运行状态
-	i.state = ItemStateRunning
+	i.setState(ItemStateRunning)
 	//log.Printf("[%s] start receive-%s", i.ID().String(), i.state.String())
 
 	var e error
@@ -117,64 +252,294 @@ func (i *item) Receive(channel chan<- Message) {
 			e = err
 			break
 		}
+		atomic.StoreInt64(&i.lastRead, time.Now().UnixNano())
+		atomic.AddInt64(&i.bytesIn, int64(len(b)))
 
 		// 解包数据，反序列化到 BaseRequest 结构中，附带上内部唯一标识，发送到 Service 的请求消息流 channel 中
-		for _, data := range i.packager.Unpack(b) {
+		// 装包者出现致命错误时，先处理已经解出的数据帧，再以 ItemStateFrameErrorClose 状态关闭
+		// 握手失败以 ItemStateHandshakeClose 状态关闭，会话密钥解密失败或标志位不符以 ItemStateFrameErrorClose 状态关闭
+		frames, err := unpack(i.packager, b)
+		flagged := hasFlags(i.packager)
+		closeState := ItemStateFrameErrorClose
+		for _, frame := range frames {
+			// 密钥交换握手，第一个数据帧必须是对端的握手数据
+			if i.exchanger != nil && !i.exchanger.Ready() {
+				xErr := ErrFrameFlags
+				if !flagged || frame.Flags.Has(FrameFlagHandshake) {
+					xErr = i.exchanger.Exchange(frame.Data)
+				}
+				if xErr != nil {
+					err, closeState = xErr, ItemStateHandshakeClose
+					break
+				}
+				continue
+			}
+
+			// 握手完成后的数据帧不能带有握手标志，会话密钥加密时必须带有加密标志
+			if flagged && (frame.Flags.Has(FrameFlagHandshake) || frame.Flags.Has(FrameFlagEncrypted) != (i.exchanger != nil)) {
+				metricEncrypterErrors.Inc()
+				err = ErrFrameFlags
+				break
+			}
+
+			decrypted := i.encrypter.Decrypt(frame.Data)
+			if decrypted == nil && i.exchanger != nil {
+				metricEncrypterErrors.Inc()
+				err = ErrDecryptFailed
+				break
+			}
+
+			// 编解码器及压缩器只在当前线程内切换，读取无需加锁
+			plain, dErr := decompress(i.compressor, decrypted, frame.Flags, flagged)
+			if dErr != nil {
+				log.ErrorF("[%s] decompress data error : %s", i.ID().String(), dErr.Error())
+				continue
+			}
+
 			request := Message{}
-			if err := request.Unmarshal(i.encrypter.Decrypt(data)); err != nil {
+			if err := i.codec.Unmarshal(plain, &request); err != nil {
+				// 解包完整但解密后无法反序列化，视为加密器错误
+				metricEncrypterErrors.Inc()
 				log.ErrorF("unmarshal data to BaseRequest error : %s", err.Error())
 				continue
 			}
 
 			request.ID = i.ID().String()
 
-			go func() {
-				if channel != nil {
-					channel <- request
+			// 心跳 ping 直接回复 pong ，pong 及其他带心跳标志位的数据帧直接忽略
+			if i.heartbeat.IsPing(request) {
+				i.Send(i.heartbeat.PongMessage())
+				continue
+			}
+			if i.heartbeat.IsPong(request) || frame.Flags.Has(FrameFlagHeartbeat) {
+				continue
+			}
+
+			// 编解码器及压缩协商
+			if isNegotiate(request) {
+				i.negotiate(request)
+				continue
+			}
+			if isCompressNegotiate(request) {
+				i.negotiateCompression(request)
+				continue
+			}
+
+			// 阻塞式推送，进入流已满时停止读取，对客户端形成背压，Item 关闭时放弃推送
+			if channel != nil {
+				select {
+				case channel <- request:
+				case <-i.ctx.Done():
 				}
-			}()
+			}
+		}
+
+		if err != nil {
+			log.ErrorF("[%s] receive frame error : %s", i.ID().String(), err.Error())
+			i.CloseWithState(closeState)
+			break
 		}
 	}
 
 	// 如果跳出了该读取循环，通过 e(error) 的值可以判断当前 Item 的关闭状态，根据不同的状态进行关闭处理
-	if e != nil {
+	// 已经以指定状态关闭的 Item 保持原状态
+	state := i.State()
+	if e != nil && state == ItemStateRunning {
 		if strings.Contains(e.Error(), EOFText) || strings.Contains(e.Error(), ContextCancelText) { // 客户端主动断开
-			i.state = ItemStatePassiveClose
+			state = ItemStatePassiveClose
 		} else if strings.Contains(e.Error(), ErrNetClosingText) { // 服务端主动断开
-			i.state = ItemStateInitiativeClose
+			state = ItemStateInitiativeClose
 		} else { // 未知错误
-			i.state = ItemStateUnKnowClose
+			state = ItemStateUnKnowClose
 			log.ErrorF("[%s] receive error : %s", i.ID().String(), e.Error())
 		}
+		i.setState(state)
 	}
 
 	// 客户端主动断开，服务端再调用一次 Close()
 	// 服务端主动关闭，会直接调用 Close()
 	// 捕获到未知错误，主动断开
-	if i.state == ItemStatePassiveClose || i.state == ItemStateUnKnowClose {
+	if state == ItemStatePassiveClose || state == ItemStateUnKnowClose {
 		i.Close()
 	}
 }
 
 // 发送消息
 func (i *item) Send(response Message) {
-	// 将 BaseResponse 序列化
-	data, err := response.Marshal()
+	i.pipeMutex.RLock()
+	defer i.pipeMutex.RUnlock()
+
+	frame, err := i.frame(response)
 	if err != nil {
 		log.ErrorF("[%s] unmarshal response error : %s", i.ID().String(), err.Error())
 		return
 	}
 
-	// 通过装包者打包，往 Item 持有的 Conn 中写入
-	if err := i.conn.Write(i.packager.Pack(i.encrypter.Encrypt(data))); err != nil {
-		i.state = ItemStateUnKnowClose
-		i.Close()
+	if err := i.SendFrame(frame); err == nil {
+		metricMessagesOut.Inc(response.Module, response.Route)
+	}
+}
+
+// 将消息以当前编解码器序列化、加密、打包为可直接写入的数据帧
+func (i *item) Frame(message Message) ([]byte, error) {
+	i.pipeMutex.RLock()
+	defer i.pipeMutex.RUnlock()
+
+	return i.frame(message)
+}
+
+// 将消息以当前编解码器序列化、压缩、加密、打包为可直接写入的数据帧
+// 调用方必须持有 i.pipeMutex
+func (i *item) frame(message Message) ([]byte, error) {
+	// 握手完成前不发送
+	if i.exchanger != nil && !i.exchanger.Ready() {
+		return nil, ErrHandshakeIncomplete
+	}
+
+	// 将 Message 序列化
+	data, err := i.codec.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	// 压缩
+	data, compressed, err := compress(i.compressor, i.threshold, data, hasFlags(i.packager))
+	if err != nil {
+		return nil, err
+	}
+	flags := messageFlags(i.heartbeat, message)
+	if compressed {
+		flags |= FrameFlagCompressed
+	}
+	if i.exchanger != nil {
+		flags |= FrameFlagEncrypted
+	}
+
+	// 通过装包者打包
+	return pack(i.packager, i.encrypter.Encrypt(data), flags), nil
+}
+
+// 写入已打包的数据帧
+func (i *item) SendFrame(frame []byte) error {
+	// 往 Item 持有的 Conn 中写入
+	if err := i.conn.Write(frame); err != nil {
 		log.ErrorF("[%s] send error : %s", i.ID().String(), err.Error())
+		i.CloseWithState(ItemStateUnKnowClose)
+		return err
+	}
+	atomic.StoreInt64(&i.lastWrite, time.Now().UnixNano())
+	atomic.AddInt64(&i.bytesOut, int64(len(frame)))
+
+	return nil
+}
+
+// 数据帧复用键
+func (i *item) FrameKey() string {
+	packagerKey, encrypterKey := packagerIdentity(i.packager), encrypterIdentity(i.encrypter)
+	if i.exchanger != nil || packagerKey == "" || encrypterKey == "" {
+		return i.id.String()
+	}
+
+	i.pipeMutex.RLock()
+	defer i.pipeMutex.RUnlock()
+
+	key := packagerKey + "/" + encrypterKey + "/" + i.codec.Name() + "/"
+	if i.compressor != nil {
+		key += i.compressor.Name()
+	}
+	return key
+}
+
+// 发送本端握手数据，加密器不需要密钥交换时不发送
+func (i *item) handshake() error {
+	if i.exchanger == nil {
+		return nil
+	}
+
+	hello, err := i.exchanger.Hello()
+	if err != nil {
+		return err
+	}
+
+	return i.SendFrame(pack(i.packager, hello, FrameFlagHandshake))
+}
+
+// 编解码器协商，支持时以原编解码器回复协商结果后切换，不支持时回复当前编解码器名
+// 持有写锁期间其他线程的发送等待，保证切换后的数据帧在协商回复之后写入
+func (i *item) negotiate(request Message) {
+	i.pipeMutex.Lock()
+	defer i.pipeMutex.Unlock()
+
+	codec, exist := i.codecs[string(request.Data)]
+	if !exist {
+		codec = i.codec
+		log.WarnF("[%s] codec [%s] unsupported, keep [%s]", i.ID().String(), string(request.Data), codec.Name())
+	}
+	if codec.Name() != CodecJSON && !byteSafe(i.encrypter) {
+		log.WarnF("[%s] codec [%s] refused, %s, keep [%s]", i.ID().String(), codec.Name(), ErrEncrypterNotByteSafeText, i.codec.Name())
+		codec = i.codec
+	}
+
+	frame, err := i.frame(Message{
+		Module: CodecModule,
+		Route:  CodecNegotiateRoute,
+		Data:   []byte(codec.Name()),
+		Reply:  request.Reply,
+	})
+	if err != nil {
+		log.ErrorF("[%s] marshal negotiation error : %s", i.ID().String(), err.Error())
+		return
+	}
+	if err := i.SendFrame(frame); err != nil {
+		return
 	}
+
+	i.codec = codec
+}
+
+// 压缩协商，选择第一个支持的压缩器，以原方式回复协商结果后切换，均不支持时回复空字符串且不压缩
+func (i *item) negotiateCompression(request Message) {
+	i.pipeMutex.Lock()
+	defer i.pipeMutex.Unlock()
+
+	var compressor Compressor
+	for _, name := range strings.Split(string(request.Data), CompressNameSeparator) {
+		if c, exist := i.compressors[name]; exist {
+			compressor = c
+			break
+		}
+	}
+	if compressor != nil && !byteSafe(i.encrypter) {
+		log.WarnF("[%s] compressor [%s] refused, %s", i.ID().String(), compressor.Name(), ErrEncrypterNotByteSafeText)
+		compressor = nil
+	}
+
+	name := ""
+	if compressor != nil {
+		name = compressor.Name()
+	}
+	frame, err := i.frame(Message{
+		Module: CodecModule,
+		Route:  CompressNegotiateRoute,
+		Data:   []byte(name),
+		Reply:  request.Reply,
+	})
+	if err != nil {
+		log.ErrorF("[%s] marshal compression negotiation error : %s", i.ID().String(), err.Error())
+		return
+	}
+	if err := i.SendFrame(frame); err != nil {
+		return
+	}
+
+	i.compressor = compressor
 }
 
 // 关闭
 func (i *item) Close() {
+	// 取消标准库上下文
+	i.cancel()
+
 	if err := i.conn.Close(); err != nil {
 		log.ErrorF("[%s] close error : %s", i.ID().String(), err.Error())
 	}
@@ -182,14 +547,126 @@ func (i *item) Close() {
 	// 向上反馈给 Service 持有的 Manager ， Manager 会通过钩子函数向业务反馈
 	if i.FbFunc != nil {
 		if err := i.FbFunc(i.ID().String()); err != nil {
-			log.ErrorF("[%s] - [%s] close feedback error -%s", i.ID().String(), i.state.String(), err.Error())
+			log.ErrorF("[%s] - [%s] close feedback error -%s", i.ID().String(), i.State().String(), err.Error())
 		}
 	}
 	//log.Printf("[%s] closed-%s", i.ID().String(), i.state.String())
 }
 
+// 以指定状态关闭
+func (i *item) CloseWithState(state ItemState) {
+	i.setState(state)
+	i.Close()
+}
+
+// 当前状态
+func (i *item) State() ItemState {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.state
+}
+
+// 设置状态
+func (i *item) setState(state ItemState) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.state = state
+}
+
+// 最后一次读取到数据的时间
+func (i *item) LastRead() time.Time {
+	last := time.Unix(0, atomic.LoadInt64(&i.lastRead))
+	if ac, ok := i.conn.(ActiveConn); ok && ac.LastActive().After(last) {
+		return ac.LastActive()
+	}
+
+	return last
+}
+
+// 最后一次写入数据的时间
+func (i *item) LastWrite() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&i.lastWrite))
+}
+
 // 客户端断开反馈
 func (i *item) PassiveCloseFeedback(function PassiveCloseFeedbackFunc) {
 	// 持有断开反馈钩子函数
 	i.FbFunc = function
 }
+
+// 获取标准库上下文
+func (i *item) Context() oContext.Context {
+	return i.ctx
+}
+
+// 设置认证主体，同时标记为已认证
+func (i *item) SetPrincipal(principal interface{}) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.principal = principal
+	i.authenticated = true
+}
+
+// 认证主体
+func (i *item) Principal() interface{} {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.principal
+}
+
+// 是否已认证
+func (i *item) IsAuthenticated() bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.authenticated
+}
+
+// 所属入口名
+func (i *item) Gate() string {
+	return i.gate
+}
+
+// 对端地址
+func (i *item) RemoteAddr() string {
+	return i.remoteAddr
+}
+
+// 校验通过的对端证书
+func (i *item) PeerCertificate() *x509.Certificate {
+	return i.peerCert
+}
+
+// 升级请求信息
+func (i *item) Upgrade() *UpgradeInfo {
+	return i.upgrade
+}
+
+// 建立时间
+func (i *item) ConnectedAt() time.Time {
+	return i.connectedAt
+}
+
+// 读取的字节数
+func (i *item) BytesIn() int64 {
+	return atomic.LoadInt64(&i.bytesIn)
+}
+
+// 写入的字节数
+func (i *item) BytesOut() int64 {
+	return atomic.LoadInt64(&i.bytesOut)
+}
+
+// 当前使用的编解码器
+func (i *item) Codec() Codec {
+	i.pipeMutex.RLock()
+	defer i.pipeMutex.RUnlock()
+	return i.codec
+}
+
+// 当前使用的压缩器
+func (i *item) Compressor() Compressor {
+	i.pipeMutex.RLock()
+	defer i.pipeMutex.RUnlock()
+	return i.compressor
+}
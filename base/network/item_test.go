@@ -0,0 +1,66 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+// 非内置实现的加密器
+type reverseEncrypter struct{}
+
+func (reverseEncrypter) Encrypt(data []byte) []byte { return reverse(data) }
+
+func (reverseEncrypter) Decrypt(data []byte) []byte { return reverse(data) }
+
+// 以管道连接新建端
+func pipeItem(t *testing.T, packager Packager, encrypter Encrypter) Item {
+	c, peer := net.Pipe()
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = peer.Close()
+	})
+
+	return NewItem(NewSocketConn(c), packager, encrypter)
+}
+
+func TestFrameKey(t *testing.T) {
+	checksum := FrameOption{Checksum: true}
+	same := [][2]Item{
+		{pipeItem(t, DefaultPackager(), DefaultEncrypter()), pipeItem(t, DefaultPackager(), DefaultEncrypter())},
+		{pipeItem(t, plainPackager{}, plainEncrypter{}), pipeItem(t, plainPackager{}, plainEncrypter{})},
+		{pipeItem(t, NewFramePackager(checksum), DefaultEncrypter()), pipeItem(t, NewFramePackager(checksum), DefaultEncrypter())},
+	}
+	for _, items := range same {
+		if items[0].FrameKey() != items[1].FrameKey() {
+			t.Fatalf("same pipeline must share frame key : %s , %s", items[0].FrameKey(), items[1].FrameKey())
+		}
+	}
+
+	// 装包者、加密器或其选项不同时数据帧不同，不能复用
+	different := []Item{
+		same[0][0],
+		same[1][0],
+		same[2][0],
+		pipeItem(t, NewFramePackager(FrameOption{}), DefaultEncrypter()),
+		pipeItem(t, DefaultPackager(), plainEncrypter{}),
+		pipeItem(t, DefaultPackager(), NewSETer("frank", DefaultCommonDivisor)),
+		pipeItem(t, DefaultPackager(), NewSETer(DefaultEncryptionKey, 7)),
+	}
+	keys := make(map[string]bool)
+	for _, i := range different {
+		if keys[i.FrameKey()] {
+			t.Fatalf("frame key [%s] must not be shared", i.FrameKey())
+		}
+		keys[i.FrameKey()] = true
+	}
+
+	// 会话密钥及非内置实现无法复用
+	for _, i := range []Item{
+		pipeItem(t, DefaultPackager(), NewSessionEncrypter(CipherAESGCM)),
+		pipeItem(t, DefaultPackager(), reverseEncrypter{}),
+	} {
+		if i.FrameKey() != i.ID().String() {
+			t.Fatalf("frame key = %s , want item id", i.FrameKey())
+		}
+	}
+}
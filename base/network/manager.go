@@ -1,12 +1,19 @@
 // Manager 是 Item 管理者的角色，对外提供函数供外部调用来管理由 Gate 下放的 Conn 构建成的 Item
+// Manager 支持以组(房间)的形式管理 Item ，组内广播时消息只序列化、加密、打包一次，Item 移除时自动退出所有组
+// Manager 支持将任意用户键绑定到 Item ，一个用户可以绑定多个 Item (多设备)，BindPolicyKickPrevious 策略下新绑定会踢掉旧连接，
+// Item 移除时自动解除绑定
 package network
 
 import (
 	"errors"
+	"jarvis/base/log"
 	"sync"
 )
 
 type (
+	// 用户绑定策略
+	BindPolicy int
+
 	// 端管理者定义
 	Manager interface {
 		// 添加一个端到当前管理
@@ -23,14 +30,64 @@ type (
 
 		// 注册观察者
 		RegisterObserver(Observer)
+
+		// 当前管理的所有端快照
+		Items() []Item
+
+		// 通知实现了 ShutdownObserver 的观察者服务已关闭
+		NotifyShutdown()
+
+		// 将指定 id 的端加入组，组不存在时新建
+		JoinGroup(group, id string) error
+
+		// 将指定 id 的端移出组，组内无成员时移除组
+		LeaveGroup(group, id string) error
+
+		// 组内成员 id 列表
+		GroupMembers(group string) []string
+
+		// 指定 id 的端所在的组列表
+		ItemGroups(id string) []string
+
+		// 向组内所有成员广播
+		Broadcast(group string, message Message) error
+
+		// 向所有被管理的端广播
+		BroadcastAll(message Message) error
+
+		// 设置用户绑定策略
+		SetBindPolicy(BindPolicy)
+
+		// 用户绑定策略
+		BindPolicy() BindPolicy
+
+		// 将用户键绑定到指定 id 的端，端已绑定其他用户时改为绑定新用户
+		BindUser(id, userKey string) error
+
+		// 解除指定 id 的端的用户绑定，钩住集群时同时解除集群中的登记
+		UnbindUser(id string) error
+
+		// 指定 id 的端绑定的用户键，未绑定时为空
+		UserKey(id string) string
+
+		// 寻找用户绑定的所有端
+		FindByUser(userKey string) []Item
+
+		// 钩住集群，解除用户绑定时同时解除集群中的登记
+		HookCluster(Cluster)
 	}
 
 	// 端管理者定义实现
 	manager struct {
-		max       int64           // 最大管理连接
-		mutex     sync.Mutex      // 端管理竞态锁
-		items     map[string]Item // 端管理
-		observers []Observer      // 观察者列表
+		max       int64                          // 最大管理连接
+		mutex     sync.Mutex                     // 端管理竞态锁
+		items     map[string]Item                // 端管理
+		observers []Observer                     // 观察者列表
+		groups    map[string]map[string]struct{} // 组，map[组名]map[端 id]
+		policy    BindPolicy                     // 用户绑定策略
+		users     map[string]map[string]struct{} // 用户绑定，map[用户键]map[端 id]
+		bindings  map[string]string              // 端绑定的用户，map[端 id]用户键
+		cluster   Cluster                        // 集群，为 nil 时只解除本地绑定
 	}
 )
 
@@ -38,13 +95,23 @@ const (
 	DefaultMaxConnection = 5000 // 默认最大端管理数
 )
 
+// 此常量组定义了用户绑定策略
+const (
+	BindPolicyMultiple     BindPolicy = iota // 允许同一用户绑定多个端
+	BindPolicyKickPrevious                   // 同一用户再次绑定时，关闭之前绑定的端
+)
+
 // 此常量组定义了 Manager 定义及实现中可能会发生的错误文本
 const (
-	ErrNilItemText     = "item is nil"
-	ErrNilIdText       = "id is nil"
-	ErrMaxConnectText  = "already reach max connect"
-	ErrItemExistText   = "the id of item already exist"
-	ErrItemUnExistText = "the id of item doesn't exist"
+	ErrNilItemText      = "item is nil"
+	ErrNilIdText        = "id is nil"
+	ErrMaxConnectText   = "already reach max connect"
+	ErrItemExistText    = "the id of item already exist"
+	ErrItemUnExistText  = "the id of item doesn't exist"
+	ErrEmptyGroupText   = "group name is empty"
+	ErrGroupUnExistText = "group doesn't exist"
+	ErrEmptyUserKeyText = "user key is empty"
+	ErrUnboundText      = "item is not bound to any user"
 )
 
 // 此常量组定义了 Manager 定义及实现中可能会发生的错误
@@ -59,6 +126,14 @@ var (
 	ErrItemExist = errors.New(ErrItemExistText)
 	// item 的 id 不存在 错误
 	ErrItemUnExist = errors.New(ErrItemUnExistText)
+	// 组名为空 错误
+	ErrEmptyGroup = errors.New(ErrEmptyGroupText)
+	// 组不存在 错误
+	ErrGroupUnExist = errors.New(ErrGroupUnExistText)
+	// 用户键为空 错误
+	ErrEmptyUserKey = errors.New(ErrEmptyUserKeyText)
+	// 端未绑定用户 错误
+	ErrUnbound = errors.New(ErrUnboundText)
 )
 
 // 新建端管理者
@@ -72,6 +147,10 @@ func NewManage(max int64) Manager {
 		mutex:     sync.Mutex{},
 		items:     make(map[string]Item),
 		observers: make([]Observer, 0),
+		groups:    make(map[string]map[string]struct{}),
+		policy:    BindPolicyMultiple,
+		users:     make(map[string]map[string]struct{}),
+		bindings:  make(map[string]string),
 	}
 }
 
@@ -86,16 +165,19 @@ func (m *manager) ManageItem(i Item) error {
 
 	// 已存在
 	if _, exist := m.items[i.ID().String()]; exist {
+		metricManageRejected.Inc("exist")
 		return ErrItemExist
 	}
 
 	// 最大管理数校验
 	if int64(len(m.items)) > m.max {
+		metricManageRejected.Inc("max")
 		return ErrMaxConnect
 	}
 
 	// 持有
 	m.items[i.ID().String()] = i
+	metricManageAccepted.Inc()
 
 	for _, observer := range m.observers {
 		go observer.ObserveConnect(i.ID().String())
@@ -120,8 +202,16 @@ func (m *manager) RemoveItem(id string) error {
 		return ErrItemUnExist
 	}
 
-	// 删除
+	// 删除，并退出所有组
 	delete(m.items, id)
+	for group, members := range m.groups {
+		delete(members, id)
+		if len(members) == 0 {
+			delete(m.groups, group)
+		}
+	}
+	// 解除用户绑定
+	m.unbind(id)
 
 	for _, observer := range m.observers {
 		go observer.ObserveDisconnect(id)
@@ -164,5 +254,315 @@ func (m *manager) RegisterObserver(observer Observer) {
 	// 新建空 Message 上下文钩住端管理者的寻找端函数，观察者主动使用此函数往端发送 Message
 	ctx := NewContext(Message{})
 	ctx.HookFind(m.FindItem)
+	ctx.HookManager(m)
 	go observer.InitiativeSend(ctx)
 }
+
+// 当前管理的所有端快照
+func (m *manager) Items() []Item {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	items := make([]Item, 0, len(m.items))
+	for _, i := range m.items {
+		items = append(items, i)
+	}
+
+	return items
+}
+
+// 通知实现了 ShutdownObserver 的观察者服务已关闭
+func (m *manager) NotifyShutdown() {
+	for _, observer := range m.observers {
+		if so, ok := observer.(ShutdownObserver); ok {
+			so.ObserveShutdown()
+		}
+	}
+}
+
+// 将指定 id 的端加入组
+func (m *manager) JoinGroup(group, id string) error {
+	if group == "" {
+		return ErrEmptyGroup
+	}
+	if id == "" {
+		return ErrNilId
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// 只有被管理的端可以加入组
+	if _, exist := m.items[id]; !exist {
+		return ErrItemUnExist
+	}
+
+	members, exist := m.groups[group]
+	if !exist {
+		members = make(map[string]struct{})
+		m.groups[group] = members
+	}
+	members[id] = struct{}{}
+
+	return nil
+}
+
+// 将指定 id 的端移出组
+func (m *manager) LeaveGroup(group, id string) error {
+	if group == "" {
+		return ErrEmptyGroup
+	}
+	if id == "" {
+		return ErrNilId
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	members, exist := m.groups[group]
+	if !exist {
+		return ErrGroupUnExist
+	}
+	if _, exist := members[id]; !exist {
+		return ErrItemUnExist
+	}
+
+	delete(members, id)
+	if len(members) == 0 {
+		delete(m.groups, group)
+	}
+
+	return nil
+}
+
+// 组内成员 id 列表
+func (m *manager) GroupMembers(group string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]string, 0, len(m.groups[group]))
+	for id := range m.groups[group] {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// 指定 id 的端所在的组列表
+func (m *manager) ItemGroups(id string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	groups := make([]string, 0)
+	for group, members := range m.groups {
+		if _, exist := members[id]; exist {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
+
+// 向组内所有成员广播
+func (m *manager) Broadcast(group string, message Message) error {
+	if group == "" {
+		return ErrEmptyGroup
+	}
+
+	m.mutex.Lock()
+	members, exist := m.groups[group]
+	if !exist {
+		m.mutex.Unlock()
+		return ErrGroupUnExist
+	}
+	items := make([]Item, 0, len(members))
+	for id := range members {
+		if i, exist := m.items[id]; exist {
+			items = append(items, i)
+		}
+	}
+	m.mutex.Unlock()
+
+	return broadcast(items, message)
+}
+
+// 向所有被管理的端广播
+func (m *manager) BroadcastAll(message Message) error {
+	return broadcast(m.Items(), message)
+}
+
+// 广播，消息对每个数据帧复用键只序列化、压缩、加密、打包一次，复用键相同的端写入同一个数据帧
+// 使用会话密钥或非内置装包者、加密器的端各自生成数据帧，直通端与普通端不会共用数据帧，无法生成数据帧的端跳过
+func broadcast(items []Item, message Message) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	frames := make(map[string][]byte) // map[数据帧复用键]数据帧
+	for _, i := range items {
+		key := i.FrameKey()
+		frame, exist := frames[key]
+		if !exist {
+			f, err := i.Frame(message)
+			if err != nil {
+				log.ErrorF("broadcast frame to [%s] error : %s", i.ID().String(), err.Error())
+				continue
+			}
+			frame = f
+			frames[key] = frame
+		}
+
+		if err := i.SendFrame(frame); err != nil {
+			log.ErrorF("broadcast to [%s] error : %s", i.ID().String(), err.Error())
+			continue
+		}
+		metricMessagesOut.Inc(message.Module, message.Route)
+	}
+
+	return nil
+}
+
+// 用户绑定策略可读化
+func (bp BindPolicy) String() string {
+	switch bp {
+	case BindPolicyMultiple:
+		return "Multiple"
+	case BindPolicyKickPrevious:
+		return "KickPrevious"
+	default:
+		return "UnKnowPolicy"
+	}
+}
+
+// 设置用户绑定策略
+func (m *manager) SetBindPolicy(policy BindPolicy) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.policy = policy
+}
+
+// 用户绑定策略
+func (m *manager) BindPolicy() BindPolicy {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.policy
+}
+
+// 将用户键绑定到指定 id 的端
+func (m *manager) BindUser(id, userKey string) error {
+	if id == "" {
+		return ErrNilId
+	}
+	if userKey == "" {
+		return ErrEmptyUserKey
+	}
+
+	m.mutex.Lock()
+
+	if _, exist := m.items[id]; !exist {
+		m.mutex.Unlock()
+		return ErrItemUnExist
+	}
+
+	// 已绑定其他用户，先解除
+	m.unbind(id)
+
+	// 踢掉之前绑定的端，关闭在锁外进行，关闭时会回调 RemoveItem()
+	kicked := make([]Item, 0)
+	if m.policy == BindPolicyKickPrevious {
+		for previous := range m.users[userKey] {
+			if i, exist := m.items[previous]; exist {
+				kicked = append(kicked, i)
+			}
+			m.unbind(previous)
+		}
+	}
+
+	ids, exist := m.users[userKey]
+	if !exist {
+		ids = make(map[string]struct{})
+		m.users[userKey] = ids
+	}
+	ids[id] = struct{}{}
+	m.bindings[id] = userKey
+
+	m.mutex.Unlock()
+
+	for _, i := range kicked {
+		log.InfoF("[%s] kicked by [%s] for user [%s]", i.ID().String(), id, userKey)
+		i.CloseWithState(ItemStateKickedClose)
+	}
+
+	return nil
+}
+
+// 解除指定 id 的端的用户绑定
+func (m *manager) UnbindUser(id string) error {
+	if id == "" {
+		return ErrNilId
+	}
+
+	m.mutex.Lock()
+	if _, exist := m.bindings[id]; !exist {
+		m.mutex.Unlock()
+		return ErrUnbound
+	}
+	m.unbind(id)
+	cluster := m.cluster
+	m.mutex.Unlock()
+
+	if cluster == nil {
+		return nil
+	}
+
+	return cluster.UnbindUser(id)
+}
+
+// 钩住集群
+func (m *manager) HookCluster(cluster Cluster) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cluster = cluster
+}
+
+// 指定 id 的端绑定的用户键
+func (m *manager) UserKey(id string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.bindings[id]
+}
+
+// 寻找用户绑定的所有端
+func (m *manager) FindByUser(userKey string) []Item {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	items := make([]Item, 0, len(m.users[userKey]))
+	for id := range m.users[userKey] {
+		if i, exist := m.items[id]; exist {
+			items = append(items, i)
+		}
+	}
+
+	return items
+}
+
+// 解除绑定，调用方必须持有锁
+func (m *manager) unbind(id string) {
+	userKey, exist := m.bindings[id]
+	if !exist {
+		return
+	}
+
+	delete(m.bindings, id)
+	if ids, exist := m.users[userKey]; exist {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(m.users, userKey)
+		}
+	}
+}
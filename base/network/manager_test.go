@@ -0,0 +1,224 @@
+package network
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// 记录数据帧生成次数及写入数据帧的端
+type recordItem struct {
+	Item
+	mutex  *sync.Mutex
+	frames *int
+	sent   [][]byte
+}
+
+func (ri *recordItem) Frame(message Message) ([]byte, error) {
+	ri.mutex.Lock()
+	*ri.frames++
+	ri.mutex.Unlock()
+
+	return ri.Item.Frame(message)
+}
+
+func (ri *recordItem) SendFrame(frame []byte) error {
+	ri.sent = append(ri.sent, frame)
+	return nil
+}
+
+func TestGroupJoinLeave(t *testing.T) {
+	m := NewManage(10)
+	a, b := pipeItem(t, DefaultPackager(), DefaultEncrypter()), pipeItem(t, DefaultPackager(), DefaultEncrypter())
+	if err := m.ManageItem(a); err != nil {
+		t.Fatal(err)
+	}
+	aID, bID := a.ID().String(), b.ID().String()
+
+	// 只有被管理的端可以加入组
+	if err := m.JoinGroup("room", bID); err != ErrItemUnExist {
+		t.Fatalf("join unmanaged = %v , want %v", err, ErrItemUnExist)
+	}
+	if err := m.JoinGroup("", aID); err != ErrEmptyGroup {
+		t.Fatalf("join empty group = %v , want %v", err, ErrEmptyGroup)
+	}
+	if err := m.ManageItem(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, join := range [][2]string{{"room", aID}, {"room", bID}, {"lobby", aID}} {
+		if err := m.JoinGroup(join[0], join[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	members := m.GroupMembers("room")
+	sort.Strings(members)
+	want := []string{aID, bID}
+	sort.Strings(want)
+	if len(members) != 2 || members[0] != want[0] || members[1] != want[1] {
+		t.Fatalf("room members = %v , want %v", members, want)
+	}
+	if groups := m.ItemGroups(aID); len(groups) != 2 {
+		t.Fatalf("groups of a = %v , want room and lobby", groups)
+	}
+
+	// 最后一个成员离开后组被移除
+	if err := m.LeaveGroup("lobby", bID); err != ErrItemUnExist {
+		t.Fatalf("leave without joining = %v , want %v", err, ErrItemUnExist)
+	}
+	if err := m.LeaveGroup("lobby", aID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LeaveGroup("lobby", aID); err != ErrGroupUnExist {
+		t.Fatalf("leave removed group = %v , want %v", err, ErrGroupUnExist)
+	}
+	if err := m.Broadcast("lobby", Message{}); err != ErrGroupUnExist {
+		t.Fatalf("broadcast removed group = %v , want %v", err, ErrGroupUnExist)
+	}
+
+	// 移除的端退出所有组
+	if err := m.RemoveItem(bID); err != nil {
+		t.Fatal(err)
+	}
+	if members := m.GroupMembers("room"); len(members) != 1 || members[0] != aID {
+		t.Fatalf("room members after remove = %v , want [%s]", members, aID)
+	}
+	if groups := m.ItemGroups(bID); len(groups) != 0 {
+		t.Fatalf("groups of removed item = %v , want none", groups)
+	}
+}
+
+func TestBroadcastFrameReuse(t *testing.T) {
+	mutex, frames := &sync.Mutex{}, 0
+	record := func(i Item) *recordItem {
+		return &recordItem{Item: i, mutex: mutex, frames: &frames}
+	}
+	same := []*recordItem{
+		record(pipeItem(t, DefaultPackager(), DefaultEncrypter())),
+		record(pipeItem(t, DefaultPackager(), DefaultEncrypter())),
+	}
+	other := record(pipeItem(t, NewFramePackager(FrameOption{Checksum: true}), DefaultEncrypter()))
+
+	m := NewManage(10)
+	for _, i := range append(same, other) {
+		if err := m.ManageItem(i); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.JoinGroup("room", i.ID().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Broadcast("room", Message{Module: "test", Route: "echo", Data: []byte("jarvis")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 复用键相同的端共用一个数据帧，不同的端各自生成
+	if frames != 2 {
+		t.Fatalf("frames = %d , want 2", frames)
+	}
+	for _, i := range append(same, other) {
+		if len(i.sent) != 1 {
+			t.Fatalf("[%s] sent %d frames , want 1", i.ID().String(), len(i.sent))
+		}
+	}
+	if !bytes.Equal(same[0].sent[0], same[1].sent[0]) {
+		t.Fatal("items with the same frame key must receive the same frame")
+	}
+	if bytes.Equal(same[0].sent[0], other.sent[0]) {
+		t.Fatal("items with different frame keys must not share a frame")
+	}
+}
+
+func TestBindUserKickPrevious(t *testing.T) {
+	m := NewManage(10)
+	m.SetBindPolicy(BindPolicyKickPrevious)
+	items := []Item{
+		pipeItem(t, DefaultPackager(), DefaultEncrypter()),
+		pipeItem(t, DefaultPackager(), DefaultEncrypter()),
+		pipeItem(t, DefaultPackager(), DefaultEncrypter()),
+	}
+	for _, i := range items {
+		if err := m.ManageItem(i); err != nil {
+			t.Fatal(err)
+		}
+		i.PassiveCloseFeedback(m.RemoveItem)
+	}
+	first, second, other := items[0].ID().String(), items[1].ID().String(), items[2].ID().String()
+
+	if err := m.BindUser(first, "frank"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.BindUser(other, "jarvis"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一用户再次绑定时踢掉之前的端，关闭后从管理中移除，其他用户不受影响
+	if err := m.BindUser(second, "frank"); err != nil {
+		t.Fatal(err)
+	}
+	if items[0].State() != ItemStateKickedClose {
+		t.Fatalf("previous state = %s , want %s", items[0].State(), ItemStateKickedClose)
+	}
+	if _, err := m.FindItem(first); err != ErrItemUnExist {
+		t.Fatalf("find kicked = %v , want %v", err, ErrItemUnExist)
+	}
+	if m.UserKey(first) != "" {
+		t.Fatal("kicked item must be unbound")
+	}
+	if found := m.FindByUser("frank"); len(found) != 1 || found[0].ID().String() != second {
+		t.Fatalf("user frank = %d items , want only [%s]", len(found), second)
+	}
+	if m.UserKey(other) != "jarvis" || items[2].State() == ItemStateKickedClose {
+		t.Fatal("other user must stay bound")
+	}
+
+	// 重复绑定自身不会被踢
+	if err := m.BindUser(second, "frank"); err != nil {
+		t.Fatal(err)
+	}
+	if items[1].State() == ItemStateKickedClose || m.UserKey(second) != "frank" {
+		t.Fatal("rebinding the same item must not kick it")
+	}
+}
+
+// 记录解除绑定的集群
+type unbindCluster struct {
+	Cluster
+	unbound []string
+}
+
+func (uc *unbindCluster) UnbindUser(id string) error {
+	uc.unbound = append(uc.unbound, id)
+	return nil
+}
+
+func TestUnbindUserClearsCluster(t *testing.T) {
+	m := NewManage(10)
+	c := &unbindCluster{}
+	m.HookCluster(c)
+
+	i := pipeItem(t, DefaultPackager(), DefaultEncrypter())
+	if err := m.ManageItem(i); err != nil {
+		t.Fatal(err)
+	}
+	id := i.ID().String()
+	if err := m.UnbindUser(id); err != ErrUnbound {
+		t.Fatalf("unbind unbound = %v , want %v", err, ErrUnbound)
+	}
+	if err := m.BindUser(id, "frank"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 解除本地绑定的同时解除集群中的登记
+	if err := m.UnbindUser(id); err != nil {
+		t.Fatal(err)
+	}
+	if m.UserKey(id) != "" || len(m.FindByUser("frank")) != 0 {
+		t.Fatal("item must be unbound locally")
+	}
+	if len(c.unbound) != 1 || c.unbound[0] != id {
+		t.Fatalf("cluster unbound = %v , want [%s]", c.unbound, id)
+	}
+}
@@ -25,8 +25,16 @@ const (
 	ReplySuccessCode = 200
 	// 请求不正确
 	ReplyBadRequestCode = 400
+	// 未认证
+	ReplyUnauthorizedCode = 401
+	// 模块或路由不存在
+	ReplyNotFoundCode = 404
+	// 请求过于频繁
+	ReplyTooManyRequestsCode = 429
 	// 服务器错误
 	ReplyServerErrorCode = 500
+	// 服务过载
+	ReplyOverloadCode = 503
 )
 
 var (
@@ -34,16 +42,24 @@ var (
 	ReplySuccessMessage = "Success"
 	// 请求不正确
 	ReplyBadRequestMessage = "Bad request"
+	// 未认证
+	ReplyUnauthorizedMessage = "Unauthorized"
+	// 模块或路由不存在
+	ReplyNotFoundMessage = "Not found"
+	// 请求过于频繁
+	ReplyTooManyRequestsMessage = "Too many requests"
 	// 服务器错误
 	ReplyServerErrorMessage = "Server error"
+	// 服务过载
+	ReplyOverloadMessage = "Service overload"
 )
 
-// 反序列化
+// 以 JSON 反序列化，等同于 JSONCodec() ，连接中的消息以协商的编解码器反序列化
 func (m *Message) Unmarshal(b []byte) error {
 	return json.Unmarshal(b, m)
 }
 
-// 序列化
+// 以 JSON 序列化，等同于 JSONCodec() ，连接中的消息以协商的编解码器序列化
 func (m *Message) Marshal() ([]byte, error) {
 	return json.Marshal(m)
 }
@@ -64,6 +80,30 @@ func ReplyBadRequest(data []byte) Reply {
 	}
 }
 
+func ReplyUnauthorized(data []byte) Reply {
+	return Reply{
+		Code:    ReplyUnauthorizedCode,
+		Message: ReplyUnauthorizedMessage,
+		Data:    data,
+	}
+}
+
+func ReplyNotFound(data []byte) Reply {
+	return Reply{
+		Code:    ReplyNotFoundCode,
+		Message: ReplyNotFoundMessage,
+		Data:    data,
+	}
+}
+
+func ReplyTooManyRequests(data []byte) Reply {
+	return Reply{
+		Code:    ReplyTooManyRequestsCode,
+		Message: ReplyTooManyRequestsMessage,
+		Data:    data,
+	}
+}
+
 func ReplyServerError(data []byte) Reply {
 	return Reply{
 		Code:    ReplyServerErrorCode,
@@ -71,3 +111,11 @@ func ReplyServerError(data []byte) Reply {
 		Data:    data,
 	}
 }
+
+func ReplyOverload(data []byte) Reply {
+	return Reply{
+		Code:    ReplyOverloadCode,
+		Message: ReplyOverloadMessage,
+		Data:    data,
+	}
+}
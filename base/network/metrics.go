@@ -0,0 +1,66 @@
+package network
+
+import (
+	"jarvis/base/metrics"
+	"sync"
+)
+
+// 此变量组定义了 network 在默认指标登记处登记的指标
+var (
+	// 各入口的活跃连接数
+	metricActiveConnections = metrics.NewGauge("jarvis_network_active_connections", "Active connections per gate.", "gate")
+	// 端管理接纳数
+	metricManageAccepted = metrics.NewCounter("jarvis_network_manage_accepted_total", "Items accepted by manager.")
+	// 端管理拒绝数
+	metricManageRejected = metrics.NewCounter("jarvis_network_manage_rejected_total", "Items rejected by manager.", "reason")
+	// 进入的消息数，模式路由以模式为路由名
+	metricMessagesIn = metrics.NewCounter("jarvis_network_messages_in_total", "Routed messages received.", "module", "route")
+	// 模块或路由不存在的消息数
+	metricMessagesNotFound = metrics.NewCounter("jarvis_network_messages_not_found_total", "Messages with unknown module or route.")
+	// 发出的消息数
+	metricMessagesOut = metrics.NewCounter("jarvis_network_messages_out_total", "Messages sent.", "module", "route")
+	// 调用链执行耗时，模式路由以模式为路由名
+	metricHandleSeconds = metrics.NewHistogram("jarvis_network_handle_seconds", "Call linked list run latency in seconds.", metrics.DefaultBuckets, "module", "route")
+	// 装包者错误数
+	metricPackagerErrors = metrics.NewCounter("jarvis_network_packager_errors_total", "Packager errors.")
+	// 加密器错误数
+	metricEncrypterErrors = metrics.NewCounter("jarvis_network_encrypter_errors_total", "Encrypter errors.")
+	// UDP 入口丢弃的数据报数
+	metricUDPDropped = metrics.NewCounter("jarvis_network_udp_dropped_total", "UDP datagrams dropped.", "reason")
+)
+
+// 此变量组记录运行中的 Service ，用于统计进入流积压深度
+var (
+	// 运行中的 Service
+	runningServices = make(map[*service]struct{})
+	// 运行中的 Service 竞态锁
+	runningServicesMutex = sync.Mutex{}
+)
+
+func init() {
+	// 进入流积压深度，只登记一次，为所有运行中 Service 的合计
+	metrics.NewGaugeFunc("jarvis_network_into_stream_depth", "Messages waiting in IntoStream of running services.", func() float64 {
+		runningServicesMutex.Lock()
+		defer runningServicesMutex.Unlock()
+
+		depth := 0
+		for s := range runningServices {
+			depth += len(s.IntoStream)
+		}
+		return float64(depth)
+	})
+}
+
+// 记录运行中的 Service
+func trackService(s *service) {
+	runningServicesMutex.Lock()
+	defer runningServicesMutex.Unlock()
+	runningServices[s] = struct{}{}
+}
+
+// 移除关闭的 Service
+func untrackService(s *service) {
+	runningServicesMutex.Lock()
+	defer runningServicesMutex.Unlock()
+	delete(runningServices, s)
+}
@@ -0,0 +1,41 @@
+package network
+
+import (
+	"bytes"
+	"jarvis/base/metrics"
+	"strings"
+	"testing"
+)
+
+func TestIntoStreamDepth(t *testing.T) {
+	depth := func() string {
+		buffer := &bytes.Buffer{}
+		if err := metrics.Write(buffer); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(buffer.String(), "\n") {
+			if strings.HasPrefix(line, "jarvis_network_into_stream_depth ") {
+				return line
+			}
+		}
+		return ""
+	}
+
+	// 新建但未运行的 Service 不影响积压深度
+	s := NewService(10, 10).(*service)
+	s.IntoStream <- Message{}
+	if line := depth(); line != "jarvis_network_into_stream_depth 0" {
+		t.Fatalf("depth of idle service = %q", line)
+	}
+
+	trackService(s)
+	defer untrackService(s)
+	other := NewService(10, 10).(*service)
+	trackService(other)
+	defer untrackService(other)
+	other.IntoStream <- Message{}
+	other.IntoStream <- Message{}
+	if line := depth(); line != "jarvis_network_into_stream_depth 3" {
+		t.Fatalf("depth of running services = %q", line)
+	}
+}
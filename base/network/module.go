@@ -1,6 +1,9 @@
 package network
 
-import "errors"
+import (
+	"errors"
+	"sync"
+)
 
 type (
 	// 模块定义
@@ -14,7 +17,9 @@ type (
 
 	// 模块定义实现
 	module struct {
-		route map[string][]RouteHandleFunc // 路由簇
+		route   map[string][]RouteHandleFunc // 路由簇
+		service Service                      // 已注册到的服务，注册后新增的路由热添加到该服务
+		mutex   sync.Mutex                   // 路由簇竞态锁
 	}
 )
 
@@ -44,6 +49,7 @@ var (
 	// 默认内部模块
 	defaultModule = &module{
 		route: make(map[string][]RouteHandleFunc),
+		mutex: sync.Mutex{},
 	}
 )
 
@@ -52,9 +58,17 @@ func (m *module) Name() string {
 	return DefaultModuleName
 }
 
-// 模块路由
+// 模块路由，返回副本
 func (m *module) Route() map[string][]RouteHandleFunc {
-	return m.route
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	route := make(map[string][]RouteHandleFunc, len(m.route))
+	for path, handleFuncList := range m.route {
+		route[path] = handleFuncList
+	}
+
+	return route
 }
 
 // 模块内部注册路由
@@ -71,11 +85,51 @@ func (m *module) registerRoute(route string, handleFunc ...RouteHandleFunc) erro
 
 	// 默认模块通过 network.go 中的 RegisterRoute() 函数对外开放注册路由
 	// 因此所有通过 RegisterRoute() 注册的路由，模块名都为 "default"
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if _, exist := m.route[route]; exist {
 		return ErrRouteExist
 	}
 
+	// 已注册到服务时热添加
+	if m.service != nil {
+		if err := m.service.AddRoute(DefaultModuleName, route, handleFunc...); err != nil {
+			return err
+		}
+	}
+
 	m.route[route] = handleFunc
 
 	return nil
 }
+
+// 模块内部移除路由
+func (m *module) removeRoute(route string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.route, route)
+}
+
+// 注册到服务，之后通过 registerRoute() 注册的路由会热添加到该服务
+func (m *module) registerTo(service Service) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// 以副本注册，防止 Service.RegisterModule() 调用 Route() 时重复加锁
+	snapshot := &module{
+		route: make(map[string][]RouteHandleFunc, len(m.route)),
+		mutex: sync.Mutex{},
+	}
+	for path, handleFuncList := range m.route {
+		snapshot.route[path] = handleFuncList
+	}
+
+	if err := service.RegisterModule(snapshot); err != nil {
+		return err
+	}
+
+	m.service = service
+	return nil
+}
@@ -0,0 +1,173 @@
+// 挂载入口不持有监听及 server ，而是挂载在使用者已有的 HTTP 路由或 gRPC server 上，连接同样经由 Service 管理
+// WebSocket 挂载入口本身是 http.Handler ，由使用者注册到自己的路由上，路径由路由决定，WebSocketOption.Path 不生效
+// gRPC 挂载入口在新建时即把 Communicate 服务注册到使用者的 *grpc.Server 上，因此必须在该 server 的 Serve() 前新建
+// 两者的 Running() 阻塞到 Destroy() 为止，Destroy() 不会关闭使用者的 server ，Running() 前收到的连接会被拒绝
+// TLS 由使用者的 server 负责，连接的 TLS 状态依旧可以通过 Item.PeerCertificate() 取得
+package network
+
+import (
+	"google.golang.org/grpc"
+	gRPC "jarvis/base/network/grpc"
+	"net/http"
+	"sync"
+)
+
+type (
+	// 可以挂载到 HTTP 路由上的入口定义
+	HandlerGate interface {
+		Gate
+		http.Handler
+	}
+
+	// websocket 挂载入口实现
+	webSocketHandlerGate struct {
+		webSocketGate
+		mountDone
+	}
+
+	// gRPC 挂载入口实现
+	gRPCServerGate struct {
+		gRPCGate
+		mountDone
+	}
+
+	// 挂载入口的运行结束通知
+	mountDone struct {
+		done chan struct{} // Destroy() 时关闭
+		once sync.Once     // 保证只关闭一次
+	}
+)
+
+const (
+	// WebSocket 挂载入口名称
+	WebSocketHandlerGateName = "WebSocket Handler Gate"
+	// gRPC 挂载入口名称
+	GRPCServerGateName = "GRPC Server Gate"
+)
+
+// 实例化 WebSocket 挂载入口，可选的 WebSocketOption 只取第一个
+func NewWebSocketHandlerGate(options ...WebSocketOption) HandlerGate {
+	return &webSocketHandlerGate{
+		webSocketGate: webSocketGate{
+			option:  webSocketOption(options),
+			mounted: true,
+		},
+		mountDone: newMountDone(),
+	}
+}
+
+// 实例化 gRPC 挂载入口，立即将 Communicate 服务注册到 server 上
+func NewGRPCServerGate(server *grpc.Server) Gate {
+	gate := &gRPCServerGate{
+		gRPCGate: gRPCGate{
+			server: server,
+		},
+		mountDone: newMountDone(),
+	}
+	if server != nil {
+		gRPC.RegisterCommunicateServer(server, gate)
+	}
+
+	return gate
+}
+
+// 新建运行结束通知
+func newMountDone() mountDone {
+	return mountDone{
+		done: make(chan struct{}),
+		once: sync.Once{},
+	}
+}
+
+// 阻塞到 Destroy() 为止
+func (md *mountDone) wait() {
+	<-md.done
+}
+
+// 结束运行，重复调用无效
+func (md *mountDone) finish() {
+	md.once.Do(func() {
+		close(md.done)
+	})
+}
+
+// ----------------------------------------------- WebSocketHandlerGate ------------------------------------------------
+// 入口名称
+func (whg *webSocketHandlerGate) Name() string {
+	return WebSocketHandlerGateName
+}
+
+// 初始化，只实例化升级器
+func (whg *webSocketHandlerGate) Initialize() error {
+	whg.upgrader = whg.newUpgrader()
+
+	return nil
+}
+
+// 运行，持有钩子函数后阻塞到 Destroy() 为止
+func (whg *webSocketHandlerGate) Running(function func(Conn)) error {
+	if whg.upgrader == nil {
+		return ErrNilUpgrader
+	}
+	if function == nil {
+		return ErrNilHookFunc
+	}
+
+	whg.hook(function)
+	whg.wait()
+	whg.hook(nil)
+
+	return nil
+}
+
+// 销毁，此后不再接收新连接，已有连接由 Service 管理
+func (whg *webSocketHandlerGate) Destroy() error {
+	whg.finish()
+
+	return nil
+}
+
+// ----------------------------------------------- GRPCServerGate ------------------------------------------------------
+// 入口名称
+func (gsg *gRPCServerGate) Name() string {
+	return GRPCServerGateName
+}
+
+// 初始化
+func (gsg *gRPCServerGate) Initialize() error {
+	if gsg.server == nil {
+		return ErrNilServer
+	}
+
+	return nil
+}
+
+// 运行，持有钩子函数后阻塞到 Destroy() 为止
+func (gsg *gRPCServerGate) Running(function func(Conn)) error {
+	if gsg.server == nil {
+		return ErrNilServer
+	}
+	if function == nil {
+		return ErrNilHookFunc
+	}
+
+	gsg.hook(function)
+	gsg.wait()
+	gsg.hook(nil)
+
+	return nil
+}
+
+// 停止接收新连接，已有的流保持可用，不停止使用者的 server
+func (gsg *gRPCServerGate) StopAccept() error {
+	gsg.finish()
+
+	return nil
+}
+
+// 销毁，此后不再接收新连接，不停止使用者的 server
+func (gsg *gRPCServerGate) Destroy() error {
+	gsg.finish()
+
+	return nil
+}
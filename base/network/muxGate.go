@@ -0,0 +1,468 @@
+// MuxGate 在同一个端口上同时提供 socket 、 WebSocket 及 gRPC 三种入口，按连接的起始字节识别协议后交给对应入口的逻辑
+// DefaultHeadSymbol 或 FrameMagic 开头为 socket ，HTTP/2 连接前言为 gRPC ，其余连接直接关闭
+// HTTP GET 请求需要读取完整的请求头，带有 WebSocket 升级请求头时为 WebSocket ，否则（例如健康检查、浏览器访问）回复 400 后关闭
+// 识别需要在 SniffTimeout 内收到足够的起始字节，只读取不消费，识别后的连接从头开始交给对应入口
+// 使用 TLS 时由 MuxGate 统一完成握手后识别解密后的数据，ALPN 同时声明 h2 与 http/1.1 ，各连接的 TLS 状态依旧可以通过 Item.PeerCertificate() 取得
+// 所有连接的 Item.Gate() 均为 MuxGateName
+// MuxGate 实现了 GracefulGate ，Service 关闭时先停止接收新连接，Item 关闭后再优雅停止内部的 gRPC server ，处理中的流可以送达回覆及告别消息
+package network
+
+import (
+	"bufio"
+	"bytes"
+	oContext "context"
+	"crypto/tls"
+	"errors"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"jarvis/base/log"
+	gRPC "jarvis/base/network/grpc"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// 多路复用入口选项，零值字段使用默认值
+	MuxOption struct {
+		WebSocket    WebSocketOption // WebSocket 连接使用的选项
+		SniffTimeout time.Duration   // TLS 握手及识别协议的超时时间，小于等于零时为 DefaultSniffTimeout
+	}
+
+	// 多路复用入口实现
+	muxGate struct {
+		baseGate
+		option       MuxOption
+		listener     net.Listener  // 监听者
+		webSocket    webSocketGate // WebSocket 连接的处理逻辑
+		gRPC         gRPCGate      // gRPC 连接的处理逻辑
+		wsListener   *muxListener  // 交给 WebSocket server 的连接
+		gRPCListener *muxListener  // 交给 gRPC server 的连接
+	}
+
+	// 识别后的协议
+	muxProtocol int
+
+	// 已读取起始字节的连接，读取时先返回已读取的字节
+	muxConn struct {
+		net.Conn
+		reader *bufio.Reader
+	}
+
+	// 以 channel 接收连接的监听者，交由 http.Server 及 grpc.Server 的 Serve() 使用
+	muxListener struct {
+		addr  net.Addr
+		conns chan net.Conn
+		done  chan struct{} // 关闭时关闭
+		once  sync.Once     // 保证 done 只关闭一次
+	}
+
+	// gRPC 连接已经由 MuxGate 完成 TLS 握手，只向 gRPC 提供 TLS 认证信息
+	muxCredentials struct{}
+)
+
+const (
+	// 未知协议
+	muxProtocolUnknown muxProtocol = iota
+	// socket
+	muxProtocolSocket
+	// WebSocket
+	muxProtocolWebSocket
+	// gRPC
+	muxProtocolGRPC
+)
+
+const (
+	// Mux gate 名称
+	MuxGateName = "Mux Gate"
+	// 默认 TLS 握手及识别协议的超时时间
+	DefaultSniffTimeout = time.Second * time.Duration(10)
+	// HTTP/2 连接前言
+	HTTP2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	// 识别 WebSocket 升级时请求头的最大长度
+	MaxSniffHeaderSize = 8 << 10
+)
+
+// 此常量组定义了多路复用入口中可能会发生的错误文本
+const (
+	ErrUnknownProtocolText     = "unknown protocol"
+	ErrMuxListenerClosedText   = "mux listener is closed"
+	ErrMuxClientHandshakeText  = "mux credentials can not be used by client"
+	ErrNotWebSocketUpgradeText = "http request is not a websocket upgrade"
+)
+
+var (
+	// 无法识别协议 错误
+	ErrUnknownProtocol = errors.New(ErrUnknownProtocolText)
+	// 多路复用监听者已关闭 错误
+	ErrMuxListenerClosed = errors.New(ErrMuxListenerClosedText)
+	// 多路复用认证信息用于客户端 错误
+	ErrMuxClientHandshake = errors.New(ErrMuxClientHandshakeText)
+	// HTTP 请求不是 WebSocket 升级 错误
+	ErrNotWebSocketUpgrade = errors.New(ErrNotWebSocketUpgradeText)
+)
+
+// 起始字节与协议的对应关系
+var muxPrefixes = []struct {
+	prefix   string
+	protocol muxProtocol
+}{
+	{DefaultHeadSymbol, muxProtocolSocket},
+	{FrameMagic, muxProtocolSocket},
+	{http.MethodGet + " ", muxProtocolWebSocket},
+	{HTTP2Preface, muxProtocolGRPC},
+}
+
+// 实例化 muxGate 的 Gate 实现，可选的 MuxOption 只取第一个
+func NewMuxGate(addr string, options ...MuxOption) Gate {
+	return newMuxGate(addr, nil, options)
+}
+
+// 实例化使用 TLS 的 muxGate
+func NewMuxGateTLS(addr string, option TLSOption, options ...MuxOption) Gate {
+	return newMuxGate(addr, &option, options)
+}
+
+// 实例化 muxGate ，填充默认值
+func newMuxGate(addr string, tlsOption *TLSOption, options []MuxOption) *muxGate {
+	option := MuxOption{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.SniffTimeout <= 0 {
+		option.SniffTimeout = DefaultSniffTimeout
+	}
+
+	return &muxGate{
+		baseGate: baseGate{address: addr, tlsOption: tlsOption},
+		option:   option,
+		webSocket: webSocketGate{
+			option: webSocketOption([]WebSocketOption{option.WebSocket}),
+		},
+	}
+}
+
+// --------------------------------------------------- MuxGate ---------------------------------------------------------
+// 入口名称
+func (mg *muxGate) Name() string {
+	return MuxGateName
+}
+
+// 初始化
+func (mg *muxGate) Initialize() error {
+	if mg.address == "" {
+		return ErrEmptyAddress
+	}
+	if err := mg.initTLS(); err != nil {
+		return err
+	}
+
+	options := make([]grpc.ServerOption, 0)
+	if mg.tlsConfig != nil {
+		// WebSocket 使用 http/1.1 ，gRPC 使用 h2
+		for _, proto := range []string{"h2", "http/1.1"} {
+			if !containsString(mg.tlsConfig.NextProtos, proto) {
+				mg.tlsConfig.NextProtos = append(mg.tlsConfig.NextProtos, proto)
+			}
+		}
+		options = append(options, grpc.Creds(muxCredentials{}))
+	}
+
+	l, err := net.Listen(DefaultNetwork, mg.address)
+	if err != nil {
+		return err
+	}
+
+	mg.listener = l
+	mg.wsListener = newMuxListener(l.Addr())
+	mg.gRPCListener = newMuxListener(l.Addr())
+	mg.webSocket.server = &http.Server{Handler: &mg.webSocket}
+	mg.webSocket.upgrader = mg.webSocket.newUpgrader()
+	mg.gRPC.server = grpc.NewServer(options...)
+	mg.gRPC.listener = mg.gRPCListener
+
+	return nil
+}
+
+// 运行
+func (mg *muxGate) Running(function func(Conn)) error {
+	if mg.listener == nil {
+		return ErrNilListener
+	}
+	if function == nil {
+		return ErrNilHookFunc
+	}
+
+	// 持有局部监听者，Destroy() 会将 mg.listener 置为 nil
+	listener := mg.listener
+
+	// 持有钩子函数，socket 连接由自身交给 Service ，其余由对应入口交给 Service
+	mg.hook(function)
+	mg.webSocket.hook(function)
+	mg.gRPC.hook(function)
+
+	// 注册 server ，指定处理器为 gRPC 入口
+	gRPC.RegisterCommunicateServer(mg.gRPC.server, &mg.gRPC)
+
+	go func() {
+		if err := mg.webSocket.server.Serve(mg.wsListener); err != nil && err != http.ErrServerClosed && err != ErrMuxListenerClosed {
+			log.ErrorF("mux Gate websocket server error : %s", err.Error())
+		}
+	}()
+	go func() {
+		if err := mg.gRPC.server.Serve(mg.gRPCListener); err != nil && err != ErrMuxListenerClosed {
+			log.ErrorF("mux Gate gRPC server error : %s", err.Error())
+		}
+	}()
+
+	var e error
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			e = err // 捕捉接收连接错误，反馈到 Service 中
+			break
+		}
+
+		// 握手及识别在独立的协程中完成，防止慢速连接阻塞接收
+		go mg.serve(c)
+	}
+	return e
+}
+
+// 只停止接收新连接，已识别的 WebSocket 及 gRPC 连接保持可用
+func (mg *muxGate) StopAccept() error {
+	if mg.listener == nil {
+		return ErrNilListener
+	}
+
+	// 停止内部 server 接收连接，识别中的连接投递时随之关闭
+	mg.wsListener.close()
+	mg.gRPCListener.close()
+
+	return closeListener(mg.listener)
+}
+
+// 销毁，优雅停止内部的 gRPC server ，等待已有的流结束
+func (mg *muxGate) Destroy() error {
+	if mg.listener == nil {
+		return ErrNilListener
+	}
+
+	// 停止监听并且置为 nil ，StopAccept() 可能已经关闭了监听
+	if err := mg.StopAccept(); err != nil {
+		return err
+	}
+	mg.listener = nil
+
+	// 停止内部 server ，WebSocket 连接已被升级接管，不受 server 关闭影响
+	gracefulStop(mg.gRPC.server)
+	return mg.webSocket.server.Close()
+}
+
+// 在 SniffTimeout 内完成 TLS 握手及协议识别，然后交给对应入口
+func (mg *muxGate) serve(c net.Conn) {
+	if err := c.SetDeadline(time.Now().Add(mg.option.SniffTimeout)); err != nil {
+		log.ErrorF("mux Gate set sniff deadline error : %s", err.Error())
+	}
+
+	if mg.tlsConfig != nil {
+		tc := tls.Server(c, mg.tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			log.ErrorF("mux Gate tls handshake with [%s] error : %s", c.RemoteAddr().String(), err.Error())
+			_ = c.Close()
+			return
+		}
+		c = tc
+	}
+
+	conn := &muxConn{Conn: c, reader: bufio.NewReaderSize(c, MaxSniffHeaderSize)}
+	protocol, err := conn.sniff()
+	if err != nil {
+		log.ErrorF("mux Gate sniff protocol from [%s] error : %s", c.RemoteAddr().String(), err.Error())
+		_ = c.Close()
+		return
+	}
+
+	// 普通的 HTTP GET 请求不交给 WebSocket ，回复 400 后关闭
+	if protocol == muxProtocolWebSocket {
+		if err := conn.sniffUpgrade(); err != nil {
+			log.DebugF("mux Gate reject http request from [%s] : %s", c.RemoteAddr().String(), err.Error())
+			_, _ = c.Write([]byte("HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 0\r\n\r\n"))
+			_ = c.Close()
+			return
+		}
+	}
+
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		log.ErrorF("mux Gate clear sniff deadline error : %s", err.Error())
+	}
+
+	switch protocol {
+	case muxProtocolSocket:
+		function := mg.hookFunc()
+		if function == nil {
+			_ = c.Close()
+			return
+		}
+		function(NewSocketConn(conn))
+	case muxProtocolWebSocket:
+		mg.wsListener.deliver(conn)
+	case muxProtocolGRPC:
+		mg.gRPCListener.deliver(conn)
+	}
+}
+
+// 字符串切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// --------------------------------------------------- muxConn ---------------------------------------------------------
+// 逐字节读取起始字节，直到匹配某一协议或不可能匹配任何协议
+func (mc *muxConn) sniff() (muxProtocol, error) {
+	for n := 1; ; n++ {
+		head, err := mc.reader.Peek(n)
+		if err != nil {
+			return muxProtocolUnknown, err
+		}
+
+		possible := false
+		for _, p := range muxPrefixes {
+			if len(head) >= len(p.prefix) {
+				if string(head[:len(p.prefix)]) == p.prefix {
+					return p.protocol, nil
+				}
+				continue
+			}
+			if strings.HasPrefix(p.prefix, string(head)) {
+				possible = true
+			}
+		}
+		if !possible {
+			return muxProtocolUnknown, ErrUnknownProtocol
+		}
+	}
+}
+
+// 读取完整的 HTTP 请求头，确认是 WebSocket 升级请求，只读取不消费
+func (mc *muxConn) sniffUpgrade() error {
+	for n := len(http.MethodGet) + 1; ; n++ {
+		head, err := mc.reader.Peek(n)
+		if err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+			continue
+		}
+
+		request, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+		if err != nil {
+			return err
+		}
+		if request.Method != http.MethodGet || !websocket.IsWebSocketUpgrade(request) {
+			return ErrNotWebSocketUpgrade
+		}
+		return nil
+	}
+}
+
+// 读取，先返回识别时已读取的字节
+func (mc *muxConn) Read(b []byte) (int, error) {
+	return mc.reader.Read(b)
+}
+
+// TLS 连接状态，非 TLS 连接返回 nil
+func (mc *muxConn) TLSState() *tls.ConnectionState {
+	return connTLSState(mc.Conn)
+}
+
+// --------------------------------------------------- muxListener -----------------------------------------------------
+// 新建以 channel 接收连接的监听者
+func newMuxListener(addr net.Addr) *muxListener {
+	return &muxListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		once:  sync.Once{},
+	}
+}
+
+// 投递连接，监听者已关闭时关闭连接
+func (ml *muxListener) deliver(c net.Conn) {
+	select {
+	case ml.conns <- c:
+	case <-ml.done:
+		_ = c.Close()
+	}
+}
+
+// 接收连接
+func (ml *muxListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-ml.conns:
+		return c, nil
+	case <-ml.done:
+		return nil, ErrMuxListenerClosed
+	}
+}
+
+// 关闭
+func (ml *muxListener) Close() error {
+	ml.close()
+	return nil
+}
+
+// 关闭，重复调用无效
+func (ml *muxListener) close() {
+	ml.once.Do(func() {
+		close(ml.done)
+	})
+}
+
+// 监听地址
+func (ml *muxListener) Addr() net.Addr {
+	return ml.addr
+}
+
+// --------------------------------------------------- muxCredentials --------------------------------------------------
+// 客户端握手，不支持
+func (muxCredentials) ClientHandshake(oContext.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, ErrMuxClientHandshake
+}
+
+// 服务端握手，TLS 握手已经完成，只取得 TLS 认证信息
+func (muxCredentials) ServerHandshake(c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	sc, ok := c.(SecureConn)
+	if !ok || sc.TLSState() == nil {
+		return c, nil, nil
+	}
+
+	return c, credentials.TLSInfo{
+		State:          *sc.TLSState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+// 协议信息
+func (muxCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls"}
+}
+
+// 复制
+func (mc muxCredentials) Clone() credentials.TransportCredentials {
+	return mc
+}
+
+// 覆盖服务端名称，服务端不使用
+func (muxCredentials) OverrideServerName(string) error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package network
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMuxGate(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewMuxGate(addr))
+	defer s.Shutdown(nil)
+
+	// 同一端口上的三种客户端
+	clients := map[string]Client{
+		"socket":    NewSocketClient(addr, DefaultPackager(), DefaultEncrypter()),
+		"websocket": NewWebSocketClient("ws://"+addr+DefaultWebSocketPath, DefaultPackager(), DefaultEncrypter()),
+		"grpc":      NewGRPCClient(addr, DefaultPackager(), DefaultEncrypter()),
+	}
+	for name, c := range clients {
+		if err := c.Initialize(); err != nil {
+			t.Fatalf("[%s] initialize : %v", name, err)
+		}
+		defer c.Close()
+
+		if reply := requestReply(t, c, "test", "echo", []byte(name)); reply.Code != ReplySuccessCode || string(reply.Data) != name {
+			t.Fatalf("[%s] echo = %+v", name, reply)
+		}
+	}
+	if items := s.Items(); len(items) != len(clients) || items[0].Gate() != MuxGateName {
+		t.Fatalf("items = %d , want %d mux items", len(items), len(clients))
+	}
+}
+
+func TestMuxGatePlainGet(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	runService(t, s, NewMuxGate(addr))
+	defer s.Shutdown(nil)
+
+	// 不带升级请求头的 GET 请求（例如健康检查）回复 400 ，不交给 WebSocket
+	for _, path := range []string{DefaultWebSocketPath, "/health"} {
+		response, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest || !response.Close {
+			t.Fatalf("plain get %s = %d , close %v , want %d and close", path, response.StatusCode, response.Close, http.StatusBadRequest)
+		}
+	}
+	if items := s.Items(); len(items) != 0 {
+		t.Fatalf("items = %d , want 0", len(items))
+	}
+}
@@ -1,8 +1,10 @@
 package network
 
 import (
+	oContext "context"
 	"jarvis/util/encrypt"
 	"jarvis/util/rand"
+	"time"
 )
 
 type (
@@ -36,7 +38,7 @@ func (id ID) String() string {
 }
 
 // 向默认模块注册路由
-// warning : 多线程注册默认模块路由可能引发竞态问题，默认模块注册路由未加锁，且此函数必须在 RegisterModule() 函数前调用
+// 默认模块已经通过 RegisterModule() 注册后，新注册的路由会热添加到默认服务
 func RegisterRoute(route string, handleFunc ...RouteHandleFunc) error {
 	return defaultModule.registerRoute(route, handleFunc...)
 }
@@ -61,10 +63,172 @@ func RegisterModule(modules ...Module) error {
 	}
 
 	// 否则直接注册默认模块
-	return defaultService.RegisterModule(defaultModule)
+	return defaultModule.registerTo(defaultService)
+}
+
+// 注销模块，已经在执行的调用链不受影响
+func UnregisterModule(name string) error {
+	return defaultService.UnregisterModule(name)
+}
+
+// 替换模块，模块不存在时直接注册，已经在执行的调用链在原调用链上执行结束
+func ReplaceModule(module Module) error {
+	return defaultService.ReplaceModule(module)
+}
+
+// 向模块添加单个路由，模块不存在时新建模块
+func AddRoute(module, route string, handleFunc ...RouteHandleFunc) error {
+	return defaultService.AddRoute(module, route, handleFunc...)
+}
+
+// 设置服务的未找到处理，模块或路由不存在时执行，默认为 NotFoundHandler
+func SetNotFoundHandler(handleFunc ...RouteHandleFunc) error {
+	return defaultService.SetNotFoundHandler(handleFunc...)
+}
+
+// 设置模块的未找到处理，优先于服务的未找到处理
+func SetModuleNotFoundHandler(module string, handleFunc ...RouteHandleFunc) error {
+	return defaultService.SetModuleNotFoundHandler(module, handleFunc...)
+}
+
+// 从模块移除单个路由
+func RemoveRoute(module, route string) error {
+	if err := defaultService.RemoveRoute(module, route); err != nil {
+		return err
+	}
+
+	// 默认模块同时移除，使之后可以重新注册同名路由
+	if module == DefaultModuleName {
+		defaultModule.removeRoute(route)
+	}
+
+	return nil
+}
+
+// 设置分发器
+// 此函数必须在 Run() 前调用
+func SetDispatcher(dispatcher Dispatcher) error {
+	return defaultService.SetDispatcher(dispatcher)
+}
+
+// 分发器统计
+func DispatcherStats() DispatchStats {
+	return defaultService.DispatcherStats()
+}
+
+// 设置服务分发模式
+func SetDispatchMode(mode DispatchMode) error {
+	return defaultService.SetDispatchMode(mode)
+}
+
+// 设置模块分发模式
+func SetModuleDispatchMode(module string, mode DispatchMode) error {
+	return defaultService.SetModuleDispatchMode(module, mode)
+}
+
+// 设置认证者
+// 此函数必须在 Run() 前调用
+func SetAuthenticator(authenticator Authenticator, option AuthOption) error {
+	return defaultService.SetAuthenticator(authenticator, option)
+}
+
+// 设置心跳
+// 此函数必须在 Run() 前调用
+func SetHeartbeat(heartbeat Heartbeat) error {
+	return defaultService.SetHeartbeat(heartbeat)
+}
+
+// 设置装包者
+// 此函数必须在 Run() 前调用
+func SetPackager(packager Packager) error {
+	return defaultService.SetPackager(packager)
+}
+
+// 设置加密器工厂
+// 此函数必须在 Run() 前调用
+func SetEncrypter(factory EncrypterFactory) error {
+	return defaultService.SetEncrypter(factory)
+}
+
+// 设置客户端可以协商的编解码器
+// 此函数必须在 Run() 前调用
+func SetCodecs(codecs ...Codec) error {
+	return defaultService.SetCodecs(codecs...)
+}
+
+// 设置客户端可以协商的压缩器及压缩阈值
+// 此函数必须在 Run() 前调用
+func SetCompression(threshold int, compressors ...Compressor) error {
+	return defaultService.SetCompression(threshold, compressors...)
+}
+
+// 设置模块超时
+func SetModuleTimeout(module string, timeout time.Duration) error {
+	return defaultService.SetModuleTimeout(module, timeout)
+}
+
+// 设置路由超时
+func SetRouteTimeout(module, route string, timeout time.Duration) error {
+	return defaultService.SetRouteTimeout(module, route, timeout)
 }
 
 // 运行
 func Run(gates ...Gate) error {
 	return defaultService.Run(gates...)
 }
+
+// 设置用户绑定策略
+func SetBindPolicy(policy BindPolicy) error {
+	return defaultService.SetBindPolicy(policy)
+}
+
+// 寻找用户绑定的所有本地连接
+func FindByUser(userKey string) []Item {
+	return defaultService.FindByUser(userKey)
+}
+
+// 设置集群
+// 此函数必须在 Run() 前调用
+func SetCluster(cluster Cluster) error {
+	return defaultService.SetCluster(cluster)
+}
+
+// 投递到指定 id 的连接，包括其他节点
+func SendTo(id string, message Message) error {
+	return defaultService.SendTo(id, message)
+}
+
+// 投递到用户绑定的所有连接，包括其他节点
+func SendToUser(userKey string, message Message) error {
+	return defaultService.SendToUser(userKey, message)
+}
+
+// 踢掉指定 id 的连接，包括其他节点
+func Kick(id string) error {
+	return defaultService.Kick(id)
+}
+
+// 所有本地连接
+func Items() []Item {
+	return defaultService.Items()
+}
+
+// 所有已注册的模块及路由名
+func Routes() map[string][]string {
+	return defaultService.Routes()
+}
+
+// 向组内所有成员广播，包括其他节点
+func Broadcast(group string, message Message) error {
+	return defaultService.Broadcast(group, message)
+}
+
+// 向所有连接广播，包括其他节点
+func BroadcastAll(message Message) error {
+	return defaultService.BroadcastAll(message)
+}
+
+// 优雅关闭，goodbye 为可选的告别消息，关闭前发送至所有被管理的端
+func Shutdown(ctx oContext.Context, goodbye ...Message) error {
+	return defaultService.Shutdown(ctx, goodbye...)
+}
@@ -12,6 +12,12 @@ type (
 		// 观察者主动发送至端 ， 此函数会被放置于一个独立的线程执行，因此必须阻塞，否则只调用一次
 		InitiativeSend(Context)
 	}
+
+	// 关闭观察者定义，Observer 可选实现此接口，在 Service 优雅关闭完成后得到通知
+	ShutdownObserver interface {
+		// 观察服务关闭
+		ObserveShutdown()
+	}
 )
 
 const ()
@@ -21,6 +21,9 @@ type (
 	packager struct {
 		buffer []byte // 缓存
 	}
+
+	// 直通装包者实现，每次读取即为一个完整的数据，供 PlainConn 使用
+	plainPackager struct{}
 )
 
 // 此常量组定义了 Packager 定义及实现中可能会发生的错误文本
@@ -59,10 +62,14 @@ func (p *packager) Unpack(data []byte) [][]byte {
 
 	//	遍历缓存，不得短于可取出头部的长度
 	i := 0
+	expect := 0 // 下一个数据帧应当开始的位置，数据帧之前存在无法识别的数据时记为装包者错误
 	for ; i < length-DefaultHeaderLen; i++ {
 		if string(p.buffer[i:i+DefaultHeadSymbolLen]) != DefaultHeadSymbol { // 非头部
 			continue
 		}
+		if i != expect {
+			metricPackagerErrors.Inc()
+		}
 		dataLength := transform.BytesToInt(p.buffer[i+DefaultHeadSymbolLen : i+DefaultHeaderLen]) // 取得数据长度
 		if i+DefaultHeaderLen+dataLength > length {                                               // 如果缓存长度不足以获取完整数据，退出
 			break
@@ -70,6 +77,7 @@ func (p *packager) Unpack(data []byte) [][]byte {
 
 		comDatas = append(comDatas, p.buffer[i:i+DefaultHeaderLen+dataLength]) // 取出数据
 		i = i + DefaultHeaderLen + dataLength - 1                              // -1 是为了防止后续的 i++ 导致偏移量错误
+		expect = i + 1
 	}
 
 	if len(comDatas) != 0 && i != 0 {
@@ -86,3 +94,36 @@ func (p *packager) Unpack(data []byte) [][]byte {
 
 	return comDatas
 }
+
+// 装包者的标识，标识相同的装包者对同一数据打包出相同的数据帧，不是内置实现时无法判断，返回空字符串
+func packagerIdentity(p Packager) string {
+	switch fp := p.(type) {
+	case *packager:
+		return "default"
+	case plainPackager:
+		return "plain"
+	case *framePackager:
+		if fp.option.Checksum {
+			return "frame+crc"
+		}
+		return "frame"
+	default:
+		return ""
+	}
+}
+
+// -------------------------------------------------- plainPackager ----------------------------------------------------
+// 克隆
+func (plainPackager) Clone() Packager {
+	return plainPackager{}
+}
+
+// 打包，原样返回
+func (plainPackager) Pack(data []byte) []byte {
+	return data
+}
+
+// 解包，原样返回
+func (plainPackager) Unpack(data []byte) [][]byte {
+	return [][]byte{data}
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackagerUnpack(t *testing.T) {
+	p := DefaultPackager()
+	datas := [][]byte{[]byte("jarvis"), binaryPayload(), []byte("#*Head")}
+	stream := make([]byte, 0)
+	for _, data := range datas {
+		stream = append(stream, p.Pack(data)...)
+	}
+
+	// 逐字节写入，数据帧被任意切分时依旧按序解出
+	unpacked := make([][]byte, 0)
+	for _, b := range stream {
+		unpacked = append(unpacked, p.Unpack([]byte{b})...)
+	}
+	if len(unpacked) != len(datas) {
+		t.Fatalf("unpacked = %d , want %d", len(unpacked), len(datas))
+	}
+	for i := range datas {
+		if !bytes.Equal(unpacked[i], datas[i]) {
+			t.Fatalf("frame %d mismatch", i)
+		}
+	}
+}
+
+func TestPackagerSkipsGarbage(t *testing.T) {
+	p := DefaultPackager()
+	stream := append([]byte("garbage"), p.Pack([]byte("jarvis"))...)
+	if datas := p.Unpack(stream); len(datas) != 1 || string(datas[0]) != "jarvis" {
+		t.Fatalf("unpacked = %q , want [jarvis]", datas)
+	}
+}
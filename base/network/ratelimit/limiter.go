@@ -0,0 +1,113 @@
+// ratelimit 提供基于令牌桶的限流，以及可以注册到 Service.UseMiddleware() 或具体路由处理函数列表中的限流中间件
+// 每个键拥有独立的令牌桶，令牌以 Rate 个每秒的速度补充，最多积攒 Burst 个，每个请求消耗一个令牌
+// 长时间未使用、已经补满的令牌桶与新建的令牌桶等价，会在定期清理时移除，因此键的数量不会无限增长
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// 限流器定义
+	Limiter interface {
+		// 键 key 是否允许通过，允许时消耗一个令牌
+		Allow(key string) bool
+
+		// 移除键 key 的令牌桶
+		Forget(key string)
+	}
+
+	// 令牌桶限流器实现
+	tokenBucket struct {
+		rate      float64            // 每秒补充的令牌数
+		burst     float64            // 令牌桶容量
+		buckets   map[string]*bucket // 令牌桶，map[键]令牌桶
+		lastSweep time.Time          // 上一次清理时间
+		mutex     sync.Mutex         // 令牌桶竞态锁
+	}
+
+	// 令牌桶
+	bucket struct {
+		tokens float64   // 剩余令牌数
+		last   time.Time // 上一次补充时间
+	}
+)
+
+const (
+	// 清理已补满令牌桶的间隔
+	SweepInterval = time.Minute
+)
+
+// 新建令牌桶限流器
+// rate : 每秒补充的令牌数，小于等于零时不补充
+// burst : 令牌桶容量，即允许的瞬时请求数，小于 1 时为 1
+func NewLimiter(rate float64, burst int) Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		mutex:     sync.Mutex{},
+	}
+}
+
+// 键 key 是否允许通过
+func (tb *tokenBucket) Allow(key string) bool {
+	now := time.Now()
+
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tb.sweep(now)
+
+	b, exist := tb.buckets[key]
+	if !exist {
+		b = &bucket{
+			tokens: tb.burst,
+			last:   now,
+		}
+		tb.buckets[key] = b
+	}
+
+	// 补充令牌
+	b.tokens += now.Sub(b.last).Seconds() * tb.rate
+	if b.tokens > tb.burst {
+		b.tokens = tb.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// 移除键 key 的令牌桶
+func (tb *tokenBucket) Forget(key string) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	delete(tb.buckets, key)
+}
+
+// 清理已经补满的令牌桶
+// 调用方必须持有 tb.mutex
+func (tb *tokenBucket) sweep(now time.Time) {
+	if now.Sub(tb.lastSweep) < SweepInterval || tb.rate <= 0 {
+		return
+	}
+	tb.lastSweep = now
+
+	for key, b := range tb.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*tb.rate >= tb.burst {
+			delete(tb.buckets, key)
+		}
+	}
+}
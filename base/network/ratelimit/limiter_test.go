@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(0, 2)
+	for i, want := range []bool{true, true, false} {
+		if got := l.Allow("a"); got != want {
+			t.Fatalf("allow %d = %v , want %v", i, got, want)
+		}
+	}
+	if !l.Allow("b") {
+		t.Fatal("keys must not share a bucket")
+	}
+
+	l.Forget("a")
+	if !l.Allow("a") {
+		t.Fatal("forgotten key must get a full bucket")
+	}
+
+	l = NewLimiter(100, 1)
+	if !l.Allow("a") || l.Allow("a") {
+		t.Fatal("burst 1 must allow exactly one request")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !l.Allow("a") {
+		t.Fatal("bucket must refill over time")
+	}
+}
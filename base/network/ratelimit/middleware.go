@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"jarvis/base/log"
+	"jarvis/base/metrics"
+	"jarvis/base/network"
+	"sync"
+	"time"
+)
+
+type (
+	// 限流键函数，从上下文中取出限流键
+	KeyFunc func(network.Context) string
+
+	// 限流中间件选项
+	Option struct {
+		Rate       float64 // 每秒补充的令牌数
+		Burst      int     // 令牌桶容量
+		Key        KeyFunc // 限流键函数，为 nil 时为 ByConnection
+		Disconnect int     // 同一连接连续超限达到此次数时断开连接，小于等于零时只回复不断开
+	}
+
+	// 连接的连续超限记录
+	violations struct {
+		records   map[string]*violation // 超限记录，map[端 id]超限记录
+		lastSweep time.Time             // 上一次清理时间
+		mutex     sync.Mutex            // 超限记录竞态锁
+	}
+
+	// 超限记录
+	violation struct {
+		count int       // 连续超限次数
+		last  time.Time // 最后一次超限时间
+	}
+)
+
+const (
+	// 模块或路由不存在的请求在指标中使用的标签值，防止客户端任意的模块名、路由名产生无限的指标序列
+	UnmatchedLabel = "_unmatched"
+)
+
+var (
+	// 限流拒绝的请求数，以匹配到的路由为标签
+	metricRejected = metrics.NewCounter("jarvis_network_ratelimit_rejected_total", "Requests rejected by rate limit.", "module", "route")
+)
+
+// 以连接限流
+func ByConnection(ctx network.Context) string {
+	return ctx.Request().ID
+}
+
+// 以绑定的用户限流，未绑定用户时以连接限流
+func ByUser(ctx network.Context) string {
+	if userKey := ctx.UserKey(); userKey != "" {
+		return "user:" + userKey
+	}
+
+	return ctx.Request().ID
+}
+
+// 以模块和路由限流，所有连接共享同一个令牌桶
+func ByRoute(ctx network.Context) string {
+	request := ctx.Request()
+	return request.Module + "/" + request.Route
+}
+
+// 以连接、模块和路由限流，每个连接的每个路由拥有独立的令牌桶
+func ByConnectionRoute(ctx network.Context) string {
+	request := ctx.Request()
+	return request.ID + ":" + request.Module + "/" + request.Route
+}
+
+// 新建限流中间件，可以注册到 Service.UseMiddleware() 中对所有路由生效，
+// 也可以放在 Module.Route() 返回的具体路由处理函数列表之前，只对该路由生效
+// 超限时回复 ReplyTooManyRequests 并结束调用链，同一连接连续超限达到 Option.Disconnect 次时断开连接
+// 放行一次后连续超限次数清零，超限间隔超过 SweepInterval 的记录会被清理
+func Middleware(option Option) network.RouteHandleFunc {
+	limiter := NewLimiter(option.Rate, option.Burst)
+	key := option.Key
+	if key == nil {
+		key = ByConnection
+	}
+	v := &violations{
+		records:   make(map[string]*violation),
+		lastSweep: time.Now(),
+		mutex:     sync.Mutex{},
+	}
+
+	return func(ctx network.Context) {
+		request := ctx.Request()
+		if limiter.Allow(key(ctx)) {
+			v.reset(request.ID)
+			return
+		}
+
+		if route := ctx.Route(); route != "" {
+			metricRejected.Inc(request.Module, route)
+		} else {
+			metricRejected.Inc(UnmatchedLabel, UnmatchedLabel)
+		}
+		ctx.Done()
+
+		if option.Disconnect > 0 && v.add(request.ID) >= option.Disconnect {
+			v.reset(request.ID)
+			log.WarnF("[%s] rate limit exceeded %d times, disconnect", request.ID, option.Disconnect)
+			if err := ctx.Kick(request.ID); err != nil {
+				log.ErrorF("[%s] rate limit disconnect error : %s", request.ID, err.Error())
+			}
+			return
+		}
+
+		if err := ctx.Reply(network.ReplyTooManyRequests(nil)); err != nil {
+			log.ErrorF("[%s] rate limit reply error : %s", request.ID, err.Error())
+		}
+	}
+}
+
+// 增加一次连续超限，返回连续超限次数
+func (v *violations) add(id string) int {
+	now := time.Now()
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.sweep(now)
+
+	r, exist := v.records[id]
+	if !exist {
+		r = &violation{}
+		v.records[id] = r
+	}
+	r.count++
+	r.last = now
+
+	return r.count
+}
+
+// 清零连续超限次数
+func (v *violations) reset(id string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	delete(v.records, id)
+}
+
+// 清理超限间隔超过 SweepInterval 的记录
+// 调用方必须持有 v.mutex
+func (v *violations) sweep(now time.Time) {
+	if now.Sub(v.lastSweep) < SweepInterval {
+		return
+	}
+	v.lastSweep = now
+
+	for id, r := range v.records {
+		if now.Sub(r.last) >= SweepInterval {
+			delete(v.records, id)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"bytes"
+	"jarvis/base/metrics"
+	"jarvis/base/network"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareUnmatchedLabel(t *testing.T) {
+	handle := Middleware(Option{Rate: 0, Burst: 1, Key: func(network.Context) string { return "all" }})
+
+	// 客户端任意的路由名不产生新的指标序列
+	for i := 0; i < 10; i++ {
+		handle(network.NewContext(network.Message{ID: "id", Module: "m" + strconv.Itoa(i), Route: "r" + strconv.Itoa(i)}))
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := metrics.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	series := 0
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if strings.HasPrefix(line, "jarvis_network_ratelimit_rejected_total{") {
+			series++
+			if !strings.Contains(line, `module="`+UnmatchedLabel+`",route="`+UnmatchedLabel+`"} 9`) {
+				t.Fatalf("unexpected series : %s", line)
+			}
+		}
+	}
+	if series != 1 {
+		t.Fatalf("series = %d , want 1", series)
+	}
+}
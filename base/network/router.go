@@ -1,7 +1,12 @@
+// Router 以 模块名 -> 路由名 -> 调用链 的映射分发消息
+// 路由名以 PatternSuffix("*") 结尾时为模式路由，匹配所有以 "*" 之前部分为前缀的路由名，单独的 "*" 匹配模块内的所有路由
+// 精确路由优先于模式路由，多个模式路由同时匹配时前缀最长者优先，常用于代理等兜底处理
 package network
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -14,17 +19,43 @@ type (
 		// 注册模块及所属路由
 		RegisterRoute(string, map[string]CallLinkedList) error
 
+		// 注销模块及所属路由
+		UnregisterRoute(string) error
+
+		// 替换模块及所属路由，模块不存在时直接注册
+		ReplaceRoute(string, map[string]CallLinkedList) error
+
+		// 向模块添加单个路由，模块不存在时新建模块
+		AddRoute(string, string, CallLinkedList) error
+
+		// 从模块移除单个路由，模块的最后一个路由被移除时模块随之注销
+		RemoveRoute(string, string) error
+
 		// 通过模块名和路径名映射寻找处理函数
 		RouteHandleFun(string, string) (CallLinkedList, error)
+
+		// 通过模块名和路径名映射寻找处理函数，同时返回匹配到的已注册路由名，模式路由返回模式本身
+		Match(string, string) (CallLinkedList, string, error)
+
+		// 所有已注册的模块及路由名，路由名升序
+		Routes() map[string][]string
 	}
 
 	// 路由定义实现
+	// 注册、注销、替换都只替换映射中的调用链，已经取出调用链的执行不受影响，在原调用链上执行结束
+	// 匹配只持有读锁，模式路由在修改时按前缀长度预先排序，未命中精确路由时只遍历模式路由
 	router struct {
-		mutex sync.Mutex                           // 路由锁
-		route map[string]map[string]CallLinkedList // 路由映射，map[模块]map[路径]处理函数
+		mutex    sync.RWMutex                         // 路由锁
+		route    map[string]map[string]CallLinkedList // 路由映射，map[模块]map[路径]处理函数
+		patterns map[string][]string                  // 模式路由，map[模块]按前缀长度降序排列的模式
 	}
 )
 
+const (
+	// 模式路由后缀
+	PatternSuffix = "*"
+)
+
 // 此常量组定义了 Router 定义及实现中可能会发生的错误文本
 const (
 	ErrEmptyModuleNameText = "module name is empty"
@@ -54,8 +85,9 @@ var (
 // 新建路由
 func NewRouter() Router {
 	return &router{
-		mutex: sync.Mutex{},
-		route: make(map[string]map[string]CallLinkedList),
+		mutex:    sync.RWMutex{},
+		route:    make(map[string]map[string]CallLinkedList),
+		patterns: make(map[string][]string),
 	}
 }
 
@@ -76,32 +108,193 @@ func (r *router) RegisterRoute(module string, route map[string]CallLinkedList) e
 		return ErrModuleExist
 	}
 
-	r.route[module] = route
+	r.route[module] = copyRoute(route)
+	r.index(module)
 	return nil
 }
 
-// 通过模块名和路径名映射寻找处理函数
-func (r *router) RouteHandleFun(module, route string) (CallLinkedList, error) {
+// 注销模块及所属路由
+func (r *router) UnregisterRoute(module string) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exist := r.route[module]; !exist {
+		return ErrModuleUnExist
+	}
+
+	delete(r.route, module)
+	r.index(module)
+	return nil
+}
+
+// 替换模块及所属路由
+func (r *router) ReplaceRoute(module string, route map[string]CallLinkedList) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+	if route == nil {
+		return ErrNilRoute
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.route[module] = copyRoute(route)
+	r.index(module)
+	return nil
+}
+
+// 向模块添加单个路由
+func (r *router) AddRoute(module, route string, cll CallLinkedList) error {
 	if module == "" {
-		return nil, ErrEmptyModuleName
+		return ErrEmptyModuleName
 	}
 	if route == "" {
-		return nil, ErrEmptyRouteName
+		return ErrEmptyRouteName
+	}
+	if cll == nil {
+		return ErrNilRoute
 	}
 
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	routeMap, exist := r.route[module]
+	if !exist {
+		routeMap = make(map[string]CallLinkedList)
+		r.route[module] = routeMap
+	}
+
+	if _, exist := routeMap[route]; exist {
+		return ErrRouteExist
+	}
+
+	routeMap[route] = cll
+	r.index(module)
+	return nil
+}
+
+// 从模块移除单个路由
+func (r *router) RemoveRoute(module, route string) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+	if route == "" {
+		return ErrEmptyRouteName
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	routeMap, exist := r.route[module]
+	if !exist {
+		return ErrModuleUnExist
+	}
+	if _, exist := routeMap[route]; !exist {
+		return ErrRouteUnExist
+	}
+
+	delete(routeMap, route)
+	if len(routeMap) == 0 {
+		delete(r.route, module)
+	}
+	r.index(module)
+
+	return nil
+}
+
+// 通过模块名和路径名映射寻找处理函数
+func (r *router) RouteHandleFun(module, route string) (CallLinkedList, error) {
+	cll, _, err := r.Match(module, route)
+	return cll, err
+}
+
+// 通过模块名和路径名映射寻找处理函数，同时返回匹配到的已注册路由名
+func (r *router) Match(module, route string) (CallLinkedList, string, error) {
+	if module == "" {
+		return nil, "", ErrEmptyModuleName
+	}
+	if route == "" {
+		return nil, "", ErrEmptyRouteName
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	// 模块名不存在
 	routeMap, exist := r.route[module]
 	if !exist {
-		return nil, ErrModuleUnExist
+		return nil, "", ErrModuleUnExist
+	}
+
+	// 精确路由
+	if handleFunc, exist := routeMap[route]; exist {
+		return handleFunc, route, nil
+	}
+
+	// 模式路由，已按前缀长度降序排列，第一个匹配者即为前缀最长者
+	for _, pattern := range r.patterns[module] {
+		if strings.HasPrefix(route, strings.TrimSuffix(pattern, PatternSuffix)) {
+			return routeMap[pattern], pattern, nil
+		}
 	}
 
 	// 路径名不存在
-	if handleFunc, exist := routeMap[route]; !exist {
-		return nil, ErrRouteUnExist
-	} else {
-		return handleFunc, nil
+	return nil, "", ErrRouteUnExist
+}
+
+// 重建模块的模式路由索引，按前缀长度降序排列，长度相同时按字典序保证结果稳定
+// 调用方必须持有 r.mutex 写锁
+func (r *router) index(module string) {
+	patterns := make([]string, 0)
+	for pattern := range r.route[module] {
+		if strings.HasSuffix(pattern, PatternSuffix) {
+			patterns = append(patterns, pattern)
+		}
 	}
+
+	if len(patterns) == 0 {
+		delete(r.patterns, module)
+		return
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	r.patterns[module] = patterns
+}
+
+// 所有已注册的模块及路由名
+func (r *router) Routes() map[string][]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	routes := make(map[string][]string, len(r.route))
+	for module, routeMap := range r.route {
+		names := make([]string, 0, len(routeMap))
+		for name := range routeMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		routes[module] = names
+	}
+
+	return routes
+}
+
+// 复制路由映射，防止调用方在注册后修改映射引发竞态
+func copyRoute(route map[string]CallLinkedList) map[string]CallLinkedList {
+	another := make(map[string]CallLinkedList, len(route))
+	for path, cll := range route {
+		another[path] = cll
+	}
+
+	return another
 }
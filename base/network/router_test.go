@@ -0,0 +1,145 @@
+package network
+
+import (
+	"sync"
+	"testing"
+)
+
+// 以回覆数据标识命中的处理函数的模块
+type wildModule struct{}
+
+func (wildModule) Name() string { return "wild" }
+
+func (wildModule) Route() map[string][]RouteHandleFunc {
+	reply := func(data string) RouteHandleFunc {
+		return func(ctx Context) { _ = ctx.Success([]byte(data)) }
+	}
+
+	return map[string][]RouteHandleFunc{
+		"user.get": {reply("exact")},
+		"user.*":   {reply("pattern")},
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := NewRouter()
+	cll := NewCallLinkedList()
+	if err := r.RegisterRoute("m", map[string]CallLinkedList{
+		"user.get": cll,
+		"user.*":   cll,
+		"user.a*":  cll,
+		"*":        cll,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for route, want := range map[string]string{
+		"user.get":  "user.get", // 精确路由优先
+		"user.add":  "user.a*",  // 前缀最长者优先
+		"user.list": "user.*",
+		"order":     "*",
+	} {
+		if _, matched, err := r.Match("m", route); err != nil || matched != want {
+			t.Fatalf("match [%s] = %s , %v , want %s", route, matched, err, want)
+		}
+	}
+	if _, _, err := r.Match("x", "user.get"); err != ErrModuleUnExist {
+		t.Fatalf("match unknown module = %v , want %v", err, ErrModuleUnExist)
+	}
+
+	// 修改后模式索引随之更新
+	if err := r.RemoveRoute("m", "*"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Match("m", "order"); err != ErrRouteUnExist {
+		t.Fatalf("match removed pattern = %v , want %v", err, ErrRouteUnExist)
+	}
+	if err := r.AddRoute("m", "or*", cll); err != nil {
+		t.Fatal(err)
+	}
+	if _, matched, err := r.Match("m", "order"); err != nil || matched != "or*" {
+		t.Fatalf("match added pattern = %s , %v", matched, err)
+	}
+	if err := r.ReplaceRoute("m", map[string]CallLinkedList{"user.get": cll}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Match("m", "user.add"); err != ErrRouteUnExist {
+		t.Fatalf("match replaced pattern = %v , want %v", err, ErrRouteUnExist)
+	}
+}
+
+func TestRouterConcurrentMatch(t *testing.T) {
+	r := NewRouter()
+	cll := NewCallLinkedList()
+	if err := r.RegisterRoute("m", map[string]CallLinkedList{"a": cll, "b*": cll}); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				_, _, _ = r.Match("m", "a")
+				_, _, _ = r.Match("m", "bc")
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		_ = r.AddRoute("m", "c*", cll)
+		_ = r.RemoveRoute("m", "c*")
+	}
+	wg.Wait()
+}
+
+func TestNotFoundAndPatternRoutes(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}, wildModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(addr))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 模式路由经由服务分发，精确路由优先
+	for route, want := range map[string]string{"user.get": "exact", "user.add": "pattern"} {
+		if reply := requestReply(t, c, "wild", route, nil); reply.Code != ReplySuccessCode || string(reply.Data) != want {
+			t.Fatalf("wild.%s = %+v , want %s", route, reply, want)
+		}
+	}
+
+	// 未设置时回复 ReplyNotFound
+	if reply := requestReply(t, c, "wild", "order", nil); reply.Code != ReplyNotFoundCode {
+		t.Fatalf("unmatched route = %d , want %d", reply.Code, ReplyNotFoundCode)
+	}
+	if reply := requestReply(t, c, "missing", "echo", nil); reply.Code != ReplyNotFoundCode {
+		t.Fatalf("missing module = %d , want %d", reply.Code, ReplyNotFoundCode)
+	}
+
+	// 模块的未找到处理优先于服务的未找到处理
+	if err := s.SetNotFoundHandler(func(ctx Context) { _ = ctx.Success([]byte("service")) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetModuleNotFoundHandler("test", func(ctx Context) { _ = ctx.Success([]byte("module")) }); err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range [][3]string{{"test", "missing", "module"}, {"wild", "order", "service"}, {"missing", "echo", "service"}} {
+		if reply := requestReply(t, c, request[0], request[1], nil); reply.Code != ReplySuccessCode || string(reply.Data) != request[2] {
+			t.Fatalf("%s.%s = %+v , want %s", request[0], request[1], reply, request[2])
+		}
+	}
+
+	if err := s.SetNotFoundHandler(); err != ErrEmptyHandleFunc {
+		t.Fatalf("set empty not found = %v , want %v", err, ErrEmptyHandleFunc)
+	}
+	if err := s.SetModuleNotFoundHandler("", NotFoundHandler); err != ErrEmptyModuleName {
+		t.Fatalf("set module not found without module = %v , want %v", err, ErrEmptyModuleName)
+	}
+}
@@ -1,8 +1,12 @@
 package network
 
 import (
+	oContext "context"
 	"errors"
 	"jarvis/base/log"
+	uTime "jarvis/util/time"
+	"sync"
+	"time"
 )
 
 type (
@@ -15,28 +19,150 @@ type (
 		// 注册路由
 		RegisterModule(...Module) error
 
+		// 注销模块，可在运行中调用，已经在执行的调用链不受影响
+		UnregisterModule(string) error
+
+		// 替换模块，模块不存在时直接注册，可在运行中调用，已经在执行的调用链在原调用链上执行结束
+		ReplaceModule(Module) error
+
+		// 向模块添加单个路由，模块不存在时新建模块，可在运行中调用
+		AddRoute(string, string, ...RouteHandleFunc) error
+
+		// 从模块移除单个路由，可在运行中调用
+		RemoveRoute(string, string) error
+
+		// 设置服务的未找到处理，模块或路由不存在时执行，默认为 NotFoundHandler
+		SetNotFoundHandler(...RouteHandleFunc) error
+
+		// 设置模块的未找到处理，优先于服务的未找到处理
+		SetModuleNotFoundHandler(string, ...RouteHandleFunc) error
+
 		// 注册观察者
 		// 此函数必须在 Run() 前调用
 		RegisterObserver(Observer) error
 
+		// 设置分发器，替换默认分发器，此函数必须在 Run() 前调用
+		SetDispatcher(Dispatcher) error
+
+		// 分发器统计
+		DispatcherStats() DispatchStats
+
+		// 设置服务分发模式，默认为 DispatchModeConcurrent
+		// DispatchModeOrdered 模式下同一个 Item 的消息按到达顺序串行执行调用链，不同 Item 之间依旧并发
+		SetDispatchMode(DispatchMode) error
+
+		// 设置模块分发模式，优先于服务分发模式
+		SetModuleDispatchMode(string, DispatchMode) error
+
+		// 设置认证者，未认证的连接只能进行认证，此函数必须在 Run() 前调用
+		SetAuthenticator(Authenticator, AuthOption) error
+
+		// 设置心跳，默认为 DefaultHeartbeat() ，默认不开启空闲检测，此函数必须在 Run() 前调用
+		SetHeartbeat(Heartbeat) error
+
+		// 设置装包者，默认为 DefaultPackager() ，每个 Item 使用其克隆，此函数必须在 Run() 前调用
+		SetPackager(Packager) error
+
+		// 设置加密器工厂，每个连接使用工厂新建的加密器，默认为 DefaultEncrypter
+		// 工厂新建的加密器需要密钥交换时，Item 创建后立即发送握手数据，此函数必须在 Run() 前调用
+		SetEncrypter(EncrypterFactory) error
+
+		// 设置客户端可以协商的编解码器，JSONCodec() 始终可以协商，此函数必须在 Run() 前调用
+		SetCodecs(...Codec) error
+
+		// 设置客户端可以协商的压缩器及压缩阈值，长度小于阈值的数据不压缩，阈值小于等于零时为 DefaultCompressThreshold
+		// 此函数必须在 Run() 前调用
+		SetCompression(int, ...Compressor) error
+
+		// 设置模块超时，模块下所有路由的请求上下文在超时后取消，小于等于零表示取消设置
+		SetModuleTimeout(string, time.Duration) error
+
+		// 设置路由超时，优先于模块超时，小于等于零表示取消设置
+		SetRouteTimeout(string, string, time.Duration) error
+
 		// 非阻塞运行，接收不定数量的 Gate ，每个 Gate 实例都会在同一个线程内串行执行 Initialize()-Running()-Destroy()
 		// 因此，务必确保 Gate.Running() 函数是阻塞式的
 		Run(...Gate) error
+
+		// 设置用户绑定策略，默认为 BindPolicyMultiple
+		SetBindPolicy(BindPolicy) error
+
+		// 寻找用户绑定的所有本地连接
+		FindByUser(string) []Item
+
+		// 设置集群，此函数必须在 Run() 前调用
+		SetCluster(Cluster) error
+
+		// 投递到指定 id 的连接，包括其他节点
+		SendTo(string, Message) error
+
+		// 投递到用户绑定的所有连接，包括其他节点
+		SendToUser(string, Message) error
+
+		// 踢掉指定 id 的连接，包括其他节点
+		Kick(string) error
+
+		// 所有本地连接
+		Items() []Item
+
+		// 所有已注册的模块及路由名
+		Routes() map[string][]string
+
+		// 向组内所有成员广播，包括其他节点
+		Broadcast(string, Message) error
+
+		// 向所有连接广播，包括其他节点
+		BroadcastAll(Message) error
+
+		// 优雅关闭，停止所有 Gate 接收新连接、停止分发新消息，在 ctx 截止前等待处理中的调用链结束，
+		// 随后取消所有请求上下文，向所有被管理的 Item 发送可选的告别消息并关闭，最后通知观察者
+		Shutdown(oContext.Context, ...Message) error
 	}
 
 	// 服务定义实现
 	service struct {
-		manager            Manager        // 端管理
-		router             Router         // 路由管理
-		packager           Packager       // 装包者
-		IntoStream         chan Message   // 進入流
-		rootCallLinkedList CallLinkedList // 根调用链
+		ctx                oContext.Context          // 服务标准库上下文，所有 Item 及请求上下文的根
+		cancel             oContext.CancelFunc       // 关闭时取消服务标准库上下文
+		timeouts           map[string]time.Duration  // 超时设置，键为 模块名 或 模块名/路由名
+		timeoutMutex       sync.RWMutex              // 超时设置竞态锁
+		manager            Manager                   // 端管理
+		router             Router                    // 路由管理
+		packager           Packager                  // 装包者
+		encrypter          EncrypterFactory          // 加密器工厂
+		IntoStream         chan Message              // 進入流
+		rootCallLinkedList CallLinkedList            // 根调用链
+		dispatcher         Dispatcher                // 分发器
+		mode               DispatchMode              // 服务分发模式
+		moduleModes        map[string]DispatchMode   // 模块分发模式
+		modeMutex          sync.RWMutex              // 分发模式竞态锁
+		heartbeat          Heartbeat                 // 心跳
+		codecs             map[string]Codec          // 可以协商的编解码器，map[名称]编解码器
+		compressors        map[string]Compressor     // 可以协商的压缩器，map[名称]压缩器
+		threshold          int                       // 压缩阈值
+		authenticator      Authenticator             // 认证者
+		authOption         AuthOption                // 认证选项
+		authFailures       map[string]int            // 认证失败次数，map[端 id]次数
+		authMutex          sync.Mutex                // 认证失败次数竞态锁
+		cluster            Cluster                   // 集群
+		notFound           CallLinkedList            // 服务的未找到处理
+		moduleNotFound     map[string]CallLinkedList // 模块的未找到处理，map[模块]调用链
+		notFoundMutex      sync.RWMutex              // 未找到处理竞态锁
+		gates              []Gate                    // 运行中的入口
+		mutex              sync.Mutex                // 服务状态竞态锁
+		closed             bool                      // 是否已关闭
+		inFlight           sync.WaitGroup            // 处理中的调用链
+		receivers          sync.WaitGroup            // 向进入流推送消息的 Item 读取协程，全部退出后才能关闭进入流
+		startOnce          sync.Once                 // 分发器、进入流接收、空闲巡检只启动一次
+		overloads          chan struct{}             // 发送中的过载回复，满时不再回复
 	}
 )
 
 const (
 	// 默认进入流管道宽度
 	DefaultIntoStreamSize = 5000
+
+	// 同时发送中的过载回复上限
+	DefaultOverloadReplies = 256
 )
 
 // 此常量组定义了 Service 定义及实现中可能会发生的错误文本
@@ -45,9 +171,17 @@ const (
 	ErrNilGatesText            = "list of Gate is nil"
 	ErrEmptyModulesText        = "list of Module is empty"
 	ErrNilModulesText          = "list of Module is nil"
+	ErrNilModuleText           = "module is nil"
 	ErrNilObserverText         = "observer is nil"
 	ErrNilMiddlewareListText   = "list of middleware is nil"
 	ErrEmptyMiddlewareListText = "list of middleware is empty"
+	ErrServiceClosedText       = "service already shut down"
+	ErrNilDispatcherText       = "dispatcher is nil"
+	ErrServiceRunningText      = "service already running"
+	ErrNilAuthenticatorText    = "authenticator is nil"
+	ErrNilClusterText          = "cluster is nil"
+	ErrNilPackagerText         = "packager is nil"
+	ErrNilEncrypterText        = "encrypter factory is nil"
 )
 
 // 此常量组定义了 Service 定义及实现中可能会发生的错误
@@ -60,12 +194,28 @@ var (
 	ErrEmptyModules = errors.New(ErrEmptyModulesText)
 	// Module 列表为 nil 错误
 	ErrNilModules = errors.New(ErrNilModulesText)
+	// Module 为 nil 错误
+	ErrNilModule = errors.New(ErrNilModuleText)
 	// Observer 列表为 nil 错误
 	ErrNilObserver = errors.New(ErrNilObserverText)
 	// 中间件列表为 nil 错误
 	ErrNilMiddlewareList = errors.New(ErrNilMiddlewareListText)
 	// 中间件列表为空 错误
 	ErrEmptyMiddlewareList = errors.New(ErrEmptyMiddlewareListText)
+	// 服务已关闭 错误
+	ErrServiceClosed = errors.New(ErrServiceClosedText)
+	// 分发器为 nil 错误
+	ErrNilDispatcher = errors.New(ErrNilDispatcherText)
+	// 服务已运行 错误
+	ErrServiceRunning = errors.New(ErrServiceRunningText)
+	// 认证者为 nil 错误
+	ErrNilAuthenticator = errors.New(ErrNilAuthenticatorText)
+	// 集群为 nil 错误
+	ErrNilCluster = errors.New(ErrNilClusterText)
+	// 装包者为 nil 错误
+	ErrNilPackager = errors.New(ErrNilPackagerText)
+	// 加密器工厂为 nil 错误
+	ErrNilEncrypter = errors.New(ErrNilEncrypterText)
 )
 
 // 新建服务
@@ -75,13 +225,37 @@ func NewService(max, intoStreamSize int64) Service {
 		intoStreamSize = DefaultIntoStreamSize
 	}
 
-	return &service{
+	ctx, cancel := oContext.WithCancel(oContext.Background())
+
+	s := &service{
+		ctx:                ctx,
+		cancel:             cancel,
+		timeouts:           make(map[string]time.Duration),
+		timeoutMutex:       sync.RWMutex{},
 		manager:            NewManage(max),
 		router:             NewRouter(),
 		packager:           DefaultPackager(),
+		encrypter:          DefaultEncrypter,
 		IntoStream:         make(chan Message, intoStreamSize),
 		rootCallLinkedList: NewCallLinkedList(),
+		dispatcher:         DefaultDispatcher(),
+		mode:               DispatchModeConcurrent,
+		moduleModes:        make(map[string]DispatchMode),
+		modeMutex:          sync.RWMutex{},
+		heartbeat:          DefaultHeartbeat(),
+		codecs:             map[string]Codec{CodecJSON: JSONCodec()},
+		compressors:        make(map[string]Compressor),
+		threshold:          DefaultCompressThreshold,
+		authFailures:       make(map[string]int),
+		moduleNotFound:     make(map[string]CallLinkedList),
+		notFoundMutex:      sync.RWMutex{},
+		gates:              make([]Gate, 0),
+		mutex:              sync.Mutex{},
+		closed:             false,
+		overloads:          make(chan struct{}, DefaultOverloadReplies),
 	}
+
+	return s
 }
 
 // 注册路由
@@ -97,22 +271,8 @@ func (s *service) RegisterModule(modules ...Module) error {
 
 	// 遍历所有注册的 Module
 	for _, module := range modules {
-		// 为每个 Module 实例化一个调用链映射表
-		routeMap := make(map[string]CallLinkedList)
-		// 遍历 Module 的路由
-		for path, handleFuncList := range module.Route() {
-			// 复制当前 Service 的根调用链，其产生的基础为插入中间件调用节点
-			cll := s.rootCallLinkedList.Copy()
-			// 遍历 Module 路由的调用函数组，根据顺序创建节点加入复制后的调用链中
-			for _, handleFunc := range handleFuncList {
-				cll.AddNode(handleFunc)
-			}
-			// 将完成的调用链根据 path 路径加入到调用链映射表
-			routeMap[path] = cll
-		}
-
 		// 将 Module 和重建的调用链映射表注册到 Service 持有的路由器中
-		if err := s.router.RegisterRoute(module.Name(), routeMap); err != nil {
+		if err := s.router.RegisterRoute(module.Name(), s.routeMap(module)); err != nil {
 			return err
 		}
 	}
@@ -120,6 +280,105 @@ func (s *service) RegisterModule(modules ...Module) error {
 	return nil
 }
 
+// 注销模块
+// 路由器只移除调用链映射，已经取出调用链的执行不受影响
+func (s *service) UnregisterModule(name string) error {
+	return s.router.UnregisterRoute(name)
+}
+
+// 替换模块，模块不存在时直接注册
+// 新调用链映射整体替换旧映射，替换之后到达的消息使用新调用链，已经在执行的调用链在原调用链上执行结束
+func (s *service) ReplaceModule(module Module) error {
+	if module == nil {
+		return ErrNilModule
+	}
+
+	return s.router.ReplaceRoute(module.Name(), s.routeMap(module))
+}
+
+// 向模块添加单个路由，模块不存在时新建模块
+func (s *service) AddRoute(module, route string, handleFunc ...RouteHandleFunc) error {
+	if len(handleFunc) == 0 {
+		return ErrEmptyHandleFunc
+	}
+
+	return s.router.AddRoute(module, route, s.callLinkedList(handleFunc))
+}
+
+// 从模块移除单个路由
+func (s *service) RemoveRoute(module, route string) error {
+	return s.router.RemoveRoute(module, route)
+}
+
+// 设置服务的未找到处理
+// 未找到处理与路由一样以根调用链为基础构建，因此中间件同样生效
+func (s *service) SetNotFoundHandler(handleFunc ...RouteHandleFunc) error {
+	if len(handleFunc) == 0 {
+		return ErrEmptyHandleFunc
+	}
+
+	s.notFoundMutex.Lock()
+	defer s.notFoundMutex.Unlock()
+
+	s.notFound = s.callLinkedList(handleFunc)
+	return nil
+}
+
+// 设置模块的未找到处理
+func (s *service) SetModuleNotFoundHandler(module string, handleFunc ...RouteHandleFunc) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+	if len(handleFunc) == 0 {
+		return ErrEmptyHandleFunc
+	}
+
+	s.notFoundMutex.Lock()
+	defer s.notFoundMutex.Unlock()
+
+	s.moduleNotFound[module] = s.callLinkedList(handleFunc)
+	return nil
+}
+
+// 取得未找到处理，模块优先，均未设置时为 NotFoundHandler
+func (s *service) notFoundHandler(module string) CallLinkedList {
+	s.notFoundMutex.RLock()
+	defer s.notFoundMutex.RUnlock()
+
+	if cll, exist := s.moduleNotFound[module]; exist {
+		return cll
+	}
+	if s.notFound != nil {
+		return s.notFound
+	}
+
+	// 每次以当前根调用链构建，使之后注册的中间件同样生效
+	return s.callLinkedList([]RouteHandleFunc{NotFoundHandler})
+}
+
+// 为 Module 实例化一个调用链映射表
+func (s *service) routeMap(module Module) map[string]CallLinkedList {
+	routeMap := make(map[string]CallLinkedList)
+	// 遍历 Module 的路由，将完成的调用链根据 path 路径加入到调用链映射表
+	for path, handleFuncList := range module.Route() {
+		routeMap[path] = s.callLinkedList(handleFuncList)
+	}
+
+	return routeMap
+}
+
+// 构建调用链
+func (s *service) callLinkedList(handleFuncList []RouteHandleFunc) CallLinkedList {
+	// 复制当前 Service 的根调用链，其产生的基础为插入中间件调用节点
+	cll := s.rootCallLinkedList.Copy()
+	// 遍历 Module 路由的调用函数组，根据顺序创建节点加入复制后的调用链中
+	for _, handleFunc := range handleFuncList {
+		cll.AddNode(handleFunc)
+	}
+
+	return cll
+}
+
 // 注册中间件
 // 此函数必须在 RegisterModule() 前调用，才能得到包含完整的中间件的根调用链
 func (s *service) UseMiddleware(middleware ...RouteHandleFunc) error {
@@ -151,6 +410,389 @@ func (s *service) RegisterObserver(observer Observer) error {
 	return nil
 }
 
+// 设置分发器
+// 此函数必须在 Run() 前调用
+func (s *service) SetDispatcher(dispatcher Dispatcher) error {
+	if dispatcher == nil {
+		return ErrNilDispatcher
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	s.dispatcher = dispatcher
+	return nil
+}
+
+// 分发器统计
+func (s *service) DispatcherStats() DispatchStats {
+	return s.dispatcher.Stats()
+}
+
+// 设置服务分发模式
+func (s *service) SetDispatchMode(mode DispatchMode) error {
+	s.modeMutex.Lock()
+	defer s.modeMutex.Unlock()
+
+	s.mode = mode
+	return nil
+}
+
+// 设置模块分发模式
+func (s *service) SetModuleDispatchMode(module string, mode DispatchMode) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+
+	s.modeMutex.Lock()
+	defer s.modeMutex.Unlock()
+
+	s.moduleModes[module] = mode
+	return nil
+}
+
+// 获取模块分发模式，模块未设置时使用服务分发模式
+func (s *service) dispatchMode(module string) DispatchMode {
+	s.modeMutex.RLock()
+	defer s.modeMutex.RUnlock()
+
+	if mode, exist := s.moduleModes[module]; exist {
+		return mode
+	}
+
+	return s.mode
+}
+
+// 设置认证者
+// 此函数必须在 Run() 前调用
+func (s *service) SetAuthenticator(authenticator Authenticator, option AuthOption) error {
+	if authenticator == nil {
+		return ErrNilAuthenticator
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	s.authenticator = authenticator
+	s.authOption = option
+	return nil
+}
+
+// 认证拦截，返回 true 表示消息已由认证阶段处理，不再进行路由分发
+// 未认证的连接：握手消息(或未指定握手路由时的任意消息)交由分发器认证，其他消息回复未认证
+// 已认证的连接：握手消息重新认证，其他消息正常路由
+func (s *service) authorize(request Message) bool {
+	if s.authenticator == nil {
+		return false
+	}
+
+	i, err := s.manager.FindItem(request.ID)
+	if err != nil {
+		return true
+	}
+
+	handshake := s.authOption.isHandshake(request)
+	if i.IsAuthenticated() && !handshake {
+		return false
+	}
+
+	if handshake || s.authOption.Module == "" {
+		if !s.enter() {
+			return true
+		}
+
+		if err := s.dispatcher.Dispatch(Task{
+			Message: request,
+			Key:     request.ID, // 同一个连接的认证串行执行
+			Run:     s.authenticate(i, request),
+			Discard: s.inFlight.Done,
+		}); err != nil {
+			log.WarnF("dispatch authentication from [%s] error : %s", request.ID, err.Error())
+		}
+		return true
+	}
+
+	ctx := NewContext(request)
+	ctx.HookFind(s.manager.FindItem)
+	ctx.HookCodec(i.Codec())
+	if err := ctx.Reply(ReplyUnauthorized(nil)); err != nil {
+		log.ErrorF("reply unauthorized to [%s] error : %s", request.ID, err.Error())
+	}
+	return true
+}
+
+// 构建认证函数，认证成功保存认证主体，失败达到允许次数时关闭连接
+func (s *service) authenticate(i Item, request Message) func() {
+	return func() {
+		defer s.inFlight.Done()
+
+		ctx, cancel := newRequestContext(i.Context(), s.timeout(request.Module, request.Route), request, "")
+		defer cancel()
+		ctx.HookFind(s.manager.FindItem)
+		ctx.HookManager(s.manager)
+		ctx.HookCluster(s.cluster)
+		ctx.HookCodec(i.Codec())
+
+		principal, err := s.authenticator.Authenticate(ctx)
+		if err != nil {
+			if err := ctx.Reply(ReplyUnauthorized([]byte(err.Error()))); err != nil {
+				log.ErrorF("reply unauthorized to [%s] error : %s", request.ID, err.Error())
+			}
+
+			s.authMutex.Lock()
+			s.authFailures[request.ID]++
+			failures := s.authFailures[request.ID]
+			s.authMutex.Unlock()
+
+			if failures >= s.authOption.attempts() {
+				log.InfoF("[%s] authenticate failed %d times : %s", request.ID, failures, err.Error())
+				i.CloseWithState(ItemStateUnauthorizedClose)
+			}
+			return
+		}
+
+		i.SetPrincipal(principal)
+		s.authMutex.Lock()
+		delete(s.authFailures, request.ID)
+		s.authMutex.Unlock()
+
+		// 一次性连接只有这一个请求，未指定握手路由时继续路由，否则请求本身永远得不到处理
+		if it, ok := i.(*item); ok && s.authOption.Module == "" && oneShot(it.conn) {
+			handleCLL, route := s.match(request)
+			if s.enter() {
+				s.handle(handleCLL, request, route)()
+			}
+			return
+		}
+
+		if err := ctx.Success(nil); err != nil {
+			log.ErrorF("reply authenticated to [%s] error : %s", request.ID, err.Error())
+		}
+	}
+}
+
+// 认证超时检查，连接建立后超过 AuthOption.Timeout 仍未认证成功则关闭
+func (s *service) authDeadline(i Item) {
+	if s.authenticator == nil || s.authOption.Timeout <= 0 {
+		return
+	}
+
+	time.AfterFunc(s.authOption.Timeout, func() {
+		if i.Context().Err() != nil || i.IsAuthenticated() {
+			return
+		}
+
+		log.InfoF("[%s] authenticate timeout", i.ID().String())
+		i.CloseWithState(ItemStateUnauthorizedClose)
+	})
+}
+
+// 移除端，清理服务持有的端相关状态后从 manager 中移除
+func (s *service) removeItem(id string) error {
+	s.authMutex.Lock()
+	delete(s.authFailures, id)
+	s.authMutex.Unlock()
+
+	if s.cluster != nil {
+		if err := s.cluster.Unregister(id); err != nil {
+			log.ErrorF("cluster unregister [%s] error : %s", id, err.Error())
+		}
+	}
+
+	return s.manager.RemoveItem(id)
+}
+
+// 设置心跳
+// 此函数必须在 Run() 前调用
+func (s *service) SetHeartbeat(heartbeat Heartbeat) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	s.heartbeat = heartbeat
+	return nil
+}
+
+// 设置装包者
+// 此函数必须在 Run() 前调用
+func (s *service) SetPackager(packager Packager) error {
+	if packager == nil {
+		return ErrNilPackager
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	s.packager = packager
+	return nil
+}
+
+// 设置加密器工厂
+// 此函数必须在 Run() 前调用
+func (s *service) SetEncrypter(factory EncrypterFactory) error {
+	if factory == nil {
+		return ErrNilEncrypter
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	s.encrypter = factory
+	return nil
+}
+
+// 设置客户端可以协商的编解码器
+// 此函数必须在 Run() 前调用
+func (s *service) SetCodecs(codecs ...Codec) error {
+	for _, codec := range codecs {
+		if codec == nil {
+			return ErrNilCodec
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	for _, codec := range codecs {
+		s.codecs[codec.Name()] = codec
+	}
+	return nil
+}
+
+// 设置客户端可以协商的压缩器及压缩阈值
+// 此函数必须在 Run() 前调用
+func (s *service) SetCompression(threshold int, compressors ...Compressor) error {
+	for _, compressor := range compressors {
+		if compressor == nil {
+			return ErrNilCompressor
+		}
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	for _, compressor := range compressors {
+		s.compressors[compressor.Name()] = compressor
+	}
+	s.threshold = threshold
+	return nil
+}
+
+// 巡检所有 Item ，关闭空闲超时的 Item
+func (s *service) patrol(now time.Time) bool {
+	if s.isClosed() {
+		return false
+	}
+
+	for _, i := range s.manager.Items() {
+		if now.Sub(i.LastRead()) > s.heartbeat.Timeout {
+			log.InfoF("[%s] idle timeout, last read at %s", i.ID().String(), i.LastRead().Format(time.RFC3339))
+			i.CloseWithState(ItemStateTimeoutClose)
+		}
+	}
+
+	return true
+}
+
+// 设置模块超时
+func (s *service) SetModuleTimeout(module string, timeout time.Duration) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+
+	s.setTimeout(module, timeout)
+	return nil
+}
+
+// 设置路由超时
+func (s *service) SetRouteTimeout(module, route string, timeout time.Duration) error {
+	if module == "" {
+		return ErrEmptyModuleName
+	}
+	if route == "" {
+		return ErrEmptyRouteName
+	}
+
+	s.setTimeout(module+"/"+route, timeout)
+	return nil
+}
+
+// 记录超时设置，小于等于零时移除
+func (s *service) setTimeout(key string, timeout time.Duration) {
+	s.timeoutMutex.Lock()
+	defer s.timeoutMutex.Unlock()
+
+	if timeout <= 0 {
+		delete(s.timeouts, key)
+		return
+	}
+
+	s.timeouts[key] = timeout
+}
+
+// 获取路由超时，路由未设置时使用模块超时，都未设置返回 0
+func (s *service) timeout(module, route string) time.Duration {
+	s.timeoutMutex.RLock()
+	defer s.timeoutMutex.RUnlock()
+
+	if timeout, exist := s.timeouts[module+"/"+route]; exist {
+		return timeout
+	}
+
+	return s.timeouts[module]
+}
+
 // 非阻塞运行，接收不定数量的 Gate ，每个 Gate 实例都会在同一个线程内串行执行 Initialize()-Running()-Destroy()
 // 因此，务必确保 Gate.Running() 函数是阻塞式的
 func (s *service) Run(gates ...Gate) error {
@@ -161,8 +803,36 @@ func (s *service) Run(gates ...Gate) error {
 		return ErrEmptyGates
 	}
 
-	// 开启服务接收进入流
-	go s.receive()
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrServiceClosed
+	}
+	s.gates = append(s.gates, gates...)
+	s.mutex.Unlock()
+
+	// 多次调用 Run() 时只启动一次，单一的进入流接收保证同一个 Item 的消息按到达顺序分发
+	s.startOnce.Do(func() {
+		// 启动集群，接收其他节点的投递
+		if s.cluster != nil {
+			if err := s.cluster.Start(s); err != nil {
+				log.ErrorF("cluster [%s] start error : %s", s.cluster.Node(), err.Error())
+			}
+		}
+
+		// 启动分发器，过载时向请求来源回复
+		s.dispatcher.HookOverload(s.overload)
+		s.dispatcher.Start()
+
+		// 开启服务接收进入流，并计入进入流积压深度
+		go s.receive()
+		trackService(s)
+
+		// 开启空闲巡检，服务关闭后停止
+		if s.heartbeat.Interval > 0 && s.heartbeat.Timeout > 0 {
+			uTime.NewTicker(s.heartbeat.Interval, s.patrol).Run()
+		}
+	})
 
 	// 开启入口群
 	for _, g := range gates {
@@ -174,11 +844,19 @@ func (s *service) Run(gates ...Gate) error {
 				return
 			}
 
-			if err := gate.Running(s.acceptConn); err != nil {
+			if err := gate.Running(func(conn Conn) {
+				s.acceptConn(gate.Name(), conn)
+			}); err != nil && !s.isClosed() {
 				log.InfoF("[%s] gate running error : %s", gate.Name(), err.Error())
 				return
 			}
 
+			// 服务关闭时 Gate 已经由 Shutdown() 销毁，此处不再重复销毁
+			if s.isClosed() {
+				log.InfoF("[%s] gate done", gate.Name())
+				return
+			}
+
 			if err := gate.Destroy(); err != nil {
 				log.InfoF("[%s] gate destroy error : %s", gate.Name(), err.Error())
 				return
@@ -190,6 +868,247 @@ func (s *service) Run(gates ...Gate) error {
 	return nil
 }
 
+// 优雅关闭
+// 1.标记关闭，此后 acceptConn() 拒绝新连接，receive() 丢弃新消息
+// 2.停止所有 Gate 接收新连接，实现了 GracefulGate 的入口只停止接收，已有连接保持可用，其余入口直接销毁
+// 3.在 ctx 截止前等待处理中的调用链结束
+// 4.取消服务标准库上下文，仍在运行的请求上下文随之取消，停止分发器
+// 5.向所有被管理的 Item 发送可选的告别消息后关闭，Item 关闭时会经由 Manager 通知观察者断开
+// 6.销毁实现了 GracefulGate 的入口，等待 Item 读取协程全部退出后关闭进入流，receive() 随之退出
+// 7.通知实现了 ShutdownObserver 的观察者
+// 若 ctx 在调用链结束前截止，依旧会关闭所有 Item ，并返回 ctx.Err()
+// 若 ctx 在 Item 读取协程全部退出前截止，不再等待，返回 ctx.Err() ，进入流在读取协程全部退出后关闭
+func (s *service) Shutdown(ctx oContext.Context, goodbye ...Message) error {
+	if ctx == nil {
+		ctx = oContext.Background()
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return ErrServiceClosed
+	}
+	s.closed = true
+	gates := s.gates
+	s.gates = nil
+	s.mutex.Unlock()
+
+	// 停止所有 Gate 接收新连接，可以优雅关闭的入口在 Item 关闭后再销毁，使处理中的调用链及告别消息能够送达
+	graceful := make([]Gate, 0)
+	for _, gate := range gates {
+		if gg, ok := gate.(GracefulGate); ok {
+			if err := gg.StopAccept(); err != nil {
+				log.InfoF("[%s] gate stop accept error : %s", gate.Name(), err.Error())
+			}
+			graceful = append(graceful, gate)
+			continue
+		}
+		if err := gate.Destroy(); err != nil {
+			log.InfoF("[%s] gate destroy error : %s", gate.Name(), err.Error())
+		}
+	}
+
+	// 等待处理中的调用链结束
+	drained := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(drained)
+	}()
+
+	var e error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		e = ctx.Err()
+		log.WarnF("service shutdown before in-flight call linked list done : %s", e.Error())
+	}
+
+	// 取消所有请求上下文，停止分发器
+	s.cancel()
+	s.dispatcher.Stop()
+
+	// 发送告别消息并关闭所有 Item
+	for _, i := range s.manager.Items() {
+		for _, message := range goodbye {
+			i.Send(message)
+		}
+		i.Close()
+	}
+
+	// 销毁可以优雅关闭的入口
+	for _, gate := range graceful {
+		if err := gate.Destroy(); err != nil {
+			log.InfoF("[%s] gate destroy error : %s", gate.Name(), err.Error())
+		}
+	}
+
+	// Item 读取协程全部退出后不会再有推送，关闭进入流结束 receive()
+	// 连接的读取在关闭后仍未返回时不再等待，进入流在读取协程全部退出后关闭
+	received := make(chan struct{})
+	go func() {
+		s.receivers.Wait()
+		close(s.IntoStream)
+		untrackService(s)
+		close(received)
+	}()
+
+	select {
+	case <-received:
+	case <-ctx.Done():
+		if e == nil {
+			e = ctx.Err()
+			log.WarnF("service shutdown before item receivers exit : %s", e.Error())
+		}
+	}
+
+	// 停止集群
+	if s.cluster != nil {
+		if err := s.cluster.Stop(); err != nil {
+			log.ErrorF("cluster [%s] stop error : %s", s.cluster.Node(), err.Error())
+		}
+	}
+
+	// 通知观察者
+	s.manager.NotifyShutdown()
+
+	return e
+}
+
+// 设置用户绑定策略
+func (s *service) SetBindPolicy(policy BindPolicy) error {
+	s.manager.SetBindPolicy(policy)
+	return nil
+}
+
+// 寻找用户绑定的所有本地连接
+func (s *service) FindByUser(userKey string) []Item {
+	return s.manager.FindByUser(userKey)
+}
+
+// 设置集群
+// 此函数必须在 Run() 前调用
+func (s *service) SetCluster(cluster Cluster) error {
+	if cluster == nil {
+		return ErrNilCluster
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	if len(s.gates) != 0 {
+		return ErrServiceRunning
+	}
+
+	s.cluster = cluster
+	s.manager.HookCluster(cluster)
+	return nil
+}
+
+// 投递到指定 id 的连接，包括其他节点
+func (s *service) SendTo(id string, message Message) error {
+	if id == "" {
+		return ErrNilId
+	}
+
+	return sendTo(s.manager, s.cluster, id, message)
+}
+
+// 投递到用户绑定的所有连接，包括其他节点
+func (s *service) SendToUser(userKey string, message Message) error {
+	return sendToUser(s.manager, s.cluster, userKey, message)
+}
+
+// 踢掉指定 id 的连接，包括其他节点
+func (s *service) Kick(id string) error {
+	if id == "" {
+		return ErrNilId
+	}
+
+	return kick(s.manager, s.cluster, id)
+}
+
+// 所有本地连接
+func (s *service) Items() []Item {
+	return s.manager.Items()
+}
+
+// 所有已注册的模块及路由名
+func (s *service) Routes() map[string][]string {
+	return s.router.Routes()
+}
+
+// 向组内所有成员广播，包括其他节点
+func (s *service) Broadcast(group string, message Message) error {
+	return broadcastGroup(s.manager, s.cluster, group, message)
+}
+
+// 向所有连接广播，包括其他节点
+func (s *service) BroadcastAll(message Message) error {
+	return broadcastAll(s.manager, s.cluster, message)
+}
+
+// 投递到本地指定 id 的连接，实现 ClusterHandler
+func (s *service) DeliverTo(id string, message Message) {
+	i, err := s.manager.FindItem(id)
+	if err != nil {
+		log.WarnF("cluster deliver to [%s] error : %s", id, err.Error())
+		return
+	}
+
+	i.Send(message)
+}
+
+// 投递到本地用户绑定的所有连接，实现 ClusterHandler
+func (s *service) DeliverToUser(userKey string, message Message) {
+	for _, i := range s.manager.FindByUser(userKey) {
+		i.Send(message)
+	}
+}
+
+// 投递到本地组，实现 ClusterHandler
+func (s *service) DeliverToGroup(group string, message Message) {
+	if err := s.manager.Broadcast(group, message); err != nil && err != ErrGroupUnExist {
+		log.WarnF("cluster deliver to group [%s] error : %s", group, err.Error())
+	}
+}
+
+// 投递到本地所有连接，实现 ClusterHandler
+func (s *service) DeliverToAll(message Message) {
+	if err := s.manager.BroadcastAll(message); err != nil {
+		log.WarnF("cluster deliver to all error : %s", err.Error())
+	}
+}
+
+// 踢掉本地指定 id 的连接，实现 ClusterHandler
+func (s *service) KickLocal(id string) {
+	if err := kick(s.manager, nil, id); err != nil {
+		log.WarnF("cluster kick [%s] error : %s", id, err.Error())
+	}
+}
+
+// 是否已关闭
+func (s *service) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// 登记一次处理中的调用链，服务已关闭时返回 false
+func (s *service) enter() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.inFlight.Add(1)
+	return true
+}
+
 // 接收进入流
 func (s *service) receive() {
 	for {
@@ -200,29 +1119,140 @@ func (s *service) receive() {
 			break
 		}
 
+		// 认证
+		if s.authorize(req) {
+			continue
+		}
+
 		// 路由
-		handleCLL, err := s.router.RouteHandleFun(req.Module, req.Route)
-		if err != nil {
-			log.ErrorF("route [%s]-[%s] error : %s", req.Module, req.Route, err.Error())
+		handleCLL, route := s.match(req)
+
+		// 服务关闭后不再分发新消息
+		if !s.enter() {
+			log.DebugF("service already shut down, drop [%s]-[%s] from [%s]", req.Module, req.Route, req.ID)
 			continue
 		}
 
-		// 开线程去处理
-		// 因此 Module 的 Route() 中注册的函数必然会发生竞态，如果有需要保护的数据，需要开发者自己维护
-		go func(cll CallLinkedList, request Message) {
-			// 新建上下文
-			ctx := NewContext(request)
-			// 上下文钩住当前 Service 的 manager(端管理) 的查找函数
-			ctx.HookFind(s.manager.FindItem)
-			// 调用链持有上下文开始按加入节点顺序调用
-			cll.Run(ctx)
-		}(handleCLL, req)
+		// 交由分发器处理，并发模式下同一个 Module 的 Route() 中注册的函数会在多个工作者中并发执行
+		// 因此必然会发生竞态，如果有需要保护的数据，需要开发者自己维护
+		// 有序模式下以 Item 的唯一标识为串行通道键，同一个 Item 的消息按到达顺序执行
+		key := ""
+		if s.dispatchMode(req.Module) == DispatchModeOrdered {
+			key = req.ID
+		}
+
+		if err := s.dispatcher.Dispatch(Task{
+			Message: req,
+			Key:     key,
+			Run:     s.handle(handleCLL, req, route),
+			Discard: s.inFlight.Done,
+		}); err != nil {
+			log.WarnF("dispatch [%s]-[%s] from [%s] error : %s", req.Module, req.Route, req.ID, err.Error())
+		}
+	}
+}
+
+// 路由，模块或路由不存在时交由未找到处理，使客户端得到回复而不是等待超时
+func (s *service) match(request Message) (CallLinkedList, string) {
+	cll, route, err := s.router.Match(request.Module, request.Route)
+	if err != nil {
+		log.WarnF("route [%s]-[%s] error : %s", request.Module, request.Route, err.Error())
+		metricMessagesNotFound.Inc()
+		return s.notFoundHandler(request.Module), ""
+	}
+
+	metricMessagesIn.Inc(request.Module, route)
+	return cll, route
+}
+
+// 构建处理函数，新建上下文并执行调用链
+// route 为匹配到的已注册路由名，用于超时查找和指标，为空时表示未找到处理
+func (s *service) handle(cll CallLinkedList, request Message, route string) func() {
+	return func() {
+		defer s.inFlight.Done()
+
+		// 新建上下文，标准库上下文派生自请求所属 Item ，Item 已不存在时派生自服务
+		// 编解码器与 Item 当前使用的一致
+		parent := s.ctx
+		var codec Codec
+		if i, err := s.manager.FindItem(request.ID); err == nil {
+			parent = i.Context()
+			codec = i.Codec()
+		}
+		ctx, cancel := newRequestContext(parent, s.timeout(request.Module, route), request, route)
+		defer cancel()
+		ctx.HookCodec(codec)
+
+		// 上下文钩住当前 Service 的 manager(端管理) 及其查找函数
+		ctx.HookFind(s.manager.FindItem)
+		ctx.HookManager(s.manager)
+		ctx.HookCluster(s.cluster)
+		// 调用链持有上下文开始按加入节点顺序调用
+		start := time.Now()
+		cll.Run(ctx)
+		if route != "" {
+			metricHandleSeconds.Observe(time.Since(start).Seconds(), request.Module, route)
+		}
+	}
+}
+
+// 默认的未找到处理，回复 ReplyNotFound
+func NotFoundHandler(ctx Context) {
+	if err := ctx.Reply(ReplyNotFound(nil)); err != nil {
+		log.ErrorF("reply not found to [%s] error : %s", ctx.Request().ID, err.Error())
+	}
+	ctx.Done()
+}
+
+// 过载反馈，向请求来源回复过载 Reply
+// 在接收路径上被调用，回复在协程中发送，不阻塞接收；发送中的回复达到上限时直接放弃，由请求方超时
+func (s *service) overload(request Message) {
+	i, err := s.manager.FindItem(request.ID)
+	if err != nil {
+		return
+	}
+
+	select {
+	case s.overloads <- struct{}{}:
+	default:
+		return
 	}
+
+	go func() {
+		defer func() { <-s.overloads }()
+
+		ctx := NewContext(request)
+		ctx.HookFind(s.manager.FindItem)
+		ctx.HookCodec(i.Codec())
+		if err := ctx.Reply(ReplyOverload(nil)); err != nil {
+			log.ErrorF("reply overload to [%s] error : %s", request.ID, err.Error())
+		}
+	}()
 }
 
 // 接收 Gate 下放的连接
-func (s *service) acceptConn(conn Conn) {
-	i := NewItem(conn, s.packager.Clone(), DefaultEncrypter())
+func (s *service) acceptConn(gate string, conn Conn) {
+	// 服务关闭后拒绝新连接
+	if s.isClosed() {
+		if err := conn.Close(); err != nil {
+			log.ErrorF("service close rejected connection error : %s", err.Error())
+		}
+		return
+	}
+
+	// 直通连接不经过装包者及加密器
+	packager := s.packager.Clone()
+	encrypter := s.encrypter()
+	if pc, ok := conn.(PlainConn); ok && pc.Plain() {
+		packager, encrypter = plainPackager{}, plainEncrypter{}
+	}
+
+	i := newItem(s.ctx, conn, packager, encrypter)
+	i.heartbeat = s.heartbeat
+	i.codecs = s.codecs
+	i.compressors = s.compressors
+	i.threshold = s.threshold
+	i.gate = gate
 
 	if err := s.manager.ManageItem(i); err != nil {
 		log.ErrorF("service manage new item [%s] error : %s", i.ID().String(), err.Error())
@@ -232,7 +1262,44 @@ func (s *service) acceptConn(conn Conn) {
 		return
 	}
 
+	// 登记到集群
+	if s.cluster != nil {
+		if err := s.cluster.Register(i.ID().String()); err != nil {
+			log.ErrorF("cluster register [%s] error : %s", i.ID().String(), err.Error())
+		}
+	}
+
 	// 加入管理后再 Hook 和 开始接收消息
-	i.PassiveCloseFeedback(s.manager.RemoveItem)
-	go i.Receive(s.IntoStream)
+	// 移除成功时才减少活跃连接数，防止重复关闭导致重复计数
+	metricActiveConnections.Inc(gate)
+	i.PassiveCloseFeedback(func(id string) error {
+		if err := s.removeItem(id); err != nil {
+			return err
+		}
+		metricActiveConnections.Dec(gate)
+		return nil
+	})
+	s.authDeadline(i)
+
+	// 加密器需要密钥交换时发送本端握手数据
+	if err := i.handshake(); err != nil {
+		log.ErrorF("[%s] send handshake error : %s", i.ID().String(), err.Error())
+		i.CloseWithState(ItemStateHandshakeClose)
+		return
+	}
+
+	// 登记读取协程，服务已关闭时进入流即将关闭，不再开始读取
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		i.Close()
+		return
+	}
+	s.receivers.Add(1)
+	s.mutex.Unlock()
+
+	go func() {
+		defer s.receivers.Done()
+		i.Receive(s.IntoStream)
+	}()
 }
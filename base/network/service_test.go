@@ -0,0 +1,272 @@
+package network
+
+import (
+	oContext "context"
+	"github.com/gorilla/websocket"
+	"net"
+	"testing"
+	"time"
+)
+
+type testModule struct{}
+
+func (testModule) Name() string { return "test" }
+
+func (testModule) Route() map[string][]RouteHandleFunc {
+	return map[string][]RouteHandleFunc{
+		"echo": {func(ctx Context) { _ = ctx.Success(ctx.Request().Data) }},
+		"slow": {func(ctx Context) {
+			time.Sleep(200 * time.Millisecond)
+			_ = ctx.Success([]byte("slow"))
+		}},
+	}
+}
+
+// 取得一个空闲的本地地址
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen(DefaultNetwork, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+// 运行服务并等待入口开始监听
+func runService(t *testing.T, s Service, gates ...Gate) {
+	if err := s.Run(gates...); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
+// 同步请求并以 JSON 解码回覆
+func requestReply(t *testing.T, c Client, module, route string, data []byte) Reply {
+	response, err := c.RequestSync(Message{Module: module, Route: route, Data: data, Reply: module + "." + route})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := Reply{}
+	if err := c.Codec().Unmarshal(response.Data, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	return reply
+}
+
+func TestShutdownDrainsGRPC(t *testing.T) {
+	addr := freeAddress(t)
+	testShutdownDrains(t, addr, NewGRPCGate(addr))
+}
+
+func TestShutdownDrainsMux(t *testing.T) {
+	addr := freeAddress(t)
+	testShutdownDrains(t, addr, NewMuxGate(addr))
+}
+
+// 关闭服务时，gRPC 客户端处理中的请求及告别消息送达，进入流随后关闭
+func testShutdownDrains(t *testing.T, addr string, gate Gate) {
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, gate)
+
+	c := NewGRPCClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		message Message
+		err     error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		message, err := c.RequestSync(Message{Module: "test", Route: "slow", Reply: "slow"})
+		slow <- result{message, err}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := oContext.WithTimeout(oContext.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx, Message{Module: "test", Route: "bye"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 处理中的调用链在流关闭前回覆
+	r := <-slow
+	if r.err != nil {
+		t.Fatalf("in-flight request error : %v", r.err)
+	}
+	reply := Reply{}
+	if err := JSONCodec().Unmarshal(r.message.Data, &reply); err != nil || string(reply.Data) != "slow" {
+		t.Fatalf("in-flight reply = %s , %v", r.message.Data, err)
+	}
+
+	// 告别消息送达
+	goodbye, err := c.Receive()
+	if err != nil || goodbye.Route != "bye" {
+		t.Fatalf("goodbye = %+v , %v", goodbye, err)
+	}
+
+	// 进入流已关闭，receive() 随之退出
+	select {
+	case _, ok := <-s.(*service).IntoStream:
+		if ok {
+			t.Fatal("IntoStream must be closed after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("IntoStream must be closed after shutdown")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	if DefaultHeartbeat().Timeout != 0 {
+		t.Fatal("idle timeout must be opt-in")
+	}
+
+	socketAddress, webSocketAddress := freeAddress(t), freeAddress(t)
+	s := NewService(10, 10)
+	heartbeat := DefaultHeartbeat()
+	heartbeat.Interval, heartbeat.Timeout = 50*time.Millisecond, 200*time.Millisecond
+	if err := s.SetHeartbeat(heartbeat); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGate(socketAddress), NewWebSocketGate(webSocketAddress, WebSocketOption{PingInterval: 50 * time.Millisecond}))
+	defer s.Shutdown(nil)
+
+	// 不发送应用层心跳的 socket 客户端
+	silent := NewSocketClient(socketAddress, DefaultPackager(), DefaultEncrypter())
+	if err := silent.SetHeartbeat(Heartbeat{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := silent.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只响应原生 ping 的浏览器式 WebSocket 客户端
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+webSocketAddress+DefaultWebSocketPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	go func() {
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	items := s.Items()
+	if len(items) != 1 || items[0].Gate() != WebSocketGateName {
+		t.Fatalf("items after idle timeout = %d , want only the websocket item", len(items))
+	}
+}
+
+// 关闭后读取依旧阻塞的连接
+type stuckConn struct {
+	baseConn
+	release chan struct{}
+}
+
+func (sc *stuckConn) Read() ([]byte, error) {
+	<-sc.release
+	return nil, ErrConnClosed
+}
+
+func (sc *stuckConn) Write([]byte) error { return nil }
+
+func (sc *stuckConn) Close() error { return nil }
+
+func (sc *stuckConn) IsClosed() bool { return false }
+
+func (sc *stuckConn) UniqueSymbol() string { return "stuck" }
+
+func (sc *stuckConn) RemoteAddr() string { return "stuck" }
+
+func TestShutdownDeadlineWithStuckReceiver(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	runService(t, s, NewSocketGate(addr))
+
+	// 经由入口接纳一个连接，保证入口已经初始化完成
+	c, err := net.Dial(DefaultNetwork, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	conn := &stuckConn{release: make(chan struct{})}
+	s.(*service).acceptConn("stuck", conn)
+
+	ctx, cancel := oContext.WithTimeout(oContext.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != oContext.DeadlineExceeded {
+			t.Fatalf("shutdown = %v , want %v", err, oContext.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shutdown must return once ctx is done")
+	}
+
+	// 读取协程退出后进入流随之关闭
+	close(conn.release)
+	select {
+	case _, ok := <-s.(*service).IntoStream:
+		if ok {
+			t.Fatal("IntoStream must be closed after receivers exit")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("IntoStream must be closed after receivers exit")
+	}
+}
+
+// 写入阻塞直到释放的连接
+type blockedConn struct {
+	stuckConn
+	writes chan struct{}
+}
+
+func (bc *blockedConn) Write([]byte) error {
+	bc.writes <- struct{}{}
+	<-bc.release
+	return nil
+}
+
+func TestOverloadReplyDoesNotBlock(t *testing.T) {
+	s := NewService(10, 10)
+	conn := &blockedConn{stuckConn: stuckConn{release: make(chan struct{})}, writes: make(chan struct{}, 1)}
+	s.(*service).acceptConn("blocked", conn)
+	defer close(conn.release)
+
+	items := s.Items()
+	if len(items) != 1 {
+		t.Fatalf("items = %d , want 1", len(items))
+	}
+
+	// 接收路径上的过载回复不能等待写入完成
+	done := make(chan struct{})
+	go func() {
+		s.(*service).overload(Message{ID: items[0].ID().String(), Reply: "overload"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("overload must return before the reply is written")
+	}
+	select {
+	case <-conn.writes:
+	case <-time.After(time.Second):
+		t.Fatal("overload reply must still be written")
+	}
+}
@@ -0,0 +1,312 @@
+// SessionEncrypter 是基于 X25519 密钥交换的认证加密器，每个连接使用独立的实例及会话密钥，SETer 依旧作为默认加密器供旧客户端使用
+// 握手：双方在连接建立后立即发送握手数据 SessionMagic + 版本 + 加密套件 + X25519 公钥，握手数据不加密，装包时附带 FrameFlagHandshake
+// 服务端在 Item 创建时发送，客户端在 Initialize() 中发送，双方收到的第一个数据帧必须是对端的握手数据，加密套件不一致时握手失败
+// 密钥：以 HKDF-SHA256 从共享密钥派生两个方向的会话密钥，salt 为按字节序排列的双方公钥，公钥较小的一方使用第一个密钥发送
+// 加密：密文为 8 字节大端序计数器 + AEAD 密文，计数器同时作为 nonce ，每个方向从 1 开始递增，不会重复
+// 重放：接收方记录最大计数器及其之前 ReplayWindow 个计数器是否已接收，重复或过旧的计数器与认证失败一样，Decrypt() 返回 nil
+// 并发发送时加密与写入之间可能乱序，窗口内的乱序可以正常接收
+package network
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"sync"
+)
+
+type (
+	// 加密套件
+	CipherSuite uint8
+
+	// 需要密钥交换的加密器定义，每个连接必须使用独立的实例
+	KeyExchanger interface {
+		Encrypter
+
+		// 生成本端密钥对，返回发送给对端的握手数据
+		Hello() ([]byte, error)
+
+		// 以对端的握手数据派生会话密钥
+		Exchange([]byte) error
+
+		// 是否已经派生会话密钥，之前不能加密和解密
+		Ready() bool
+	}
+
+	// 加密器工厂，Service 为每个连接新建一个加密器
+	EncrypterFactory func() Encrypter
+
+	// 会话加密器实现
+	sessionEncrypter struct {
+		suite       CipherSuite        // 加密套件
+		private     [32]byte           // 本端私钥
+		public      [32]byte           // 本端公钥
+		send        cipher.AEAD        // 发送方向的认证加密
+		recv        cipher.AEAD        // 接收方向的认证加密
+		sendCounter uint64             // 已发送的最大计数器
+		recvMax     uint64             // 已接收的最大计数器
+		recvSeen    [ReplayWindow]bool // 重放窗口，以计数器对 ReplayWindow 取余为下标
+		ready       bool               // 是否已派生会话密钥
+		mutex       sync.Mutex         // 竞态锁
+	}
+)
+
+// 此常量组定义了加密套件
+const (
+	CipherAESGCM           CipherSuite = iota + 1 // AES-256-GCM
+	CipherChaCha20Poly1305                        // ChaCha20-Poly1305
+)
+
+// 此常量组定义了会话加密器的握手及密文格式
+const (
+	SessionMagic      = "JVKX"                     // 握手魔数
+	SessionVersion    = 1                          // 握手版本
+	SessionHelloLen   = len(SessionMagic) + 2 + 32 // 握手数据长度，魔数 + 版本 1 + 加密套件 1 + 公钥 32
+	SessionKeyInfo    = "jarvis session key"       // HKDF info
+	ReplayWindow      = 1024                       // 重放窗口大小
+	sessionCounterLen = 8                          // 计数器长度
+)
+
+// 此常量组定义了会话加密器中可能会发生的错误文本
+const (
+	ErrUnknownCipherSuiteText  = "unknown cipher suite"
+	ErrInvalidHelloText        = "invalid handshake hello"
+	ErrCipherSuiteMismatchText = "cipher suite mismatch"
+	ErrWeakPublicKeyText       = "weak public key"
+	ErrHandshakeIncompleteText = "handshake incomplete"
+	ErrDecryptFailedText       = "decrypt failed, authentication or replay check failed"
+)
+
+var (
+	// 未知加密套件 错误
+	ErrUnknownCipherSuite = errors.New(ErrUnknownCipherSuiteText)
+	// 握手数据不正确 错误
+	ErrInvalidHello = errors.New(ErrInvalidHelloText)
+	// 加密套件不一致 错误
+	ErrCipherSuiteMismatch = errors.New(ErrCipherSuiteMismatchText)
+	// 对端公钥不安全 错误
+	ErrWeakPublicKey = errors.New(ErrWeakPublicKeyText)
+	// 握手未完成 错误
+	ErrHandshakeIncomplete = errors.New(ErrHandshakeIncompleteText)
+	// 解密失败 错误
+	ErrDecryptFailed = errors.New(ErrDecryptFailedText)
+)
+
+// 新建会话加密器，客户端直接使用，服务端通过 Service.SetEncrypter() 设置工厂
+func NewSessionEncrypter(suite CipherSuite) KeyExchanger {
+	return &sessionEncrypter{
+		suite: suite,
+		mutex: sync.Mutex{},
+	}
+}
+
+// 会话加密器工厂
+func SessionEncrypterFactory(suite CipherSuite) EncrypterFactory {
+	return func() Encrypter {
+		return NewSessionEncrypter(suite)
+	}
+}
+
+// 加密套件可读化
+func (cs CipherSuite) String() string {
+	switch cs {
+	case CipherAESGCM:
+		return "AES-256-GCM"
+	case CipherChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	default:
+		return "Unknown"
+	}
+}
+
+// 以密钥新建认证加密
+func (cs CipherSuite) aead(key []byte) (cipher.AEAD, error) {
+	switch cs {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, ErrUnknownCipherSuite
+	}
+}
+
+// 生成本端密钥对，返回握手数据
+func (se *sessionEncrypter) Hello() ([]byte, error) {
+	if se.suite != CipherAESGCM && se.suite != CipherChaCha20Poly1305 {
+		return nil, ErrUnknownCipherSuite
+	}
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	if _, err := io.ReadFull(rand.Reader, se.private[:]); err != nil {
+		return nil, err
+	}
+	curve25519.ScalarBaseMult(&se.public, &se.private)
+
+	hello := make([]byte, 0, SessionHelloLen)
+	hello = append(hello, SessionMagic...)
+	hello = append(hello, SessionVersion, byte(se.suite))
+	hello = append(hello, se.public[:]...)
+	return hello, nil
+}
+
+// 以对端的握手数据派生会话密钥
+func (se *sessionEncrypter) Exchange(hello []byte) error {
+	if len(hello) != SessionHelloLen || string(hello[:len(SessionMagic)]) != SessionMagic ||
+		hello[len(SessionMagic)] != SessionVersion {
+		return ErrInvalidHello
+	}
+	if CipherSuite(hello[len(SessionMagic)+1]) != se.suite {
+		return ErrCipherSuiteMismatch
+	}
+
+	peer := [32]byte{}
+	copy(peer[:], hello[len(SessionMagic)+2:])
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	// 共享密钥
+	shared := [32]byte{}
+	curve25519.ScalarMult(&shared, &se.private, &peer)
+	if shared == [32]byte{} {
+		return ErrWeakPublicKey
+	}
+
+	// 公钥较小的一方以第一个密钥发送
+	low, high := se.public[:], peer[:]
+	first := true
+	if bytes.Compare(low, high) > 0 {
+		low, high = high, low
+		first = false
+	}
+
+	// 派生两个方向的会话密钥
+	keys := make([]byte, 64)
+	salt := append(append(make([]byte, 0, 64), low...), high...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared[:], salt, []byte(SessionKeyInfo)), keys); err != nil {
+		return err
+	}
+	sendKey, recvKey := keys[:32], keys[32:]
+	if !first {
+		sendKey, recvKey = recvKey, sendKey
+	}
+
+	send, err := se.suite.aead(sendKey)
+	if err != nil {
+		return err
+	}
+	recv, err := se.suite.aead(recvKey)
+	if err != nil {
+		return err
+	}
+
+	se.send = send
+	se.recv = recv
+	se.ready = true
+	return nil
+}
+
+// 是否已派生会话密钥
+func (se *sessionEncrypter) Ready() bool {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+	return se.ready
+}
+
+// 加密，未派生会话密钥时返回 nil
+func (se *sessionEncrypter) Encrypt(data []byte) []byte {
+	se.mutex.Lock()
+	if !se.ready {
+		se.mutex.Unlock()
+		return nil
+	}
+	se.sendCounter++
+	counter := se.sendCounter
+	send := se.send
+	se.mutex.Unlock()
+
+	out := make([]byte, sessionCounterLen, sessionCounterLen+len(data)+send.Overhead())
+	binary.BigEndian.PutUint64(out, counter)
+	return send.Seal(out, sessionNonce(send, counter), data, nil)
+}
+
+// 解密，未派生会话密钥、认证失败或重放时返回 nil
+func (se *sessionEncrypter) Decrypt(data []byte) []byte {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	if !se.ready || len(data) < sessionCounterLen+se.recv.Overhead() {
+		return nil
+	}
+
+	counter := binary.BigEndian.Uint64(data)
+	if !se.acceptable(counter) {
+		return nil
+	}
+
+	plain, err := se.recv.Open(nil, sessionNonce(se.recv, counter), data[sessionCounterLen:], nil)
+	if err != nil {
+		return nil
+	}
+	se.mark(counter)
+
+	// 保证成功解密的结果不为 nil
+	if plain == nil {
+		plain = make([]byte, 0)
+	}
+	return plain
+}
+
+// 计数器是否可以接收，过旧或已接收的计数器不可接收
+// 调用方必须持有 se.mutex
+func (se *sessionEncrypter) acceptable(counter uint64) bool {
+	if counter == 0 {
+		return false
+	}
+	if counter > se.recvMax {
+		return true
+	}
+	if se.recvMax-counter >= ReplayWindow {
+		return false
+	}
+
+	return !se.recvSeen[counter%ReplayWindow]
+}
+
+// 记录已接收的计数器，计数器超过最大值时滑动窗口
+// 调用方必须持有 se.mutex
+func (se *sessionEncrypter) mark(counter uint64) {
+	if counter > se.recvMax {
+		if counter-se.recvMax >= ReplayWindow {
+			se.recvSeen = [ReplayWindow]bool{}
+		} else {
+			for c := se.recvMax + 1; c < counter; c++ {
+				se.recvSeen[c%ReplayWindow] = false
+			}
+		}
+		se.recvMax = counter
+	}
+
+	se.recvSeen[counter%ReplayWindow] = true
+}
+
+// 以计数器构造 nonce ，前部补 0
+func sessionNonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-sessionCounterLen:], counter)
+	return nonce
+}
@@ -0,0 +1,138 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 新建一对已完成密钥交换的会话加密器
+func sessionPair(t *testing.T, suite CipherSuite) (KeyExchanger, KeyExchanger) {
+	a, b := NewSessionEncrypter(suite), NewSessionEncrypter(suite)
+	aHello, err := a.Hello()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bHello, err := b.Hello()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Exchange(bHello); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Exchange(aHello); err != nil {
+		t.Fatal(err)
+	}
+
+	return a, b
+}
+
+func TestSessionEncrypterRoundTrip(t *testing.T) {
+	for _, suite := range []CipherSuite{CipherAESGCM, CipherChaCha20Poly1305} {
+		t.Run(suite.String(), func(t *testing.T) {
+			a, b := sessionPair(t, suite)
+			for _, data := range [][]byte{binaryPayload(), {}, []byte("jarvis")} {
+				// 两个方向使用不同的会话密钥
+				if plain := b.Decrypt(a.Encrypt(data)); plain == nil || !bytes.Equal(plain, data) {
+					t.Fatalf("a -> b = %v , want %d bytes", plain, len(data))
+				}
+				if plain := a.Decrypt(b.Encrypt(data)); plain == nil || !bytes.Equal(plain, data) {
+					t.Fatalf("b -> a = %v , want %d bytes", plain, len(data))
+				}
+				if a.Decrypt(a.Encrypt(data)) != nil {
+					t.Fatal("sender must not decrypt its own frame")
+				}
+			}
+		})
+	}
+}
+
+func TestSessionEncrypterNotReady(t *testing.T) {
+	se := NewSessionEncrypter(CipherAESGCM)
+	if se.Ready() || se.Encrypt([]byte("jarvis")) != nil || se.Decrypt([]byte("jarvis")) != nil {
+		t.Fatal("encrypter must not work before key exchange")
+	}
+}
+
+func TestSessionEncrypterReplay(t *testing.T) {
+	a, b := sessionPair(t, CipherChaCha20Poly1305)
+
+	first, second := a.Encrypt([]byte("first")), a.Encrypt([]byte("second"))
+	if b.Decrypt(second) == nil {
+		t.Fatal("second frame must be accepted")
+	}
+	// 窗口内的乱序可以接收
+	if b.Decrypt(first) == nil {
+		t.Fatal("out of order frame within window must be accepted")
+	}
+	// 重放
+	if b.Decrypt(first) != nil || b.Decrypt(second) != nil {
+		t.Fatal("replayed frame must be rejected")
+	}
+
+	// 过旧的计数器
+	stale := a.Encrypt([]byte("stale"))
+	for i := 0; i < ReplayWindow; i++ {
+		if b.Decrypt(a.Encrypt([]byte("jarvis"))) == nil {
+			t.Fatal("fresh frame must be accepted")
+		}
+	}
+	if b.Decrypt(stale) != nil {
+		t.Fatal("frame older than replay window must be rejected")
+	}
+}
+
+func TestSessionEncrypterTampered(t *testing.T) {
+	a, b := sessionPair(t, CipherAESGCM)
+
+	frame := a.Encrypt([]byte("jarvis"))
+	tampered := append([]byte(nil), frame...)
+	tampered[len(tampered)-1] ^= 0xff
+	if b.Decrypt(tampered) != nil {
+		t.Fatal("tampered frame must be rejected")
+	}
+	// 认证失败不记录计数器，原数据帧依旧可以接收
+	if plain := b.Decrypt(frame); string(plain) != "jarvis" {
+		t.Fatalf("original frame = %q , want jarvis", plain)
+	}
+
+	// 篡改计数器同样认证失败
+	next := a.Encrypt([]byte("jarvis"))
+	next[sessionCounterLen-1]++
+	if b.Decrypt(next) != nil {
+		t.Fatal("frame with tampered counter must be rejected")
+	}
+	if b.Decrypt(next[:sessionCounterLen]) != nil {
+		t.Fatal("truncated frame must be rejected")
+	}
+}
+
+func TestSessionEncrypterHandshake(t *testing.T) {
+	if _, err := NewSessionEncrypter(CipherSuite(0)).Hello(); err != ErrUnknownCipherSuite {
+		t.Fatalf("hello = %v , want %v", err, ErrUnknownCipherSuite)
+	}
+
+	a, b := NewSessionEncrypter(CipherAESGCM), NewSessionEncrypter(CipherChaCha20Poly1305)
+	if _, err := a.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	hello, err := b.Hello()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Exchange(hello); err != ErrCipherSuiteMismatch {
+		t.Fatalf("exchange = %v , want %v", err, ErrCipherSuiteMismatch)
+	}
+	if err := a.Exchange(hello[1:]); err != ErrInvalidHello {
+		t.Fatalf("exchange = %v , want %v", err, ErrInvalidHello)
+	}
+
+	// 全 0 公钥得到全 0 共享密钥
+	weak := append([]byte(SessionMagic), SessionVersion, byte(CipherAESGCM))
+	weak = append(weak, make([]byte, 32)...)
+	if err := a.Exchange(weak); err != ErrWeakPublicKey {
+		t.Fatalf("exchange = %v , want %v", err, ErrWeakPublicKey)
+	}
+	if a.Ready() {
+		t.Fatal("failed exchange must not derive session keys")
+	}
+}
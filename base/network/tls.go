@@ -0,0 +1,234 @@
+// TLSOption 描述入口及客户端的 TLS 配置，证书可以来自文件，也可以直接给出 *tls.Config
+// 入口：CertFile 、 KeyFile 为服务端证书，CAFile 不为空时要求客户端出示证书并以其校验，即双向 TLS
+// 客户端：CertFile 、 KeyFile 为双向 TLS 时出示的客户端证书，CAFile 为校验服务端证书的根证书，为空时使用系统根证书
+// 入口的 ReloadInterval 大于零时，握手时至多每隔 ReloadInterval 检查一次证书文件的修改时间，文件变化后重新加载，不需要重启服务
+// 校验通过的客户端证书由 Item.PeerCertificate() 取得
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"jarvis/base/log"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// TLS 选项
+	TLSOption struct {
+		Config         *tls.Config   // 基础配置，会被复制，文件中的证书追加到复制后的配置中
+		CertFile       string        // 证书文件
+		KeyFile        string        // 私钥文件
+		CAFile         string        // 根证书文件，入口用于校验客户端证书，客户端用于校验服务端证书
+		ServerName     string        // 客户端校验的服务端名称，为空时取连接地址中的主机名
+		ReloadInterval time.Duration // 入口检查证书文件修改的最小间隔，小于等于零时不重新加载
+	}
+
+	// 安全连接定义，Conn 实现此接口时可以取得 TLS 连接状态
+	SecureConn interface {
+		// TLS 连接状态，非 TLS 连接返回 nil
+		TLSState() *tls.ConnectionState
+	}
+
+	// 证书重新加载者，握手时按需检查证书文件
+	certReloader struct {
+		certFile  string           // 证书文件
+		keyFile   string           // 私钥文件
+		interval  time.Duration    // 检查间隔
+		cert      *tls.Certificate // 当前证书
+		modTime   time.Time        // 当前证书文件的修改时间
+		checkedAt time.Time        // 最后一次检查时间
+		mutex     sync.Mutex       // 竞态锁
+	}
+)
+
+const (
+	// 默认 TLS 握手超时时间
+	DefaultTLSHandshakeTimeout = time.Second * time.Duration(10)
+)
+
+// 此常量组定义了 TLS 配置中可能会发生的错误文本
+const (
+	ErrNoCertificateText  = "tls certificate is empty"
+	ErrInvalidCAFileText  = "no certificate found in ca file"
+	ErrIncompleteCertText = "cert file and key file must be set together"
+)
+
+var (
+	// 入口未设置证书 错误
+	ErrNoCertificate = errors.New(ErrNoCertificateText)
+	// 根证书文件中没有证书 错误
+	ErrInvalidCAFile = errors.New(ErrInvalidCAFileText)
+	// 证书文件与私钥文件未同时设置 错误
+	ErrIncompleteCert = errors.New(ErrIncompleteCertText)
+)
+
+// 入口使用的 TLS 配置
+func (o TLSOption) ServerConfig() (*tls.Config, error) {
+	config := o.baseConfig()
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, ErrIncompleteCert
+		}
+
+		reloader, err := newCertReloader(o.CertFile, o.KeyFile, o.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, ErrNoCertificate
+	}
+
+	if o.CAFile != "" {
+		pool, err := loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// 客户端使用的 TLS 配置
+func (o TLSOption) ClientConfig() (*tls.Config, error) {
+	config := o.baseConfig()
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, ErrIncompleteCert
+		}
+
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	if o.CAFile != "" {
+		pool, err := loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if o.ServerName != "" {
+		config.ServerName = o.ServerName
+	}
+
+	return config, nil
+}
+
+// 复制基础配置，未设置时新建，最低版本为 TLS 1.2
+func (o TLSOption) baseConfig() *tls.Config {
+	if o.Config != nil {
+		return o.Config.Clone()
+	}
+
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// 读取根证书文件
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrInvalidCAFile
+	}
+
+	return pool, nil
+}
+
+// 连接的 TLS 连接状态，非 TLS 连接返回 nil ，包装后的连接实现 SecureConn 时由其给出
+func connTLSState(conn interface{}) *tls.ConnectionState {
+	if sc, ok := conn.(SecureConn); ok {
+		return sc.TLSState()
+	}
+
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tc.ConnectionState()
+	return &state
+}
+
+// 校验通过的对端证书，未校验时返回 nil
+func verifiedPeerCertificate(conn Conn) *x509.Certificate {
+	sc, ok := conn.(SecureConn)
+	if !ok {
+		return nil
+	}
+
+	state := sc.TLSState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// 新建证书重新加载者，立即加载一次证书
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		mutex:    sync.Mutex{},
+	}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// 握手时取得证书，到达检查间隔且文件已修改时重新加载，加载失败时继续使用原证书
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if cr.interval > 0 && time.Since(cr.checkedAt) >= cr.interval {
+		cr.checkedAt = time.Now()
+		if info, err := os.Stat(cr.certFile); err == nil && !info.ModTime().Equal(cr.modTime) {
+			if err := cr.load(); err != nil {
+				log.ErrorF("reload tls certificate [%s] error : %s", cr.certFile, err.Error())
+			}
+		}
+	}
+
+	return cr.cert, nil
+}
+
+// 加载证书
+// 调用方必须持有 cr.mutex 或在发布前调用
+func (cr *certReloader) load() error {
+	info, err := os.Stat(cr.certFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.cert = &cert
+	cr.modTime = info.ModTime()
+	cr.checkedAt = time.Now()
+	return nil
+}
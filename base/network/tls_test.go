@@ -0,0 +1,127 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 签发证书并写入 dir ，parent 为 nil 时自签名，返回证书、私钥及文件路径
+func issueCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key, certFile, keyFile
+}
+
+func TestMutualTLSPeerCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jarvis-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey, caFile, _ := issueCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	_, _, serverCert, serverKey := issueCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	_, _, clientCert, clientKey := issueCert(t, dir, "frank", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	addr := freeAddress(t)
+	s := NewService(10, 10)
+	if err := s.RegisterModule(testModule{}); err != nil {
+		t.Fatal(err)
+	}
+	runService(t, s, NewSocketGateTLS(addr, TLSOption{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile}))
+	defer s.Shutdown(nil)
+
+	c := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := c.SetTLS(TLSOption{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if reply := requestReply(t, c, "test", "echo", []byte("jarvis")); string(reply.Data) != "jarvis" {
+		t.Fatalf("echo = %+v", reply)
+	}
+
+	// 校验通过的客户端证书由 Item 取得
+	items := s.Items()
+	if len(items) != 1 {
+		t.Fatalf("items = %d , want 1", len(items))
+	}
+	if cert := items[0].PeerCertificate(); cert == nil || cert.Subject.CommonName != "frank" {
+		t.Fatalf("peer certificate = %v , want frank", cert)
+	}
+
+	// 未出示客户端证书的连接无法建立
+	anonymous := NewSocketClient(addr, DefaultPackager(), DefaultEncrypter())
+	if err := anonymous.SetTLS(TLSOption{CAFile: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	// TLS 1.3 下客户端的握手可能先于服务端校验完成，服务端校验失败后不会接纳连接
+	if err := anonymous.Initialize(); err == nil {
+		defer anonymous.Close()
+		time.Sleep(100 * time.Millisecond)
+	}
+	if items := s.Items(); len(items) != 1 {
+		t.Fatalf("items = %d , want only the client with a certificate", len(items))
+	}
+}
+
+func TestPeerCertificateWithoutTLS(t *testing.T) {
+	if cert := pipeItem(t, DefaultPackager(), DefaultEncrypter()).PeerCertificate(); cert != nil {
+		t.Fatal("plain connection must not have a peer certificate")
+	}
+}
@@ -0,0 +1,115 @@
+// Typed 将 func(Context, *T) (R, error) 形式的类型化处理函数包装为 RouteHandleFunc
+// 请求数据 Message.Data 以 Context.Codec() 解码到新建的 T 中，Data 为空时 T 保持零值，解码失败回复 ReplyBadRequest
+// 处理函数返回的 R 以同一个编解码器编码后回复 ReplySuccess ，R 为 nil 时回复不带数据的 ReplySuccess
+// 处理函数返回 error 时不回复 R ：ReplyError （包括经由 %w 包装的）以其携带的状态码和状态语句回复，其他错误回复 ReplyServerError
+// 处理函数成功执行后调用链继续传递，需要中断时在处理函数中调用 ctx.Done() ，解码失败或回复错误时调用链中断
+package network
+
+import (
+	"errors"
+	"fmt"
+	"jarvis/base/log"
+	"reflect"
+)
+
+type (
+	// 携带回复状态码的错误，类型化处理函数返回此错误时以其状态码回复
+	ReplyError struct {
+		Code    int    // 状态码
+		Message string // 状态语句
+	}
+)
+
+var (
+	// Context 接口类型
+	contextType = reflect.TypeOf((*Context)(nil)).Elem()
+	// error 接口类型
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// 新建携带回复状态码的错误
+func NewReplyError(code int, message string) *ReplyError {
+	return &ReplyError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// 错误文本
+func (re *ReplyError) Error() string {
+	return fmt.Sprintf("%d %s", re.Code, re.Message)
+}
+
+// 包装类型化处理函数，function 必须为 func(Context, *T) (R, error) 形式
+// function 形式不正确属于编码错误，直接 panic ，以便在注册路由时尽早发现
+func Typed(function interface{}) RouteHandleFunc {
+	fv := reflect.ValueOf(function)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func ||
+		ft.NumIn() != 2 || ft.In(0) != contextType || ft.In(1).Kind() != reflect.Ptr ||
+		ft.NumOut() != 2 || ft.Out(1) != errorType {
+		panic(fmt.Sprintf("typed handler must be func(Context, *T) (R, error), got %s", ft.String()))
+	}
+	requestType := ft.In(1).Elem()
+
+	return func(ctx Context) {
+		codec := ctx.Codec()
+
+		// 解码请求，失败时中断调用链
+		request := reflect.New(requestType)
+		if data := ctx.Request().Data; len(data) != 0 {
+			if err := codec.Unmarshal(data, request.Interface()); err != nil {
+				logReplyError(ctx, ctx.BadRequest(err.Error()))
+				ctx.Done()
+				return
+			}
+		}
+
+		out := fv.Call([]reflect.Value{reflect.ValueOf(ctx), request})
+
+		// 错误映射为回复，并中断调用链
+		if err, _ := out[1].Interface().(error); err != nil {
+			re := &ReplyError{}
+			if errors.As(err, &re) {
+				logReplyError(ctx, ctx.Reply(Reply{Code: re.Code, Message: re.Message}))
+			} else {
+				logReplyError(ctx, ctx.ServerError(err))
+			}
+			ctx.Done()
+			return
+		}
+
+		// 编码响应
+		response := out[0]
+		if isNil(response) {
+			logReplyError(ctx, ctx.Success(nil))
+			return
+		}
+
+		data, err := codec.Marshal(response.Interface())
+		if err != nil {
+			logReplyError(ctx, ctx.ServerError(err))
+			ctx.Done()
+			return
+		}
+
+		logReplyError(ctx, ctx.Success(data))
+	}
+}
+
+// 记录回复错误
+func logReplyError(ctx Context, err error) {
+	if err != nil {
+		log.ErrorF("[%s] typed handler reply error : %s", ctx.Request().ID, err.Error())
+	}
+}
+
+// 是否为 nil
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
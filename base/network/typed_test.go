@@ -0,0 +1,74 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// 记录发送消息的端
+type sentItem struct {
+	Item
+	sent []Message
+}
+
+func (si *sentItem) Send(message Message) {
+	si.sent = append(si.sent, message)
+}
+
+type typedRequest struct {
+	Name string `json:"name"`
+}
+
+func TestTypedStopsChainOnError(t *testing.T) {
+	handler := Typed(func(ctx Context, request *typedRequest) (*typedRequest, error) {
+		switch request.Name {
+		case "fail":
+			return nil, errors.New("fail")
+		case "reply":
+			return nil, NewReplyError(403, "forbidden")
+		}
+		return request, nil
+	})
+
+	for data, wantNext := range map[string]bool{
+		`{"name":"ok"}`:    true,
+		`{`:                false, // 解码失败
+		`{"name":"fail"}`:  false,
+		`{"name":"reply"}`: false,
+	} {
+		next := false
+		cll := NewCallLinkedList()
+		cll.AddNode(handler)
+		cll.AddNode(func(Context) { next = true })
+
+		ctx := NewContext(Message{ID: "id", Module: "m", Route: "r", Data: []byte(data)})
+		cll.Run(ctx)
+		if next != wantNext {
+			t.Fatalf("data %s : next handler run = %v , want %v", data, next, wantNext)
+		}
+	}
+}
+
+func TestTypedWrappedReplyError(t *testing.T) {
+	handler := Typed(func(ctx Context, request *typedRequest) (*typedRequest, error) {
+		return nil, fmt.Errorf("load %s : %w", request.Name, NewReplyError(403, "forbidden"))
+	})
+
+	i := &sentItem{}
+	ctx := NewContext(Message{ID: "id", Module: "m", Route: "r", Data: []byte(`{"name":"frank"}`), Reply: "r"})
+	ctx.HookFind(func(string) (Item, error) { return i, nil })
+	handler(ctx)
+
+	// 被包装的 ReplyError 依旧以其状态码回复
+	if len(i.sent) != 1 {
+		t.Fatalf("sent = %d , want 1", len(i.sent))
+	}
+	reply := Reply{}
+	if err := JSONCodec().Unmarshal(i.sent[0].Data, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Code != 403 || reply.Message != "forbidden" {
+		t.Fatalf("reply = %d %s , want 403 forbidden", reply.Code, reply.Message)
+	}
+}
@@ -0,0 +1,343 @@
+// UDPGate 为对延迟敏感的游戏流量提供 UDP 入口，以对端地址为键为每个对端维护一个伪连接，交由 Service 像普通连接一样管理
+// 每个数据报即为一次读取，数据帧必须完整地放在一个数据报中，入口不保证送达、不去重、不排序，乱序可以由 NewSessionEncrypter() 的重放窗口接收
+// 伪连接在 IdleTimeout 内没有收到数据报时过期，读取返回 io.EOF ，Item 以 ItemStatePassiveClose 状态关闭，客户端的心跳会保持伪连接存活
+// 伪连接关闭后对端再发送数据报时会建立新的伪连接，相当于重新连接，需要重新认证及协商
+// 伪连接数目达到 MaxPeers 时丢弃未知对端的数据报，已有的伪连接不受影响，伪连接过期或关闭后才能接纳新的对端
+// 新的伪连接先放入第一个数据报，再于独立的协程中交给 Service ，Service 接纳连接时的阻塞（例如集群登记）不会阻塞读取，数据报依旧按序读取
+// 对应的客户端为 NewUDPClient()
+package network
+
+import (
+	"errors"
+	"io"
+	"jarvis/util/rand"
+	uTime "jarvis/util/time"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// UDP 入口选项，零值字段使用默认值
+	UDPOption struct {
+		IdleTimeout time.Duration // 伪连接过期时间，小于等于零时为 DefaultUDPIdleTimeout
+		QueueLength int           // 每个伪连接等待读取的数据报数量，队列已满时丢弃新的数据报，小于等于零时为 DefaultUDPQueueLength
+		MaxPeers    int           // 最大伪连接数目，达到时丢弃未知对端的数据报，小于等于零时为 DefaultUDPMaxPeers
+	}
+
+	// UDP 入口实现
+	udpGate struct {
+		baseGate
+		option   UDPOption
+		listener *net.UDPConn        // 监听者
+		peers    map[string]*udpConn // map[对端地址]伪连接
+		mutex    sync.Mutex          // 伪连接竞态锁
+	}
+
+	// UDP 伪连接实现
+	// 原子操作的时间置于结构起始，保证 32 位平台上的 64 位对齐
+	udpConn struct {
+		lastActive int64 // 最后一次收到数据报的时间，UnixNano
+		baseConn
+		gate     *udpGate      // 所属入口
+		listener *net.UDPConn  // 写入使用的监听者
+		addr     *net.UDPAddr  // 对端地址
+		in       chan []byte   // 等待读取的数据报
+		done     chan struct{} // 过期或关闭时关闭，此后读取返回 io.EOF
+		once     sync.Once     // 保证 done 只关闭一次
+		mutex    sync.Mutex    // 对关闭状态的多线程竞态加锁
+	}
+)
+
+const (
+	// UDP gate 名称
+	UDPGateName = "UDP Gate"
+	// UDP network
+	UDPNetwork = "udp"
+	// 最大数据报长度
+	MaxDatagramSize = 64 * 1024
+	// 默认伪连接过期时间
+	DefaultUDPIdleTimeout = DefaultHeartbeatTimeout
+	// 默认每个伪连接等待读取的数据报数量
+	DefaultUDPQueueLength = 64
+	// 默认最大伪连接数目
+	DefaultUDPMaxPeers = 4096
+)
+
+// 此常量组定义了 UDP 入口及客户端中可能会发生的错误文本
+const (
+	ErrUDPTLSText = "tls is not supported over udp"
+)
+
+var (
+	// UDP 不支持 TLS 错误
+	ErrUDPTLS = errors.New(ErrUDPTLSText)
+)
+
+// 实例化 udpGate 的 Gate 实现，可选的 UDPOption 只取第一个
+func NewUDPGate(addr string, options ...UDPOption) Gate {
+	option := UDPOption{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.IdleTimeout <= 0 {
+		option.IdleTimeout = DefaultUDPIdleTimeout
+	}
+	if option.QueueLength <= 0 {
+		option.QueueLength = DefaultUDPQueueLength
+	}
+	if option.MaxPeers <= 0 {
+		option.MaxPeers = DefaultUDPMaxPeers
+	}
+
+	return &udpGate{
+		baseGate: baseGate{address: addr},
+		option:   option,
+		peers:    make(map[string]*udpConn),
+		mutex:    sync.Mutex{},
+	}
+}
+
+// --------------------------------------------------- UDPGate ---------------------------------------------------------
+// 入口名称
+func (ug *udpGate) Name() string {
+	return UDPGateName
+}
+
+// 初始化
+func (ug *udpGate) Initialize() error {
+	if ug.address == "" {
+		return ErrEmptyAddress
+	}
+
+	addr, err := net.ResolveUDPAddr(UDPNetwork, ug.address)
+	if err != nil {
+		return err
+	}
+	l, err := net.ListenUDP(UDPNetwork, addr)
+	if err != nil {
+		return err
+	}
+
+	ug.listener = l
+
+	return nil
+}
+
+// 运行，按对端地址分发数据报，新的对端建立伪连接后在独立的协程中交给 Service
+func (ug *udpGate) Running(function func(Conn)) error {
+	if ug.listener == nil {
+		return ErrNilListener
+	}
+	if function == nil {
+		return ErrNilHookFunc
+	}
+
+	// 持有局部监听者，Destroy() 会将 ug.listener 置为 nil
+	listener := ug.listener
+
+	// 过期巡检，监听关闭后停止
+	stopped := int32(0)
+	uTime.NewTicker(ug.option.IdleTimeout/2, func(now time.Time) bool {
+		if atomic.LoadInt32(&stopped) == 1 {
+			return false
+		}
+		ug.expire(now)
+		return true
+	}).Run()
+
+	var e error
+	buffer := make([]byte, MaxDatagramSize)
+	for {
+		n, addr, err := listener.ReadFromUDP(buffer)
+		if err != nil {
+			e = err // 捕捉读取错误，反馈到 Service 中
+			break
+		}
+
+		conn, created := ug.peer(listener, addr)
+		if conn == nil { // 伪连接数目已达上限，丢弃未知对端的数据报
+			metricUDPDropped.Inc("max_peers")
+			continue
+		}
+
+		// 先放入数据报再交给 Service ，保证第一个数据报最先读取
+		conn.deliver(append([]byte(nil), buffer[:n]...))
+		if created {
+			go function(conn) // 下放到 Service.Manager 中管理，不阻塞读取
+		}
+	}
+
+	// 停止巡检，结束所有伪连接
+	atomic.StoreInt32(&stopped, 1)
+	ug.mutex.Lock()
+	peers := ug.peers
+	ug.peers = make(map[string]*udpConn)
+	ug.mutex.Unlock()
+	for _, conn := range peers {
+		conn.finish()
+	}
+
+	return e
+}
+
+// 销毁
+func (ug *udpGate) Destroy() error {
+	if ug.listener == nil {
+		return ErrNilListener
+	}
+
+	// 关闭监听并且置为 nil
+	if err := ug.listener.Close(); err != nil {
+		return err
+	}
+
+	ug.listener = nil
+
+	return nil
+}
+
+// 取得对端的伪连接，不存在时新建，返回是否为新建，伪连接数目已达上限时返回 nil
+func (ug *udpGate) peer(listener *net.UDPConn, addr *net.UDPAddr) (*udpConn, bool) {
+	key := addr.String()
+
+	ug.mutex.Lock()
+	defer ug.mutex.Unlock()
+
+	if conn, exist := ug.peers[key]; exist {
+		return conn, false
+	}
+	if len(ug.peers) >= ug.option.MaxPeers {
+		return nil, false
+	}
+
+	conn := &udpConn{
+		lastActive: time.Now().UnixNano(),
+		baseConn:   baseConn{},
+		gate:       ug,
+		listener:   listener,
+		addr:       addr,
+		in:         make(chan []byte, ug.option.QueueLength),
+		done:       make(chan struct{}),
+		once:       sync.Once{},
+		mutex:      sync.Mutex{},
+	}
+	ug.peers[key] = conn
+
+	return conn, true
+}
+
+// 移除伪连接，只移除 conn 本身，同一地址上新建的伪连接保留
+func (ug *udpGate) remove(conn *udpConn) {
+	key := conn.addr.String()
+
+	ug.mutex.Lock()
+	defer ug.mutex.Unlock()
+
+	if ug.peers[key] == conn {
+		delete(ug.peers, key)
+	}
+}
+
+// 结束超过 IdleTimeout 没有收到数据报的伪连接
+func (ug *udpGate) expire(now time.Time) {
+	expired := make([]*udpConn, 0)
+
+	ug.mutex.Lock()
+	for key, conn := range ug.peers {
+		if now.Sub(time.Unix(0, atomic.LoadInt64(&conn.lastActive))) > ug.option.IdleTimeout {
+			delete(ug.peers, key)
+			expired = append(expired, conn)
+		}
+	}
+	ug.mutex.Unlock()
+
+	for _, conn := range expired {
+		conn.finish()
+	}
+}
+
+// --------------------------------------------------- udpConn ---------------------------------------------------------
+// 投递数据报，伪连接已结束或队列已满时丢弃
+func (uc *udpConn) deliver(data []byte) {
+	atomic.StoreInt64(&uc.lastActive, time.Now().UnixNano())
+
+	select {
+	case <-uc.done:
+		return
+	default:
+	}
+
+	select {
+	case uc.in <- data:
+	default:
+		metricUDPDropped.Inc("queue_full")
+	}
+}
+
+// 结束伪连接，此后读取返回 io.EOF ，Item 随之关闭
+func (uc *udpConn) finish() {
+	uc.once.Do(func() {
+		close(uc.done)
+	})
+}
+
+// 读取，一次读取一个数据报
+// 当 err != nil 时，[]byte 为 nil
+func (uc *udpConn) Read() ([]byte, error) {
+	select {
+	case data := <-uc.in:
+		return data, nil
+	case <-uc.done:
+		return nil, io.EOF
+	}
+}
+
+// 写入，以一个数据报发送
+func (uc *udpConn) Write(data []byte) error {
+	if uc.IsClosed() {
+		return ErrConnClosed
+	}
+
+	_, err := uc.listener.WriteToUDP(data, uc.addr)
+
+	return err
+}
+
+// 关闭，重复关闭会报错
+func (uc *udpConn) Close() error {
+	uc.mutex.Lock()
+	if uc.closed {
+		uc.mutex.Unlock()
+		return ErrConnClosed
+	}
+	uc.closed = true
+	uc.mutex.Unlock()
+
+	uc.gate.remove(uc)
+	uc.finish()
+	return nil
+}
+
+// 询问是否已关闭
+func (uc *udpConn) IsClosed() bool {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	return uc.closed
+}
+
+// 唯一标识
+func (uc *udpConn) UniqueSymbol() string {
+	if uc.IsClosed() {
+		return ""
+	}
+
+	// 附带随机后缀，防止与同一地址上尚未关闭的旧伪连接冲突
+	return uc.addr.String() + "-" + rand.RandomString(4)
+}
+
+// 对端地址
+func (uc *udpConn) RemoteAddr() string {
+	return uc.addr.String()
+}
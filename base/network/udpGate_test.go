@@ -0,0 +1,139 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// 运行 UDP 入口，每个新的伪连接交给 function
+func runUDPGate(t *testing.T, option UDPOption, function func(Conn)) (Gate, string) {
+	g := NewUDPGate("127.0.0.1:0", option)
+	if err := g.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = g.Running(function) }()
+	t.Cleanup(func() { _ = g.Destroy() })
+
+	return g, g.(*udpGate).listener.LocalAddr().String()
+}
+
+// 新建 UDP 对端并发送数据报
+func udpPeer(t *testing.T, addr string, datagrams ...string) *net.UDPConn {
+	raddr, err := net.ResolveUDPAddr(UDPNetwork, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.DialUDP(UDPNetwork, nil, raddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	for _, datagram := range datagrams {
+		if _, err := c.Write([]byte(datagram)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// 在超时前读取一个数据报
+func readDatagram(t *testing.T, conn Conn) string {
+	read := make(chan []byte, 1)
+	go func() {
+		data, _ := conn.Read()
+		read <- data
+	}()
+
+	select {
+	case data := <-read:
+		return string(data)
+	case <-time.After(time.Second):
+		t.Fatal("read datagram timeout")
+		return ""
+	}
+}
+
+func TestUDPGateHandoff(t *testing.T) {
+	// 第一个伪连接交给 Service 时阻塞，不影响其他对端
+	conns, release := make(chan Conn, 2), make(chan struct{})
+	defer close(release)
+	_, addr := runUDPGate(t, UDPOption{}, func(conn Conn) {
+		conns <- conn
+		<-release
+	})
+
+	udpPeer(t, addr, "a1", "a2", "a3")
+	time.Sleep(50 * time.Millisecond)
+	udpPeer(t, addr, "b1")
+
+	firsts := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case conn := <-conns:
+			first := readDatagram(t, conn)
+			firsts[first] = true
+			if first != "a1" {
+				continue
+			}
+			// 同一对端的数据报按序读取
+			for _, want := range []string{"a2", "a3"} {
+				if got := readDatagram(t, conn); got != want {
+					t.Fatalf("datagram = %s , want %s", got, want)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("new peer must be handed off while another handoff blocks")
+		}
+	}
+	if !firsts["a1"] || !firsts["b1"] {
+		t.Fatalf("first datagrams = %v , want a1 and b1", firsts)
+	}
+}
+
+func TestUDPGateMaxPeers(t *testing.T) {
+	conns := make(chan Conn, 2)
+	g, addr := runUDPGate(t, UDPOption{MaxPeers: 1}, func(conn Conn) { conns <- conn })
+
+	known := udpPeer(t, addr, "a1")
+	first := <-conns
+	if got := readDatagram(t, first); got != "a1" {
+		t.Fatalf("datagram = %s , want a1", got)
+	}
+
+	// 达到上限后未知对端的数据报被丢弃，已有对端不受影响
+	udpPeer(t, addr, "b1")
+	if _, err := known.Write([]byte("a2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDatagram(t, first); got != "a2" {
+		t.Fatalf("datagram = %s , want a2", got)
+	}
+	select {
+	case <-conns:
+		t.Fatal("peer over limit must be dropped")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 伪连接关闭后可以接纳新的对端
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	udpPeer(t, addr, "c1")
+	select {
+	case conn := <-conns:
+		if got := readDatagram(t, conn); got != "c1" {
+			t.Fatalf("datagram = %s , want c1", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer must be accepted after another one closed")
+	}
+	ug := g.(*udpGate)
+	ug.mutex.Lock()
+	peers := len(ug.peers)
+	ug.mutex.Unlock()
+	if peers != 1 {
+		t.Fatalf("peers = %d , want 1", peers)
+	}
+}